@@ -0,0 +1,84 @@
+package flow
+
+import (
+	"sync"
+	"time"
+)
+
+// Cache caches the Outputs of Functions by key across runs, see WithCache and AddSteps.Cache.
+//
+// MemoryCache is the in-memory implementation,
+// implement Cache to share the Outputs by other storages, i.e. across processes.
+// now is from the clock of Workflow (see WithClock), Cache must be safe for concurrent use.
+type Cache interface {
+	// Get returns the Output cached by key, false if it's absent or expired.
+	Get(key string, now time.Time) (output any, ok bool)
+	// Set caches the Output by key, it expires after ttl.
+	Set(key string, output any, now time.Time, ttl time.Duration)
+}
+
+// MemoryCache is an in-memory Cache, the zero value is ready to use.
+//
+// Expired Outputs are evicted when looked up, or when another Output is cached.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	output   any
+	expireAt time.Time
+}
+
+func (c *MemoryCache) Get(key string, now time.Time) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(entry.expireAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.output, true
+}
+
+func (c *MemoryCache) Set(key string, output any, now time.Time, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	for k, entry := range c.entries { // evict the expired ones
+		if !now.Before(entry.expireAt) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{output: output, expireAt: now.Add(ttl)}
+}
+
+// loadCache sets the cached Output to the Step, returns true if the Step is Succeeded as cached.
+func (w *Workflow) loadCache(step Steper, state *State, option *StepOption) bool {
+	f, ok := step.(typedFunction)
+	if !ok || w.cache == nil || option == nil || option.CacheKey == "" {
+		return false
+	}
+	output, ok := w.cache.Get(option.CacheKey, w.clock.Now())
+	if !ok || !f.setOutput(output) {
+		return false
+	}
+	state.Lock()
+	defer state.Unlock()
+	state.cached = true
+	return true
+}
+
+// storeCache caches the Output of the Succeeded Step.
+func (w *Workflow) storeCache(step Steper, option *StepOption) {
+	f, ok := step.(typedFunction)
+	if !ok || w.cache == nil || option == nil || option.CacheKey == "" || option.CacheTTL <= 0 {
+		return
+	}
+	w.cache.Set(option.CacheKey, f.getOutput(), w.clock.Now(), option.CacheTTL)
+}
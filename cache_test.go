@@ -0,0 +1,94 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("reuse Output within ttl", func(t *testing.T) {
+		mock := clock.NewMock()
+		var calls atomic.Int32
+		expensive := FuncO("expensive", func(ctx context.Context) (int, error) {
+			return int(calls.Add(1)), nil
+		})
+		workflow := new(Workflow).Options(WithClock(mock), WithCache(new(MemoryCache)))
+		workflow.Add(Step(expensive).Cache("expensive", time.Minute))
+		for i := 0; i < 2; i++ {
+			run := workflow.Clone()
+			expensive.Output = 0
+			assert.NoError(t, run.Do(context.Background()))
+			assert.Equal(t, 1, expensive.Output)
+			assert.Equal(t, i > 0, run.StateOf(expensive).IsCached())
+			assert.Equal(t, Succeeded, run.StateOf(expensive).GetStatus())
+		}
+		mock.Add(time.Minute) // expired
+		run := workflow.Clone()
+		assert.NoError(t, run.Do(context.Background()))
+		assert.Equal(t, 2, expensive.Output)
+		assert.False(t, run.StateOf(expensive).IsCached())
+	})
+	t.Run("errors are not cached", func(t *testing.T) {
+		var calls atomic.Int32
+		flaky := FuncO("flaky", func(ctx context.Context) (string, error) {
+			if calls.Add(1) == 1 {
+				return "", fmt.Errorf("failed")
+			}
+			return "ok", nil
+		})
+		workflow := new(Workflow).Options(WithCache(new(MemoryCache)))
+		workflow.Add(Step(flaky).Cache("flaky", time.Hour))
+		assert.Error(t, workflow.Clone().Do(context.Background()))
+		assert.NoError(t, workflow.Clone().Do(context.Background()))
+		run := workflow.Clone()
+		assert.NoError(t, run.Do(context.Background()))
+		assert.True(t, run.StateOf(flaky).IsCached())
+		assert.Equal(t, "ok", flaky.Output)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+	t.Run("different Output type is not affected", func(t *testing.T) {
+		number := FuncO("number", func(ctx context.Context) (int, error) { return 42, nil })
+		text := FuncO("text", func(ctx context.Context) (string, error) { return "42", nil })
+		cache := new(MemoryCache)
+		assert.NoError(t, new(Workflow).Options(WithCache(cache)).Add(Step(number).Cache("answer", time.Hour)).Do(context.Background()))
+		workflow := new(Workflow).Options(WithCache(cache)).Add(Step(text).Cache("answer", time.Hour))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.False(t, workflow.StateOf(text).IsCached())
+		assert.Equal(t, "42", text.Output)
+	})
+	t.Run("concurrent Workflows", func(t *testing.T) {
+		// Steps are not shared, otherwise writing their Outputs races
+		cache := new(MemoryCache)
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				step := FuncO("answer", func(ctx context.Context) (int, error) { return 42, nil })
+				assert.NoError(t, new(Workflow).Options(WithCache(cache)).Add(Step(step).Cache("answer", time.Hour)).Do(context.Background()))
+				assert.Equal(t, 42, step.Output)
+			}()
+		}
+		wg.Wait()
+	})
+	t.Run("not shared by Workflows with different caches", func(t *testing.T) {
+		var calls atomic.Int32
+		answer := FuncO("answer", func(ctx context.Context) (int, error) { return int(calls.Add(1)), nil })
+		for i := 0; i < 2; i++ {
+			workflow := new(Workflow).Options(WithCache(new(MemoryCache)))
+			assert.NoError(t, workflow.Add(Step(answer).Cache("answer", time.Hour)).Do(context.Background()))
+			assert.False(t, workflow.StateOf(answer).IsCached())
+		}
+		workflow := new(Workflow).Add(Step(answer).Cache("answer", time.Hour))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.False(t, workflow.StateOf(answer).IsCached(), "no cache without WithCache")
+		assert.Equal(t, int32(3), calls.Load())
+	})
+}
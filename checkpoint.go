@@ -0,0 +1,168 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StateMarshaler is a Step able to save and restore its state (i.e. Output) for checkpoint.
+//
+// See Workflow.SaveCheckpoint and Workflow.LoadCheckpoint.
+type StateMarshaler interface {
+	Steper
+	MarshalState() ([]byte, error)
+	UnmarshalState([]byte) error
+}
+
+// Fingerprinter is a Step able to fingerprint its Input, for incremental re-execution.
+//
+// Fingerprint is called after Input callbacks and before Do.
+// If a Step Succeeded in the last run (see LoadCheckpoint) and its Fingerprint is unchanged,
+// Do is skipped and the Step is Succeeded as cached (see State.IsCached),
+// its state is restored from the checkpoint if it's a StateMarshaler.
+//
+// Steps not implementing Fingerprinter are restored by their status in the checkpoint,
+// that Succeeded Steps with saved states are not run again, regardless of their Input.
+type Fingerprinter interface {
+	Steper
+	Fingerprint(context.Context) (string, error)
+}
+
+// Checkpoint is the persisted progress of a Workflow, keys are String() of root Steps.
+type Checkpoint map[string]StepCheckpoint
+
+// StepCheckpoint is the persisted progress of a Step.
+type StepCheckpoint struct {
+	Status      StepStatus      `json:"status"`
+	State       json.RawMessage `json:"state,omitempty"`
+	Fingerprint string          `json:"fingerprint,omitempty"` // see Fingerprinter
+	// Rerun is true if the Step Succeeded but neither its state nor Fingerprint can be saved,
+	// the Step will run again after restored.
+	Rerun bool `json:"rerun,omitempty"`
+}
+
+// Rerun returns the Steps that Succeeded but will run again after restored.
+func (c Checkpoint) Rerun() []string {
+	rv := []string{}
+	for name, step := range c {
+		if step.Rerun {
+			rv = append(rv, name)
+		}
+	}
+	return rv
+}
+
+// fingerprint records the Fingerprint of the Step,
+// returns true if the Fingerprint is unchanged since the checkpoint, then Do should be skipped.
+func (w *Workflow) fingerprint(ctx context.Context, step Steper, state *State) (bool, error) {
+	fp, ok := step.(Fingerprinter)
+	if !ok {
+		return false, nil
+	}
+	fingerprint, err := fp.Fingerprint(ctx)
+	if err != nil {
+		return false, fmt.Errorf("fingerprint: %w", err)
+	}
+	state.Lock()
+	defer state.Unlock()
+	state.fingerprint = fingerprint
+	if state.checkpoint == nil || state.checkpoint.Fingerprint != fingerprint {
+		return false, nil
+	}
+	if sm, ok := step.(StateMarshaler); ok && len(state.checkpoint.State) > 0 {
+		if err := sm.UnmarshalState(state.checkpoint.State); err != nil {
+			return false, fmt.Errorf("unmarshal state of Step %s: %w", String(step), err)
+		}
+	}
+	state.cached = true
+	return true, nil
+}
+
+// SaveCheckpoint persists the Succeeded root Steps along with their states to writer.
+// Suspended Steps are saved with their partial states, see Workflow.Suspend.
+//
+// Steps implementing StateMarshaler have their states saved,
+// Steps implementing Fingerprinter have their Fingerprints saved,
+// other Succeeded Steps are flagged as Rerun, they will run again after restored.
+// Root Steps are identified by String(), so they should have unique names.
+//
+// SaveCheckpoint is safe to be called while the Workflow is running, i.e. to save progress periodically.
+func (w *Workflow) SaveCheckpoint(writer io.Writer) error {
+	w.topology.RLock()
+	defer w.topology.RUnlock()
+	checkpoint := make(Checkpoint)
+	for step, state := range w.state {
+		name := String(step)
+		if _, ok := checkpoint[name]; ok {
+			return fmt.Errorf("duplicate Step name %q in checkpoint", name)
+		}
+		sc := StepCheckpoint{Status: state.GetStatus()}
+		if sc.Status == Suspended {
+			state.RLock()
+			sc.State = state.partial
+			state.RUnlock()
+		}
+		if sc.Status == Succeeded {
+			sc.Fingerprint = state.getFingerprint()
+			if sm, ok := step.(StateMarshaler); ok {
+				state.RLock() // the state is unmarshaled with the lock held, see LoadCheckpoint
+				data, err := sm.MarshalState()
+				state.RUnlock()
+				if err != nil {
+					return fmt.Errorf("marshal state of Step %s: %w", name, err)
+				}
+				sc.State = data
+			} else if sc.Fingerprint == "" {
+				sc.Rerun = true
+			}
+		}
+		checkpoint[name] = sc
+	}
+	return json.NewEncoder(writer).Encode(checkpoint)
+}
+
+// LoadCheckpoint restores the progress of Workflow from reader, which is saved by SaveCheckpoint.
+//
+// Succeeded Steps with saved states are restored as Succeeded,
+// they will not run again in Do, and their states are available for Downstreams.
+// Suspended Steps remain Pending with their partial states, see SuspendedState.
+// Other Steps remain Pending.
+//
+//	workflow := buildWorkflow()
+//	if err := workflow.LoadCheckpoint(file); err != nil { ... }
+//	err := workflow.Do(ctx) // resume
+func (w *Workflow) LoadCheckpoint(reader io.Reader) error {
+	if !w.isRunning.TryLock() {
+		return ErrWorkflowIsRunning
+	}
+	defer w.isRunning.Unlock()
+	checkpoint := make(Checkpoint)
+	if err := json.NewDecoder(reader).Decode(&checkpoint); err != nil {
+		return err
+	}
+	for step, state := range w.state {
+		sc, ok := checkpoint[String(step)]
+		if ok && sc.Status == Suspended { // resume with the partial state, see Suspend
+			state.setPartial(sc.State)
+			continue
+		}
+		if !ok || sc.Status != Succeeded || sc.Rerun {
+			continue
+		}
+		if _, ok := step.(Fingerprinter); ok && sc.Fingerprint != "" {
+			// compare the Fingerprint when the Step is about to run
+			state.setCheckpoint(&sc)
+			continue
+		}
+		sm, ok := step.(StateMarshaler)
+		if !ok {
+			continue
+		}
+		if err := state.restore(sm, sc.State); err != nil {
+			return fmt.Errorf("unmarshal state of Step %s: %w", String(step), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	type steps struct {
+		answer *Function[struct{}, int]
+		print  *Function[int, string]
+		plain  *someStep
+		fail   *Function[struct{}, struct{}]
+	}
+	runs := map[string]int{}
+	build := func(failed bool) (*Workflow, steps) {
+		s := steps{
+			answer: FuncO("answer", func(ctx context.Context) (int, error) {
+				runs["answer"]++
+				return 42, nil
+			}),
+			print: FuncIO("print", func(ctx context.Context, i int) (string, error) {
+				runs["print"]++
+				return fmt.Sprint(i), nil
+			}),
+			plain: &someStep{value: "plain"},
+			fail: Func("fail", func(ctx context.Context) error {
+				runs["fail"]++
+				if failed {
+					return fmt.Errorf("failed")
+				}
+				return nil
+			}),
+		}
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(s.print).InputDependsOn(Adapt(s.answer, func(_ context.Context, answer *Function[struct{}, int], print *Function[int, string]) error {
+				print.Input = answer.Output
+				return nil
+			})),
+			Step(s.plain),
+			Step(s.fail).DependsOn(s.print),
+		)
+		return workflow, s
+	}
+
+	var buf bytes.Buffer
+	workflow, _ := build(true)
+	assert.Error(t, workflow.Do(context.Background()))
+	assert.NoError(t, workflow.SaveCheckpoint(&buf))
+
+	checkpoint := make(Checkpoint)
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &checkpoint))
+	assert.Equal(t, []string{String(&someStep{value: "plain"})}, checkpoint.Rerun())
+	assert.Equal(t, Failed, checkpoint["fail"].Status)
+
+	// restore in a new process
+	runs = map[string]int{}
+	workflow, s := build(false)
+	assert.NoError(t, workflow.LoadCheckpoint(&buf))
+	assert.Equal(t, Succeeded, workflow.StateOf(s.answer).GetStatus())
+	assert.Equal(t, 42, s.answer.Output)
+	assert.Equal(t, "42", s.print.Output)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, map[string]int{"fail": 1}, runs)
+	assert.Equal(t, Succeeded, workflow.StateOf(s.plain).GetStatus())
+
+	t.Run("observed while loading", func(t *testing.T) {
+		saved, err := json.Marshal(checkpoint)
+		assert.NoError(t, err)
+		workflow, s := build(false)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				_ = workflow.StateOf(s.answer).GetStatus()
+				_ = workflow.SaveCheckpoint(io.Discard)
+			}
+		}()
+		assert.NoError(t, workflow.LoadCheckpoint(bytes.NewReader(saved)))
+		<-done
+		assert.Equal(t, Succeeded, workflow.StateOf(s.answer).GetStatus())
+	})
+}
+
+// compile is a Step with Fingerprint of its Input.
+type compile struct {
+	Function[string, string]
+}
+
+func (c *compile) Fingerprint(context.Context) (string, error) { return "src:" + c.Input, nil }
+
+func TestFingerprint(t *testing.T) {
+	runs := 0
+	build := func(src string) (*Workflow, *compile) {
+		c := &compile{Function[string, string]{
+			Name: "compile",
+			DoFunc: func(ctx context.Context, src string) (string, error) {
+				runs++
+				return "bin:" + src, nil
+			},
+		}}
+		workflow := new(Workflow)
+		workflow.Add(Step(c).Input(func(ctx context.Context, c *compile) error {
+			c.Input = src
+			return nil
+		}))
+		return workflow, c
+	}
+	var buf bytes.Buffer
+	workflow, _ := build("v1")
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.NoError(t, workflow.SaveCheckpoint(&buf))
+	saved := buf.Bytes()
+
+	t.Run("unchanged is cached", func(t *testing.T) {
+		runs = 0
+		workflow, c := build("v1")
+		assert.NoError(t, workflow.LoadCheckpoint(bytes.NewReader(saved)))
+		assert.Equal(t, Pending, workflow.StateOf(c).GetStatus())
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Zero(t, runs)
+		assert.True(t, workflow.StateOf(c).IsCached())
+		assert.Equal(t, Succeeded, workflow.StateOf(c).GetStatus())
+		assert.Equal(t, "bin:v1", c.Output)
+	})
+	t.Run("changed is run", func(t *testing.T) {
+		runs = 0
+		workflow, c := build("v2")
+		assert.NoError(t, workflow.LoadCheckpoint(bytes.NewReader(saved)))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, 1, runs)
+		assert.False(t, workflow.StateOf(c).IsCached())
+		assert.Equal(t, "bin:v2", c.Output)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 )
 
 // StepStatus describes the status of a Step.
@@ -16,40 +17,58 @@ const (
 	Succeeded StepStatus = "Succeeded"
 	Canceled  StepStatus = "Canceled"
 	Skipped   StepStatus = "Skipped"
+	TimedOut  StepStatus = "TimedOut"  // exceeded its Timeout, see AddSteps.Timeout
+	Suspended StepStatus = "Suspended" // parked with partial state, neither terminated nor running, see Workflow.Suspend
 )
 
+// customStatuses are the custom terminal statuses registered by WithStatusMapper.
+var customStatuses sync.Map // StepStatus -> struct{}
+
+// IsTerminated returns true if the status is Failed, Succeeded, Canceled, Skipped, TimedOut,
+// or a custom status registered by WithStatusMapper.
 func (s StepStatus) IsTerminated() bool {
 	switch s {
-	case Failed, Succeeded, Canceled, Skipped:
+	case Failed, Succeeded, Canceled, Skipped, TimedOut:
 		return true
 	}
-	return false
+	_, ok := customStatuses.Load(s)
+	return ok
 }
 
+// isFailure returns true if the status is a failure of the Step, i.e. Failed or TimedOut.
+func isFailure(s StepStatus) bool { return s == Failed || s == TimedOut }
+
 func (s StepStatus) String() string {
 	switch s {
 	case Pending:
 		return "Pending"
-	case Running, Failed, Succeeded, Canceled, Skipped:
+	case Running, Failed, Succeeded, Canceled, Skipped, Suspended, TimedOut:
+		return string(s)
+	}
+	if _, ok := customStatuses.Load(s); ok {
 		return string(s)
-	default:
-		return fmt.Sprintf("Unknown(%s)", string(s))
 	}
+	return fmt.Sprintf("Unknown(%s)", string(s))
 }
 
 // Condition is a function to determine what's the next status of Step.
 // Condition makes the decision based on the status and result of all the Upstream Steps.
 // Condition is only called when all Upstreams are terminated.
+//
+// The ctx passed to Condition is the context of Workflow.Do, with its deadline and cancellation,
+// so Condition is able to check ctx.Err() or ctx.Deadline() to skip the rest Steps when the Workflow is out of time.
 type Condition func(ctx context.Context, ups map[Steper]StatusError) StepStatus
 
 var (
 	DefaultCondition Condition = AllSucceeded
 	// DefaultIsCanceled is used to determine whether an error is being regarded as canceled.
+	//
+	// ErrCancel is matched by type, since the one returned from Cancel carries an error, it never equals ErrCancel{}.
 	DefaultIsCanceled = func(err error) bool {
 		switch {
 		case errors.Is(err, context.Canceled),
 			errors.Is(err, context.DeadlineExceeded),
-			errors.Is(err, ErrCancel{}):
+			errors.As(err, new(ErrCancel)):
 			return true
 		}
 		return false
@@ -82,13 +101,13 @@ func BeCanceled(ctx context.Context, ups map[Steper]StatusError) StepStatus {
 	return Skipped
 }
 
-// AnyFailed: any Upstream is Failed
+// AnyFailed: any Upstream is Failed or TimedOut
 func AnyFailed(ctx context.Context, ups map[Steper]StatusError) StepStatus {
 	if DefaultIsCanceled(ctx.Err()) {
 		return Canceled
 	}
 	for _, up := range ups {
-		if up.Status == Failed {
+		if isFailure(up.Status) {
 			return Running
 		}
 	}
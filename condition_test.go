@@ -2,7 +2,9 @@ package flow
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -92,3 +94,42 @@ func TestAnyFailed(t *testing.T) {
 	})
 	assert.Equal(t, Canceled, stepStatus)
 }
+
+func TestDefaultIsCanceled(t *testing.T) {
+	assert.True(t, DefaultIsCanceled(context.Canceled))
+	assert.True(t, DefaultIsCanceled(context.DeadlineExceeded))
+	assert.True(t, DefaultIsCanceled(Cancel(fmt.Errorf("cancel"))))
+	assert.True(t, DefaultIsCanceled(fmt.Errorf("wrapped: %w", Cancel(fmt.Errorf("cancel")))))
+	assert.False(t, DefaultIsCanceled(Skip(fmt.Errorf("skip"))))
+	assert.False(t, DefaultIsCanceled(fmt.Errorf("failed")))
+	assert.False(t, DefaultIsCanceled(nil))
+}
+
+func TestConditionDeadline(t *testing.T) {
+	// skip the Step if the Workflow has less than 1s left
+	enoughTime := func(ctx context.Context, ups map[Steper]StatusError) StepStatus {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < time.Second {
+			return Skipped
+		}
+		return AllSucceeded(ctx, ups)
+	}
+	build := func() (*Workflow, Steper) {
+		up := Func("up", func(ctx context.Context) error { return nil })
+		down := Func("down", func(ctx context.Context) error { return nil })
+		return new(Workflow).Add(Step(down).DependsOn(up).When(enoughTime)), down
+	}
+	t.Run("near deadline", func(t *testing.T) {
+		workflow, down := build()
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, workflow.Do(ctx))
+		assert.Equal(t, Skipped, workflow.StateOf(down).GetStatus())
+	})
+	t.Run("enough time", func(t *testing.T) {
+		workflow, down := build()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		assert.NoError(t, workflow.Do(ctx))
+		assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+	})
+}
@@ -0,0 +1,39 @@
+package flow
+
+import "context"
+
+// stepContext is attached to the context passed to Step's Input and Do,
+// it allows helpers to look up the Workflow (and its State) running the Step.
+type stepContext struct {
+	workflow *Workflow
+	step     Steper
+	cancel   context.CancelCauseFunc // cancel the run of workflow, captured when the Step starts, see Abort
+	parent   *stepContext            // the step context of the outer Workflow, if nested
+}
+
+type stepContextKey struct{}
+
+func withStepContext(ctx context.Context, w *Workflow, step Steper) context.Context {
+	parent, _ := ctx.Value(stepContextKey{}).(*stepContext)
+	return context.WithValue(ctx, stepContextKey{}, &stepContext{
+		workflow: w,
+		step:     step,
+		cancel:   w.cancel,
+		parent:   parent,
+	})
+}
+
+func stepContextFrom(ctx context.Context) *stepContext {
+	sc, _ := ctx.Value(stepContextKey{}).(*stepContext)
+	return sc
+}
+
+// stateOf looks up the State of the Step from the innermost Workflow to the outermost.
+func (sc *stepContext) stateOf(step Steper) *State {
+	for ; sc != nil; sc = sc.parent {
+		if state := sc.workflow.StateOf(step); state != nil {
+			return state
+		}
+	}
+	return nil
+}
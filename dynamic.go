@@ -0,0 +1,121 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// AddDependency inserts newStep into the running Workflow as an Upstream of before, callable from within a Step,
+// i.e. a Step discovers at runtime that a Downstream needs another Step to run first.
+//
+//	Func("plan", func(ctx context.Context) error {
+//		if needsMigration() {
+//			return flow.AddDependency(ctx, migrate, deploy) // migrate -> deploy
+//		}
+//		return nil
+//	})
+//
+// The Workflow is required to reserve room for the new Steps by WithDynamicSteps.
+// before should be a Pending root Step in the Workflow running the caller, newStep joins the phase of before.
+// newStep is allowed to be in the Workflow already, as long as it doesn't depend on before (transitively).
+//
+// The dependency is applied once no Step is running, Workflow starts no new Step in the meantime,
+// so before never starts without newStep. The Steps added stay in the Workflow after Do.
+// AddDependency returns ErrAddDependency if the dependency is refused.
+func AddDependency(ctx context.Context, newStep, before Steper) error {
+	sc := stepContextFrom(ctx)
+	if sc == nil {
+		return ErrAddDependency{Step: newStep, Before: before, Reason: "not called from a running Step"}
+	}
+	return sc.workflow.addDependency(newStep, before)
+}
+
+// dependency is added by AddDependency, applied by tick.
+type dependency struct{ step, before Steper }
+
+func (w *Workflow) addDependency(step, before Steper) error {
+	refuse := func(format string, a ...any) error {
+		return ErrAddDependency{Step: step, Before: before, Reason: fmt.Sprintf(format, a...)}
+	}
+	if step == nil || before == nil {
+		return refuse("Step is nil")
+	}
+	w.dynamicMu.Lock()
+	defer w.dynamicMu.Unlock()
+	w.topology.RLock()
+	defer w.topology.RUnlock()
+	root := w.RootOf(before)
+	if root == nil || w.state[root] == nil {
+		return refuse("%s is not in the Workflow", String(before))
+	}
+	if status := w.state[root].GetStatus(); status != Pending {
+		return refuse("%s is already %s", String(root), status)
+	}
+	isNew := w.StateOf(step) == nil && !slices.ContainsFunc(w.dynamic, func(d dependency) bool { return d.step == step })
+	if isNew && w.dynamicAdded >= w.maxDynamic {
+		return refuse("exceeds max %d Steps added while running, see WithDynamicSteps", w.maxDynamic)
+	}
+	// before depends on step, so step must not depend on before, including the dependencies not applied yet
+	upstreamOf := func(s Steper) []Steper {
+		var ups []Steper
+		if w.StateOf(s) != nil {
+			for up := range w.UpstreamOf(s) {
+				ups = append(ups, up)
+			}
+		}
+		for _, d := range w.dynamic {
+			if d.before == s {
+				ups = append(ups, d.step)
+			}
+		}
+		return ups
+	}
+	if root := w.RootOf(step); root != nil {
+		step = root
+	}
+	seen := make(Set[Steper])
+	for queue := []Steper{step}; len(queue) > 0; queue = queue[1:] {
+		s := queue[0]
+		if s == root {
+			return refuse("%s depends on %s, it would form a cycle", String(step), String(root))
+		}
+		if !seen.Has(s) {
+			seen.Add(s)
+			queue = append(queue, upstreamOf(s)...)
+		}
+	}
+	if isNew {
+		w.dynamicAdded++
+	}
+	w.dynamic = append(w.dynamic, dependency{step: step, before: root})
+	return nil
+}
+
+// hasDynamic returns true if any dependency added by AddDependency is not applied yet.
+func (w *Workflow) hasDynamic() bool {
+	w.dynamicMu.Lock()
+	defer w.dynamicMu.Unlock()
+	return len(w.dynamic) > 0
+}
+
+// applyDynamic applies the dependencies added by AddDependency once no Step is running,
+// it's called by tick, so the Steps and dependencies are only changed by the goroutine reading them,
+// other goroutines reading them during Do should hold topology.RLock.
+func (w *Workflow) applyDynamic() {
+	if w.inflight.Load() > 0 {
+		return
+	}
+	w.dynamicMu.Lock()
+	defer w.dynamicMu.Unlock()
+	if len(w.dynamic) == 0 {
+		return
+	}
+	// the observers safe to call during Do (i.e. RunningSteps, SaveCheckpoint) read the topology from other goroutines
+	w.topology.Lock()
+	defer w.topology.Unlock()
+	for _, d := range w.dynamic {
+		w.PhaseAdd(w.PhaseOf(d.before), Steps(d.before).DependsOn(d.step))
+	}
+	w.dynamic = nil
+}
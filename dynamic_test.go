@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddDependency(t *testing.T) {
+	t.Run("insert before downstream", func(t *testing.T) {
+		var mu sync.Mutex
+		var order []string
+		record := func(name string) *Function[struct{}, struct{}] {
+			return Func(name, func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, name)
+				return nil
+			})
+		}
+		migrate, deploy := record("migrate"), record("deploy")
+		plan := Func("plan", func(ctx context.Context) error {
+			return AddDependency(ctx, migrate, deploy)
+		})
+		workflow := new(Workflow).Options(WithDynamicSteps(1))
+		workflow.Add(Step(deploy).DependsOn(plan))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []string{"migrate", "deploy"}, order)
+		assert.Equal(t, PhaseMain, workflow.PhaseOf(migrate))
+		assert.Contains(t, workflow.UpstreamOf(deploy), Steper(migrate))
+	})
+	t.Run("refused", func(t *testing.T) {
+		up, down, extra := noopStep("up"), noopStep("down"), noopStep("extra")
+		var errs []error
+		plan := Func("plan", func(ctx context.Context) error {
+			errs = append(errs,
+				AddDependency(ctx, down, up), // down depends on up
+				AddDependency(ctx, extra, ctx.Value(stepContextKey{}).(*stepContext).step), // plan is Running
+				AddDependency(ctx, extra, up), // no room without WithDynamicSteps
+			)
+			return nil
+		})
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(up).DependsOn(plan),
+			Step(down).DependsOn(up),
+		)
+		assert.NoError(t, workflow.Do(context.Background()))
+		if assert.Len(t, errs, 3) {
+			for _, err := range errs {
+				assert.ErrorAs(t, err, new(ErrAddDependency))
+			}
+			assert.ErrorContains(t, errs[0], "cycle")
+			assert.ErrorContains(t, errs[1], "already Running")
+			assert.ErrorContains(t, errs[2], "WithDynamicSteps")
+		}
+		assert.Nil(t, workflow.StateOf(extra))
+	})
+	t.Run("observed during Do", func(t *testing.T) {
+		plan, deploy := noopStep("plan"), noopStep("deploy")
+		var added []Steper
+		for i := 0; i < 10; i++ {
+			added = append(added, noopStep(fmt.Sprintf("added %d", i)))
+		}
+		plan.DoFunc = func(ctx context.Context, _ struct{}) (struct{}, error) {
+			for _, step := range added {
+				if err := AddDependency(ctx, step, deploy); err != nil {
+					return struct{}{}, err
+				}
+			}
+			return struct{}{}, nil
+		}
+		workflow := new(Workflow).Options(WithDynamicSteps(len(added)))
+		workflow.Add(Step(deploy).DependsOn(plan))
+		done := make(chan struct{})
+		observed := make(chan struct{})
+		go func() { // the observers safe to call during Do
+			defer close(observed)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				workflow.TotalCost()
+				workflow.RunningSteps()
+				workflow.StalledSteps(time.Hour)
+				workflow.CurrentPhase()
+				_ = workflow.SaveCheckpoint(io.Discard)
+			}
+		}()
+		assert.NoError(t, workflow.Do(context.Background()))
+		close(done)
+		<-observed
+		for _, step := range added {
+			assert.Equal(t, Succeeded, workflow.StateOf(step).GetStatus())
+		}
+	})
+	t.Run("not in Step", func(t *testing.T) {
+		assert.ErrorAs(t, AddDependency(context.Background(), noopStep("a"), noopStep("b")), new(ErrAddDependency))
+	})
+}
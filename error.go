@@ -3,7 +3,11 @@ package flow
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Cancel will terminate the current step and set status to `Canceled`.
@@ -22,6 +26,8 @@ func (e ErrSkip) Unwrap() error   { return e.error }
 type StatusError struct {
 	Status StepStatus
 	Err    error
+
+	order int // the order the Step terminated in the run, 0 if unknown, see ErrWorkflow.Summary
 }
 
 // StatusError will be printed as:
@@ -78,11 +84,24 @@ type ErrWorkflow map[Steper]StatusError
 //
 //	Step: [Status]
 //		error message
+//
+// Steps are sorted by name, so the output is stable.
 func (e ErrWorkflow) Error() string {
-	var builder strings.Builder
+	type entry struct{ name, msg string }
+	entries := make([]entry, 0, len(e))
 	for step, serr := range e {
-		builder.WriteString(fmt.Sprintf("%s: ", String(step)))
-		builder.WriteString(fmt.Sprintln(serr.Error()))
+		entries = append(entries, entry{String(step), serr.Error()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].name != entries[j].name {
+			return entries[i].name < entries[j].name
+		}
+		return entries[i].msg < entries[j].msg
+	})
+	var builder strings.Builder
+	for _, entry := range entries {
+		builder.WriteString(fmt.Sprintf("%s: ", entry.name))
+		builder.WriteString(fmt.Sprintln(entry.msg))
 	}
 	return builder.String()
 }
@@ -118,8 +137,94 @@ func (e ErrWorkflow) IsNil() bool {
 	return true
 }
 
+// WorkflowSummary is the headline of ErrWorkflow, see ErrWorkflow.Summary.
+type WorkflowSummary struct {
+	Counts   map[StepStatus]int // number of Steps by status
+	Canceled bool               // whether any Step is Canceled
+	Step     Steper             // the Step of Err, nil if no Step Failed
+	Err      error              // the first real error, i.e. the error of a Failed or TimedOut Step, instead of the cancellation
+
+	first StatusError // of Step
+}
+
+// Summary counts the Steps by status, and finds the first real error.
+//
+// The first real error is from the Failed or TimedOut Step terminated first in the run returning ErrWorkflow,
+// Steps with unknown order (i.e. ErrWorkflow not returned by Do) are sorted by name, so the result is stable.
+func (e ErrWorkflow) Summary() WorkflowSummary {
+	summary := WorkflowSummary{Counts: make(map[StepStatus]int)}
+	earlier := func(step Steper, serr StatusError) bool {
+		first := summary.first
+		switch {
+		case summary.Step == nil:
+			return true
+		case serr.order != first.order && serr.order > 0 && first.order > 0:
+			return serr.order < first.order
+		case serr.order != first.order:
+			return serr.order > 0 // known order goes first
+		}
+		return String(step) < String(summary.Step)
+	}
+	for step, serr := range e {
+		summary.Counts[serr.Status]++
+		switch {
+		case serr.Status == Canceled:
+			summary.Canceled = true
+		case isFailure(serr.Status):
+			if earlier(step, serr) {
+				summary.Step, summary.Err, summary.first = step, serr.Err, serr
+			}
+		}
+	}
+	return summary
+}
+
+// WorkflowSummary will be printed as one line, statuses are sorted, i.e.
+//
+//	3 Succeeded, 1 Failed (Step), 5 Canceled
+//
+// The Step of the first real error is printed after its status.
+func (s WorkflowSummary) String() string {
+	statuses := []StepStatus{Succeeded, Failed, TimedOut, Skipped, Canceled, Running, Pending}
+	customs := []StepStatus{}
+	for status := range s.Counts {
+		if !slices.Contains(statuses, status) {
+			customs = append(customs, status)
+		}
+	}
+	slices.Sort(customs)
+	parts := []string{}
+	for _, status := range append(statuses, customs...) {
+		if count := s.Counts[status]; count > 0 {
+			part := fmt.Sprintf("%d %s", count, status)
+			if s.Step != nil && status == s.first.Status {
+				part += fmt.Sprintf(" (%s)", String(s.Step))
+			}
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
 var ErrWorkflowIsRunning = fmt.Errorf("Workflow is running, please wait for it terminated")
 
+// ErrStepNotInWorkflow is returned when operating a Step not in the Workflow.
+type ErrStepNotInWorkflow struct{ Step Steper }
+
+func (e ErrStepNotInWorkflow) Error() string {
+	return fmt.Sprintf("Step %s is not in Workflow", String(e.Step))
+}
+
+// ErrTooManySteps is returned by Do if adding Step exceeds the limit set by WithMaxSteps.
+type ErrTooManySteps struct {
+	Step Steper // the first Step pushed past the limit
+	Max  int
+}
+
+func (e ErrTooManySteps) Error() string {
+	return fmt.Sprintf("adding Step %s exceeds the max number of Steps %d", String(e.Step), e.Max)
+}
+
 // Step status is not Pending when Workflow starts to run.
 type ErrUnexpectStepInitStatus map[Steper]StepStatus
 
@@ -137,8 +242,48 @@ func (e ErrUnexpectStepInitStatus) Error() string {
 }
 
 // There is a cycle-dependency in your Workflow!!!
+//
+// Keys are Steps in or depending on a cycle, values are their Upstreams in or depending on a cycle.
 type ErrCycleDependency map[Steper][]Steper
 
+// Cycle extracts one concrete cycle in order, each Step is an Upstream of the next one,
+// and the first Step is repeated at last, i.e. [a, b, c, a] means a -> b -> c -> a.
+//
+// It returns nil if no cycle is found.
+func (e ErrCycleDependency) Cycle() []Steper {
+	if len(e) == 0 {
+		return nil
+	}
+	// walk through Upstreams from the first Step (sorted by name for stable result),
+	// since every Step in the map has Upstreams in the map, the walk must revisit a Step.
+	byName := func(steps []Steper) []Steper {
+		steps = slices.Clone(steps)
+		sort.SliceStable(steps, func(i, j int) bool { return String(steps[i]) < String(steps[j]) })
+		return steps
+	}
+	steps := []Steper{}
+	for step := range e {
+		steps = append(steps, step)
+	}
+	step := byName(steps)[0]
+	visited := make(map[Steper]int) // Step -> index in path
+	path := []Steper{}
+	for {
+		if i, ok := visited[step]; ok {
+			cycle := append(path[i:], step)
+			slices.Reverse(cycle) // from Upstream to Downstream
+			return cycle
+		}
+		visited[step] = len(path)
+		path = append(path, step)
+		ups := e[step]
+		if len(ups) == 0 {
+			return nil
+		}
+		step = byName(ups)[0]
+	}
+}
+
 func (e ErrCycleDependency) Error() string {
 	var builder strings.Builder
 	builder.WriteString("Cycle Dependency Error:")
@@ -153,10 +298,231 @@ func (e ErrCycleDependency) Error() string {
 			String(step), strings.Join(depsStr, ", "),
 		))
 	}
+	if cycle := e.Cycle(); len(cycle) > 0 {
+		names := []string{}
+		for _, step := range cycle {
+			names = append(names, String(step))
+		}
+		builder.WriteString("\nCycle: " + strings.Join(names, " -> "))
+	}
+	return builder.String()
+}
+
+// ErrDeadlock is returned by Do if the Workflow would never progress,
+// that no Step is running, but some Steps are not terminated, it indicates a logic bug.
+//
+// Keys are the stuck Steps, values are their non-terminated Upstreams.
+type ErrDeadlock map[Steper][]Steper
+
+func (e ErrDeadlock) Error() string {
+	lines := []string{}
+	for step, ups := range e {
+		upsStr := []string{}
+		for _, up := range ups {
+			upsStr = append(upsStr, String(up))
+		}
+		sort.Strings(upsStr)
+		lines = append(lines, fmt.Sprintf("%s: [%s]", String(step), strings.Join(upsStr, ", ")))
+	}
+	sort.Strings(lines)
+	return "Deadlock, Steps are stuck with pending Upstreams:\n" + strings.Join(lines, "\n")
+}
+
+// ErrAddDependency is returned by AddDependency if the dependency is refused.
+type ErrAddDependency struct {
+	Step, Before Steper
+	Reason       string
+}
+
+func (e ErrAddDependency) Error() string {
+	return fmt.Sprintf("can't add %s before %s: %s", String(e.Step), String(e.Before), e.Reason)
+}
+
+// ErrUnreachable maps the Steps can never become runnable to the reasons, see Workflow.Unreachable.
+type ErrUnreachable map[Steper]string
+
+func (e ErrUnreachable) Error() string {
+	lines := make([]string, 0, len(e))
+	for step, reason := range e {
+		lines = append(lines, fmt.Sprintf("%s: %s", String(step), reason))
+	}
+	sort.Strings(lines)
+	return "Unreachable Steps:\n" + strings.Join(lines, "\n")
+}
+
+// Steps depend on ids not registered in Workflow, see DependsOnID.
+type ErrUnresolvedID map[Steper][]string
+
+func (e ErrUnresolvedID) Error() string {
+	var builder strings.Builder
+	builder.WriteString("Unresolved Step ID:")
+	for step, ids := range e {
+		sort.Strings(ids)
+		builder.WriteRune('\n')
+		builder.WriteString(fmt.Sprintf(
+			"%s: [%s]",
+			String(step), strings.Join(ids, ", "),
+		))
+	}
+	return builder.String()
+}
+
+// ErrUnknownTarget is returned by Targets and RunTargets with the ids not registered in Workflow.
+type ErrUnknownTarget []string
+
+func (e ErrUnknownTarget) Error() string {
+	return fmt.Sprintf("unknown targets: [%s]", strings.Join(e, ", "))
+}
+
+// Steps read keys from the Store that are not written by their Upstreams, see InputFromStore.
+type ErrStoreKeyNotWritten map[Steper][]string
+
+func (e ErrStoreKeyNotWritten) Error() string {
+	var builder strings.Builder
+	builder.WriteString("Store key not written by Upstreams:")
+	for step, keys := range e {
+		sort.Strings(keys)
+		builder.WriteRune('\n')
+		builder.WriteString(fmt.Sprintf(
+			"%s: [%s]",
+			String(step), strings.Join(keys, ", "),
+		))
+	}
 	return builder.String()
 }
 
+// ErrCancelCause wraps the error of a canceled Step with the cause of cancellation.
+//
+// The cause explains why the Step is canceled, i.e.
+//   - ErrStepTimeout, the Step exceeds its Timeout
+//   - the cause passed to CancelStep
+//   - the cause of the context passed to Workflow.Do, see context.WithCancelCause
+type ErrCancelCause struct {
+	Err   error
+	Cause error
+}
+
+func (e ErrCancelCause) Error() string   { return fmt.Sprintf("%s: %s", e.Err, e.Cause) }
+func (e ErrCancelCause) Unwrap() []error { return []error{e.Err, e.Cause} }
+
+// ErrAbort is the error of the Step calling Abort, it's also the cause of the canceled Workflow.
+type ErrAbort struct {
+	Step Steper // the Step calling Abort
+	Err  error  // the error passed to Abort
+}
+
+func (e ErrAbort) Error() string {
+	return fmt.Sprintf("Workflow aborted by Step %s: %s", String(e.Step), e.Err)
+}
+func (e ErrAbort) Unwrap() error { return e.Err }
+
+// ErrFailFast is returned by Do if the Workflow is canceled due to a Failed Step, see WithFailFast and AddSteps.Critical.
+//
+// It's also the cause of the canceled Workflow, so the Steps Canceled by it have it attached (see ErrCancelCause).
+type ErrFailFast struct {
+	Step  Steper      // the Failed Step triggered fail fast
+	Cause error       // the error of the Failed Step
+	Steps ErrWorkflow // all the Steps not Succeeded, including the Canceled ones, only set in the error returned by Do
+}
+
+func (e ErrFailFast) Error() string {
+	return fmt.Sprintf("fail fast: %s failed: %s", String(e.Step), e.Cause)
+}
+func (e ErrFailFast) Unwrap() []error { return []error{e.Cause, e.Steps} }
+
+// Canceled returns the Steps Canceled, i.e. the cascade of fail fast.
+func (e ErrFailFast) Canceled() []Steper {
+	canceled := []Steper{}
+	for step, serr := range e.Steps {
+		if serr.Status == Canceled {
+			canceled = append(canceled, step)
+		}
+	}
+	return canceled
+}
+
+// ErrLeaseTimeout is the error of a Step that could not acquire a concurrency slot in time, see WithLeaseTimeout.
+type ErrLeaseTimeout struct{ Timeout time.Duration }
+
+func (e ErrLeaseTimeout) Error() string {
+	return fmt.Sprintf("could not acquire concurrency slot within %s", e.Timeout)
+}
+
+// ErrCancelGracePeriod is the cause of a canceled Step not returning within the grace period, see WithCancelGracePeriod.
+type ErrCancelGracePeriod struct{ GracePeriod time.Duration }
+
+func (e ErrCancelGracePeriod) Error() string {
+	return fmt.Sprintf("step didn't return within cancel grace period %s", e.GracePeriod)
+}
+
+// ErrMaxCost is the error of a Step Canceled since the total cost would exceed the max, see WithMaxCost.
+type ErrMaxCost struct {
+	MaxCost float64 // the max total cost
+	Cost    float64 // the total cost if the Step started
+}
+
+func (e ErrMaxCost) Error() string {
+	return fmt.Sprintf("total cost %g would exceed max cost %g", e.Cost, e.MaxCost)
+}
+
+// ErrTypeMismatch is the error when the value fed to the Input of a Step is not of the expected type,
+// i.e. from InputFromStore or SetInput, it's wrapped in ErrInput.
+type ErrTypeMismatch struct {
+	Step     Steper       // the Step of the Input
+	Expected reflect.Type // the type of the Input, nil means the Step is not a Function, which has no Input
+	Got      reflect.Type // the type of the value, nil means the value is nil
+}
+
+func (e ErrTypeMismatch) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("%s has no Input, got %v", String(e.Step), e.Got)
+	}
+	return fmt.Sprintf("Input of %s expects %s, got %v", String(e.Step), e.Expected, e.Got)
+}
+
+// ErrPhaseTimeout is the cause when Steps are canceled due to the timeout of their phase, see WithPhaseTimeout.
+type ErrPhaseTimeout struct {
+	Phase   Phase
+	Timeout time.Duration
+}
+
+func (e ErrPhaseTimeout) Error() string {
+	return fmt.Sprintf("phase %s timeout %s exceeded", e.Phase, e.Timeout)
+}
+
+// ErrWorkflowTimeout is the cause when the Workflow is canceled since it's not finished in time, see DoWithin.
+type ErrWorkflowTimeout struct{ Timeout time.Duration }
+
+func (e ErrWorkflowTimeout) Error() string {
+	return fmt.Sprintf("workflow not finished within %s", e.Timeout)
+}
+
+// ErrPhaseAborted is the cause when the Workflow is canceled due to failures before the phase, see WithPhaseOnFailure.
+type ErrPhaseAborted struct{ Phase Phase }
+
+func (e ErrPhaseAborted) Error() string {
+	return fmt.Sprintf("phase %s aborted since previous phases failed", e.Phase)
+}
+
+// ErrAfterPhase is the cause when the remaining phases are aborted by the callback, see WithAfterPhase.
+type ErrAfterPhase struct {
+	Phase Phase
+	Err   error
+}
+
+func (e ErrAfterPhase) Error() string {
+	return fmt.Sprintf("aborted after phase %s: %s", e.Phase, e.Err)
+}
+func (e ErrAfterPhase) Unwrap() error { return e.Err }
+
+// ErrStepTimeout is the cause when a Step is canceled due to its Timeout.
+type ErrStepTimeout struct{ Timeout time.Duration }
+
+func (e ErrStepTimeout) Error() string { return fmt.Sprintf("Step timeout %s exceeded", e.Timeout) }
+
 type ErrPanic struct{ Err error }
+
+// ErrInput wraps the error from Input callbacks of a Step, i.e. ErrTypeMismatch.
 type ErrInput struct{ Err error }
 
 func (e ErrPanic) Error() string { return e.Err.Error() }
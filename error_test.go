@@ -1,8 +1,10 @@
 package flow
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -55,6 +57,63 @@ func TestErrWorkflow(t *testing.T) {
 	assert.Equal(t, `{"*flow.fakeStep(\u0026{})":{"status":"Failed","error":"mock err random msg"}}`, string(j))
 }
 
+func TestErrWorkflowSorted(t *testing.T) {
+	errWorkflow := ErrWorkflow{
+		&fakeStep{Name: "c"}: {Status: Failed, Err: errors.New("c failed")},
+		&fakeStep{Name: "a"}: {Status: Succeeded},
+		&fakeStep{Name: "b"}: {Status: Canceled, Err: errors.New("b canceled")},
+	}
+	expected := "*flow.fakeStep(&{a}): [Succeeded]\n" +
+		"*flow.fakeStep(&{b}): [Canceled]\n\tb canceled\n" +
+		"*flow.fakeStep(&{c}): [Failed]\n\tc failed\n"
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expected, errWorkflow.Error())
+	}
+}
+
+func TestErrWorkflowSummary(t *testing.T) {
+	a, b := &fakeStep{Name: "a"}, &fakeStep{Name: "b"}
+	errWorkflow := ErrWorkflow{
+		a:                    {Status: Failed, Err: errors.New("a failed")},
+		b:                    {Status: Failed, Err: errors.New("b failed")},
+		&fakeStep{Name: "c"}: {Status: Succeeded},
+		&fakeStep{Name: "d"}: {Status: Succeeded},
+		&fakeStep{Name: "e"}: {Status: Canceled, Err: context.Canceled},
+	}
+	summary := errWorkflow.Summary()
+	assert.Equal(t, map[StepStatus]int{Failed: 2, Succeeded: 2, Canceled: 1}, summary.Counts)
+	assert.True(t, summary.Canceled)
+	assert.Equal(t, a, summary.Step)
+	assert.EqualError(t, summary.Err, "a failed")
+	assert.Equal(t, "2 Succeeded, 2 Failed (*flow.fakeStep(&{a})), 1 Canceled", summary.String())
+
+	t.Run("no failure", func(t *testing.T) {
+		summary := ErrWorkflow{a: {Status: Canceled, Err: context.Canceled}}.Summary()
+		assert.True(t, summary.Canceled)
+		assert.Nil(t, summary.Step)
+		assert.NoError(t, summary.Err)
+		assert.Equal(t, "1 Canceled", summary.String())
+	})
+	t.Run("first terminated in run", func(t *testing.T) {
+		early := Func("z", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		late := Func("a", func(ctx context.Context) error {
+			time.Sleep(20 * time.Millisecond)
+			return errors.New("a failed")
+		})
+		workflow := new(Workflow).Add(Step(early).Timeout(time.Millisecond), Step(late))
+		var errWorkflow ErrWorkflow
+		if assert.ErrorAs(t, workflow.Do(context.Background()), &errWorkflow) {
+			summary := errWorkflow.Summary()
+			assert.Equal(t, early, summary.Step, "terminated first, though named after a")
+			assert.ErrorIs(t, summary.Err, context.DeadlineExceeded)
+			assert.Equal(t, "1 Failed, 1 TimedOut (z)", summary.String())
+		}
+	})
+}
+
 func TestErrUnexpectStepInitStatus(t *testing.T) {
 	errUnexpectStepInitStatus := ErrUnexpectStepInitStatus{
 		&fakeStep{}: Failed,
@@ -69,4 +128,23 @@ func TestErrCycleDependency(t *testing.T) {
 		},
 	}
 	assert.Equal(t, "Cycle Dependency Error:\n*flow.fakeStep(&{step2}): [*flow.fakeStep(&{step1})]", errCycleDependency.Error())
+	assert.Nil(t, errCycleDependency.Cycle(), "step1 is not in the map")
+}
+
+func TestErrCycleDependencyCycle(t *testing.T) {
+	a, b, c, d := &fakeStep{Name: "a"}, &fakeStep{Name: "b"}, &fakeStep{Name: "c"}, &fakeStep{Name: "d"}
+	// b -> c -> b is a cycle, a depends on it
+	e := ErrCycleDependency{
+		a: {d, b},
+		b: {c},
+		c: {b},
+	}
+	assert.Equal(t, []Steper{b, c, b}, e.Cycle())
+	// a -> d -> a
+	e = ErrCycleDependency{
+		a: {d},
+		d: {a},
+	}
+	assert.Equal(t, []Steper{a, d, a}, e.Cycle())
+	assert.Nil(t, ErrCycleDependency{}.Cycle())
 }
@@ -51,7 +51,7 @@ func ExampleTimeout() {
 	// Step level timeout is checked after retry returned.
 	// |---------|----|----|
 	// 0         1   1.5   2
-	// done      done canceled
+	// done      done timed out
 
 	var err error
 	var wg sync.WaitGroup
@@ -72,8 +72,8 @@ func ExampleTimeout() {
 	// Output:
 	// done
 	// done
-	// WaitDone: [Canceled]
-	//	context deadline exceeded
+	// WaitDone: [TimedOut]
+	//	context deadline exceeded: Step timeout 1.5s exceeded
 }
 
 // testTimer is a Timer that all retry intervals are immediate (0).
@@ -2,6 +2,13 @@ package flow
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Func constructs a Step from an arbitrary function
@@ -25,6 +32,63 @@ func FuncO[O any](name string, do func(context.Context) (O, error)) *Function[st
 	})
 }
 
+// AddFunc adds a Step from the function into Workflow in phase Main, it's a shortcut of
+//
+//	workflow.Add(Step(Func(name, do)))
+//
+// It returns a StepBuilder to configure the added Step fluently.
+//
+//	build := workflow.AddFunc("build", func(ctx context.Context) error { ... })
+//	workflow.AddFunc("test", func(ctx context.Context) error { ... }).DependsOn(build.Step()).Timeout(time.Minute)
+func (w *Workflow) AddFunc(name string, do func(context.Context) error) *StepBuilder {
+	b := &StepBuilder{workflow: w, phase: PhaseMain, step: Func(name, do)}
+	w.PhaseAdd(b.phase, b)
+	return b
+}
+
+// StepBuilder configures a Step already added into Workflow, see Workflow.AddFunc.
+//
+// Each method adds the config into Workflow immediately, it's the same as adding the Step with the config again.
+// StepBuilder is also a WorkflowAdder, to add the Step into other Workflows.
+type StepBuilder struct {
+	workflow *Workflow
+	phase    Phase
+	step     Steper
+}
+
+// Step returns the added Step, i.e. to be depended on by other Steps.
+func (b *StepBuilder) Step() Steper { return b.step }
+
+func (b *StepBuilder) Done() map[Steper]*StepConfig { return Steps(b.step).Done() }
+
+// With configures the Step by AddSteps methods, for the ones without shortcuts in StepBuilder.
+//
+//	workflow.AddFunc("deploy", deploy).With(func(as AddSteps) AddSteps { return as.Optional() })
+func (b *StepBuilder) With(configure func(AddSteps) AddSteps) *StepBuilder {
+	b.workflow.PhaseAdd(b.phase, configure(Steps(b.step)))
+	return b
+}
+
+// DependsOn declares the Upstreams of the Step, see AddSteps.DependsOn.
+func (b *StepBuilder) DependsOn(ups ...Steper) *StepBuilder {
+	return b.With(func(as AddSteps) AddSteps { return as.DependsOn(ups...) })
+}
+
+// Timeout sets the Step level timeout, see AddSteps.Timeout.
+func (b *StepBuilder) Timeout(timeout time.Duration) *StepBuilder {
+	return b.With(func(as AddSteps) AddSteps { return as.Timeout(timeout) })
+}
+
+// Retry customizes how the Step should be retried, see AddSteps.Retry.
+func (b *StepBuilder) Retry(opts ...func(*RetryOption)) *StepBuilder {
+	return b.With(func(as AddSteps) AddSteps { return as.Retry(opts...) })
+}
+
+// When sets the Condition of the Step, see AddSteps.When.
+func (b *StepBuilder) When(cond Condition) *StepBuilder {
+	return b.With(func(as AddSteps) AddSteps { return as.When(cond) })
+}
+
 // Function wraps an arbitrary function as a Step.
 type Function[I, O any] struct {
 	Name   string
@@ -33,7 +97,32 @@ type Function[I, O any] struct {
 	DoFunc func(context.Context, I) (O, error)
 }
 
+// Outputer is a Step with Output, see Collect.
+type Outputer[O any] interface {
+	Steper
+	GetOutput() O
+}
+
+// Output returns the Output of the Step, if the Step Succeeded in the Workflow.
+//
+// Outputs are kept after Do, even if Do returns error,
+// so it's useful to build a partial report from Succeeded Steps.
+//
+//	err := workflow.Do(ctx)
+//	if answer, ok := Output(workflow, answerStep); ok {
+//		// answerStep Succeeded, even if err != nil
+//	}
+func Output[O any](w *Workflow, step Outputer[O]) (O, bool) {
+	var zero O
+	state := w.StateOf(step)
+	if state == nil || state.GetStatus() != Succeeded {
+		return zero, false
+	}
+	return step.GetOutput(), true
+}
+
 func (f *Function[I, O]) String() string { return f.Name }
+func (f *Function[I, O]) GetOutput() O   { return f.Output }
 func (f *Function[I, O]) Do(ctx context.Context) error {
 	var err error
 	if f.DoFunc != nil {
@@ -41,3 +130,123 @@ func (f *Function[I, O]) Do(ctx context.Context) error {
 	}
 	return err
 }
+
+// MarshalState saves the Output as JSON, see StateMarshaler.
+func (f *Function[I, O]) MarshalState() ([]byte, error) { return json.Marshal(f.Output) }
+
+// UnmarshalState restores the Output from JSON, see StateMarshaler.
+func (f *Function[I, O]) UnmarshalState(data []byte) error { return json.Unmarshal(data, &f.Output) }
+
+// typedFunction is implemented by Function, it allows wiring Functions by their Input and Output types, see AutoWire.
+type typedFunction interface {
+	Steper
+	inputType() reflect.Type
+	outputType() reflect.Type
+	getOutput() any
+	setOutput(any) bool
+	setInput(any) error
+}
+
+func (f *Function[I, O]) inputType() reflect.Type  { return reflect.TypeOf((*I)(nil)).Elem() }
+func (f *Function[I, O]) outputType() reflect.Type { return reflect.TypeOf((*O)(nil)).Elem() }
+func (f *Function[I, O]) getOutput() any           { return f.Output }
+func (f *Function[I, O]) setOutput(v any) bool {
+	o, ok := v.(O)
+	if ok {
+		f.Output = o
+	}
+	return ok
+}
+func (f *Function[I, O]) setInput(v any) error {
+	if v == nil {
+		var zero I
+		f.Input = zero
+		return nil
+	}
+	if got := reflect.TypeOf(v); !got.AssignableTo(f.inputType()) {
+		return ErrTypeMismatch{Step: f, Expected: f.inputType(), Got: got}
+	}
+	reflect.ValueOf(&f.Input).Elem().Set(reflect.ValueOf(v))
+	return nil
+}
+
+// SetInput feeds v to the Input of the Function in step (see As), for adapters deciding the Input at runtime,
+// i.e. the Downstream is declared as an interface.
+//
+//	Step[Steper](down).InputDependsOn(
+//		Adapt2(a, b, func(_ context.Context, a *A, b *B, d Steper) error {
+//			return flow.SetInput(d, merge(a.Output, b.Output))
+//		}),
+//	)
+//
+// It returns ErrTypeMismatch if step is not a Function, or v is not assignable to its Input,
+// the same check as AutoWire and InputFromStore.
+func SetInput(step Steper, v any) error {
+	fs := As[typedFunction](step)
+	if len(fs) == 0 {
+		return ErrTypeMismatch{Step: step, Got: reflect.TypeOf(v)}
+	}
+	return fs[0].setInput(v)
+}
+
+// AutoWire infers data dependencies among Functions by matching Output types to Input types,
+// then wires them like InputDependsOn, the Output of the producer is fed to the Input of the consumer.
+//
+//	parse := FuncIO("parse", func(ctx context.Context, raw []byte) (Config, error) { ... })
+//	fetch := FuncO("fetch", func(ctx context.Context) ([]byte, error) { ... })
+//	apply := FuncI("apply", func(ctx context.Context, c Config) error { ... })
+//	wired, err := AutoWire(fetch, parse, apply) // fetch -> parse -> apply
+//	workflow.Add(wired)
+//
+// A Function's Output is the same type as another Function's Input makes them a producer and a consumer,
+// only if there is no such producer, the Functions with Output assignable to the Input (i.e. implementing the interface) are producers.
+// Input and Output of struct{} are ignored, i.e. Func has neither Input nor Output.
+// AutoWire returns error if a consumer has more than one producer, which is ambiguous, wire it manually instead.
+// Consumers without producer, and Steps that are not Functions, are added without dependency.
+func AutoWire(steps ...Steper) (WorkflowAdder, error) {
+	none := reflect.TypeOf(struct{}{})
+	as := Steps(steps...)
+	for _, step := range steps {
+		consumer, ok := step.(typedFunction)
+		if !ok || consumer.inputType() == none {
+			continue
+		}
+		var exact, assignable []typedFunction
+		for _, up := range steps {
+			producer, ok := up.(typedFunction)
+			if !ok || up == step || producer.outputType() == none ||
+				slices.Contains(exact, producer) || slices.Contains(assignable, producer) {
+				continue
+			}
+			switch output := producer.outputType(); {
+			case output == consumer.inputType():
+				exact = append(exact, producer)
+			case output.AssignableTo(consumer.inputType()):
+				assignable = append(assignable, producer)
+			}
+		}
+		producers := exact
+		if len(producers) == 0 {
+			producers = assignable
+		}
+		switch len(producers) {
+		case 0:
+			continue
+		case 1:
+		default:
+			names := []string{}
+			for _, producer := range producers {
+				names = append(names, String(producer))
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("ambiguous producers of Step %s with Input %s: [%s]",
+				String(step), consumer.inputType(), strings.Join(names, ", "))
+		}
+		producer := producers[0]
+		as[step].Upstreams.Add(producer)
+		as[step].AddInput(func(ctx context.Context) error {
+			return consumer.setInput(producer.getOutput())
+		})
+	}
+	return as, nil
+}
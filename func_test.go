@@ -0,0 +1,116 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialOutput(t *testing.T) {
+	early := FuncO("early", func(ctx context.Context) (int, error) { return 42, nil })
+	late := FuncIO("late", func(ctx context.Context, i int) (int, error) { return i, fmt.Errorf("late failed") })
+	skipped := FuncO("skipped", func(ctx context.Context) (string, error) { return "never", nil })
+	workflow := new(Workflow)
+	workflow.Add(
+		Step(late).InputDependsOn(Adapt(early, func(_ context.Context, e *Function[struct{}, int], l *Function[int, int]) error {
+			l.Input = e.Output
+			return nil
+		})),
+		Step(skipped).DependsOn(late),
+	)
+	assert.Error(t, workflow.Do(context.Background()))
+	answer, ok := Output[int](workflow, early)
+	assert.True(t, ok)
+	assert.Equal(t, 42, answer)
+	_, ok = Output[int](workflow, late)
+	assert.False(t, ok)
+	_, ok = Output[string](workflow, skipped)
+	assert.False(t, ok)
+	_, ok = Output[int](workflow, FuncO("absent", func(ctx context.Context) (int, error) { return 0, nil }))
+	assert.False(t, ok)
+}
+
+func TestAutoWire(t *testing.T) {
+	type config struct{ replicas int }
+	t.Run("wire by types", func(t *testing.T) {
+		fetch := FuncO("fetch", func(ctx context.Context) (string, error) { return "3", nil })
+		parse := FuncIO("parse", func(ctx context.Context, raw string) (config, error) {
+			n, err := strconv.Atoi(raw)
+			return config{replicas: n}, err
+		})
+		var applied config
+		apply := FuncI("apply", func(ctx context.Context, c config) error {
+			applied = c
+			return nil
+		})
+		independent := noopStep("independent")
+		wired, err := AutoWire(apply, parse, fetch, independent)
+		if !assert.NoError(t, err) {
+			return
+		}
+		workflow := new(Workflow).Add(wired)
+		assert.ElementsMatch(t, []Steper{parse}, keys(workflow.UpstreamOf(apply)))
+		assert.ElementsMatch(t, []Steper{fetch}, keys(workflow.UpstreamOf(parse)))
+		assert.Empty(t, workflow.UpstreamOf(independent))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, config{replicas: 3}, applied)
+	})
+	t.Run("ambiguous", func(t *testing.T) {
+		a := FuncO("a", func(ctx context.Context) (int, error) { return 1, nil })
+		b := FuncO("b", func(ctx context.Context) (int, error) { return 2, nil })
+		sum := FuncI("sum", func(ctx context.Context, i int) error { return nil })
+		_, err := AutoWire(a, b, sum)
+		assert.EqualError(t, err, "ambiguous producers of Step sum with Input int: [a, b]")
+	})
+	t.Run("prefer exact type", func(t *testing.T) {
+		exact := FuncO("exact", func(ctx context.Context) (fmt.Stringer, error) { return time.Second, nil })
+		assignable := FuncO("assignable", func(ctx context.Context) (time.Duration, error) { return time.Minute, nil })
+		var got fmt.Stringer
+		print := FuncI("print", func(ctx context.Context, s fmt.Stringer) error {
+			got = s
+			return nil
+		})
+		wired, err := AutoWire(assignable, exact, print)
+		if !assert.NoError(t, err) {
+			return
+		}
+		workflow := new(Workflow).Add(wired)
+		assert.ElementsMatch(t, []Steper{exact}, keys(workflow.UpstreamOf(print)))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, time.Second, got)
+
+		wired, err = AutoWire(assignable, print)
+		if assert.NoError(t, err) {
+			workflow := new(Workflow).Add(wired)
+			assert.ElementsMatch(t, []Steper{assignable}, keys(workflow.UpstreamOf(print)), "fall back to assignable")
+		}
+	})
+}
+
+func TestAddFunc(t *testing.T) {
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	workflow := new(Workflow)
+	build := workflow.AddFunc("build", record("build"))
+	test := workflow.AddFunc("test", record("test")).DependsOn(build.Step()).Timeout(time.Minute)
+	workflow.AddFunc("deploy", record("deploy")).
+		DependsOn(test.Step()).
+		With(func(as AddSteps) AddSteps { return as.Optional() })
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, []string{"build", "test", "deploy"}, order)
+	assert.Equal(t, PhaseMain, workflow.PhaseOf(test.Step()))
+	assert.Equal(t, time.Minute, *workflow.StateOf(test.Step()).Option().Timeout)
+
+	// StepBuilder is a WorkflowAdder
+	other := new(Workflow).Add(build)
+	assert.NotNil(t, other.StateOf(build.Step()))
+}
@@ -0,0 +1,55 @@
+package flow
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Heartbeat reports that the Step is alive, the Step should call it from its Do with the context passed in.
+//
+// Workflow regards a Running Step as alive since it started, each Heartbeat refreshes it.
+// A Step without Timeout could report Heartbeat periodically, so a hung one could be found by StalledSteps.
+//
+//	Func("sync", func(ctx context.Context) error {
+//		for _, item := range items {
+//			flow.Heartbeat(ctx)
+//			...
+//		}
+//	})
+//
+// Heartbeat of a Step in nested Workflow refreshes the Steps wrapping it in the outer Workflows as well.
+// Heartbeat is a no-op if ctx is not from a running Workflow.
+func Heartbeat(ctx context.Context) {
+	for sc := stepContextFrom(ctx); sc != nil; sc = sc.parent {
+		if state := sc.workflow.StateOf(sc.step); state != nil {
+			state.heartbeat(sc.workflow.clock.Now())
+		}
+	}
+}
+
+// StalledSteps returns the Running root Steps without Heartbeat within the threshold,
+// the longest silent Step comes first.
+//
+// It's useful for dashboards to flag the hung Steps, without forcing a hard Timeout.
+func (w *Workflow) StalledSteps(threshold time.Duration) []Steper {
+	w.topology.RLock()
+	defer w.topology.RUnlock()
+	if w.empty() || w.clock == nil {
+		return nil
+	}
+	now := w.clock.Now()
+	var stalled []Steper
+	lastBeat := make(map[Steper]time.Time)
+	for step, state := range w.state {
+		if state.GetStatus() != Running {
+			continue
+		}
+		if beat := state.getLastBeat(); !beat.IsZero() && now.Sub(beat) >= threshold {
+			stalled = append(stalled, step)
+			lastBeat[step] = beat
+		}
+	}
+	slices.SortFunc(stalled, func(a, b Steper) int { return lastBeat[a].Compare(lastBeat[b]) })
+	return stalled
+}
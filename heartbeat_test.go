@@ -0,0 +1,53 @@
+package flow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	Heartbeat(context.Background()) // no-op outside Workflow
+
+	mock := clock.NewMock()
+	release, beat, beaten := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	silent := Func("silent", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	beating := Func("beating", func(ctx context.Context) error {
+		for {
+			select {
+			case <-beat:
+				Heartbeat(ctx)
+				beaten <- struct{}{}
+			case <-release:
+				return nil
+			}
+		}
+	})
+	inner := new(Workflow).Options(WithClock(mock)).Add(Step(beating))
+	workflow := new(Workflow).Options(WithClock(mock)).Add(Steps(silent, inner))
+	done := make(chan error)
+	go func() { done <- workflow.Do(context.Background()) }()
+	assert.Eventually(t, func() bool {
+		return inner.StateOf(beating).getLastBeat().Equal(mock.Now()) &&
+			workflow.StateOf(silent).getLastBeat().Equal(mock.Now())
+	}, time.Second, time.Millisecond)
+
+	mock.Add(5 * time.Minute)
+	beat <- struct{}{}
+	<-beaten
+	mock.Add(5 * time.Minute)
+	assert.Equal(t, []Steper{silent}, workflow.StalledSteps(10*time.Minute))
+	assert.Equal(t, []Steper{silent, inner}, workflow.StalledSteps(time.Minute), "the longest silent Step comes first")
+	assert.Equal(t, []Steper{beating}, inner.StalledSteps(time.Minute))
+	assert.Empty(t, workflow.StalledSteps(time.Hour))
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Empty(t, workflow.StalledSteps(0), "only Running Steps could be stalled")
+}
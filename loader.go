@@ -0,0 +1,82 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Definition is the document loaded by LoadYAML.
+//
+//	steps:
+//	  - name: fetch
+//	    type: shell
+//	    spec:
+//	      command: git clone ...
+//	  - name: build
+//	    type: shell
+//	    depends_on: [fetch]
+//	    spec:
+//	      command: make
+type Definition struct {
+	Steps []StepDefinition `yaml:"steps" json:"steps"`
+}
+
+// StepDefinition is a Step in Definition.
+type StepDefinition struct {
+	Name      string    `yaml:"name" json:"name"`             // Name is the unique name of the Step, it's also the id (see Workflow.Register)
+	Type      string    `yaml:"type" json:"type"`             // Type is the key to the constructor in registry
+	DependsOn []string  `yaml:"depends_on" json:"depends_on"` // DependsOn are names of Upstreams
+	Spec      yaml.Node `yaml:"spec" json:"-"`                // Spec is decoded into the constructed Step
+}
+
+// LoadYAML constructs a Workflow from a YAML (or JSON, which is a subset of YAML) document, see Definition.
+//
+// The registry maps Step types to constructors, the constructed Step is
+//   - decoded from spec, so make the constructor return a pointer with yaml tags,
+//   - named by name (see WithName),
+//   - registered by name (see Workflow.Register), so it can be depended on by depends_on.
+//
+// LoadYAML validates that names are unique, types are in the registry, and depends_on refer to defined Steps.
+//
+//	workflow, err := LoadYAML(file, map[string]func() Steper{
+//		"shell": func() Steper { return new(Shell) },
+//	})
+func LoadYAML(reader io.Reader, registry map[string]func() Steper) (*Workflow, error) {
+	var def Definition
+	if err := yaml.NewDecoder(reader).Decode(&def); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("decode workflow definition: %w", err)
+	}
+	names := make(Set[string])
+	for _, sd := range def.Steps {
+		switch {
+		case sd.Name == "":
+			return nil, fmt.Errorf("step of type %q has no name", sd.Type)
+		case names.Has(sd.Name):
+			return nil, fmt.Errorf("duplicate step name %q", sd.Name)
+		case registry[sd.Type] == nil:
+			return nil, fmt.Errorf("step %q has unknown type %q", sd.Name, sd.Type)
+		}
+		names.Add(sd.Name)
+	}
+	w := new(Workflow)
+	for _, sd := range def.Steps {
+		for _, up := range sd.DependsOn {
+			if !names.Has(up) {
+				return nil, fmt.Errorf("step %q depends on undefined step %q", sd.Name, up)
+			}
+		}
+		step := registry[sd.Type]()
+		if sd.Spec.Kind != 0 {
+			if err := sd.Spec.Decode(step); err != nil {
+				return nil, fmt.Errorf("decode spec of step %q: %w", sd.Name, err)
+			}
+		}
+		named := WithName(sd.Name, step)
+		w.Register(sd.Name, named)
+		w.Add(Step(named).DependsOnID(sd.DependsOn...))
+	}
+	return w, nil
+}
@@ -0,0 +1,72 @@
+package flow
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type echo struct {
+	Message string `yaml:"message"`
+	record  func(string)
+}
+
+func (e *echo) Do(context.Context) error {
+	e.record(e.Message)
+	return nil
+}
+
+func TestLoadYAML(t *testing.T) {
+	var mu sync.Mutex
+	var messages []string
+	registry := map[string]func() Steper{
+		"echo": func() Steper {
+			return &echo{record: func(msg string) {
+				mu.Lock()
+				defer mu.Unlock()
+				messages = append(messages, msg)
+			}}
+		},
+	}
+	t.Run("load and run", func(t *testing.T) {
+		workflow, err := LoadYAML(strings.NewReader(`
+steps:
+  - name: second
+    type: echo
+    depends_on: [first]
+    spec:
+      message: world
+  - name: first
+    type: echo
+    spec:
+      message: hello
+`), registry)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Len(t, workflow.Steps(), 2)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []string{"hello", "world"}, messages)
+	})
+	t.Run("json", func(t *testing.T) {
+		workflow, err := LoadYAML(strings.NewReader(`{"steps": [{"name": "a", "type": "echo"}]}`), registry)
+		assert.NoError(t, err)
+		assert.Len(t, workflow.Steps(), 1)
+	})
+	for name, doc := range map[string]string{
+		"unknown type":     "steps: [{name: a, type: unknown}]",
+		"undefined step":   "steps: [{name: a, type: echo, depends_on: [b]}]",
+		"duplicate name":   "steps: [{name: a, type: echo}, {name: a, type: echo}]",
+		"no name":          "steps: [{type: echo}]",
+		"invalid spec":     "steps: [{name: a, type: echo, spec: [1, 2]}]",
+		"invalid document": "steps: {",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadYAML(strings.NewReader(doc), registry)
+			assert.Error(t, err)
+		})
+	}
+}
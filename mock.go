@@ -1,6 +1,9 @@
 package flow
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // MockStep helps to mock a step.
 // After building a workflow, you can mock the original step with a mock step.
@@ -11,3 +14,48 @@ type MockStep struct {
 
 func (m *MockStep) Unwrap() Steper               { return m.Step }
 func (m *MockStep) Do(ctx context.Context) error { return m.MockDo(ctx) }
+
+// FaultInjector decides the fault induced before the Step's Do, see WithFaultInjector.
+type FaultInjector func(step Steper) (delay time.Duration, err error)
+
+// WithFaultInjector induces faults into Steps for chaos testing, FOR TESTING ONLY, never use it in production.
+//
+// The injector is called before each attempt of the Step's Do (after Input, see Retry),
+//   - a positive delay postpones Do, waited with the Workflow's clock (see WithClock) and canceled with the Step's context,
+//   - a non-nil err fails the attempt without calling Do, the err is classified as usual (see WithStatusMapper).
+//
+// It's useful to verify Conditions, retries and fail-fast behave under induced faults.
+//
+//	WithFaultInjector(func(step Steper) (time.Duration, error) {
+//		if rand.Intn(10) == 0 {
+//			return 0, errors.New("chaos")
+//		}
+//		return time.Duration(rand.Intn(100)) * time.Millisecond, nil
+//	})
+func WithFaultInjector(injector FaultInjector) WorkflowOption {
+	return func(w *Workflow) {
+		w.faultInjector = injector
+	}
+}
+
+// injectFault induces the fault decided by the FaultInjector before the Step's Do.
+func (w *Workflow) injectFault(ctx context.Context, step Steper) error {
+	if w.faultInjector == nil {
+		return nil
+	}
+	delay, err := w.faultInjector(step)
+	if err != nil {
+		return err
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := w.clock.Timer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
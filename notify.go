@@ -1,9 +1,46 @@
 package flow
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Notify will be called before and after each step being executed.
 type Notify struct {
 	BeforeStep func(ctx context.Context, step Steper) context.Context
 	AfterStep  func(ctx context.Context, step Steper, err error)
 }
+
+// Reporter reports Steps to external systems, i.e. an orchestrator syncing states of Steps, see WithReporter.
+//
+// Steps are reported by stable ids, in the order of StepID (see StepIDer), the id registered by Workflow.Register,
+// and the name of the Step (see WithName), so reports correlate across runs.
+//
+// ReportStart is called when the Step starts running, ReportEnd is called once the Step terminated,
+// be aware that Steps never started (i.e. Skipped or Canceled by Condition) only have ReportEnd.
+// Both are called synchronously when the status changes, maybe from different goroutines,
+// so Reporter should be safe for concurrent use, and keep it fast.
+type Reporter interface {
+	ReportStart(id string, at time.Time)
+	ReportEnd(id string, status StepStatus, err error, at time.Time)
+}
+
+// onResult is called after a Step terminated with its status and error, see OnResult.
+type onResult func(ctx context.Context, se StatusError)
+
+// StepDo is the signature of executing a Step.
+type StepDo func(ctx context.Context, step Steper) error
+
+// StepMiddleware wraps the execution of every Step.
+//
+// Different from Notify, middleware is able to short-circuit, retry or transform the error of the Step.
+//
+//	func(next StepDo) StepDo {
+//		return func(ctx context.Context, step Steper) error {
+//			// before Step
+//			err := next(ctx, step)
+//			// after Step
+//			return err
+//		}
+//	}
+type StepMiddleware func(next StepDo) StepDo
@@ -0,0 +1,118 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// ErrPeriodicStopped is the cause to stop PeriodicStep, when all non-periodic Steps in its phase are terminated.
+var ErrPeriodicStopped = errors.New("periodic step stopped since all other steps are terminated")
+
+// Periodic wraps the Step to run repeatedly on a ticker, i.e. a sidecar monitoring the rest of the Workflow.
+//
+//	workflow.Add(
+//		Step(Periodic(30*time.Second, monitor)),
+//		Pipe(build, test, deploy),
+//	)
+//
+// PeriodicStep runs the Step once it starts, then every interval (ticked by the Workflow's clock, see WithClock),
+// until all non-periodic Steps in the same phase are terminated, then the Workflow stops it,
+// or Skips it if it's not started yet.
+// Failures of the Step don't stop the ticker, they are collected and returned (joined) when stopped,
+// mark the PeriodicStep Optional if its failures shouldn't fail the Workflow.
+func Periodic(interval time.Duration, step Steper) *PeriodicStep {
+	return &PeriodicStep{Steper: step, Interval: interval}
+}
+
+// PeriodicStep runs the inner Step repeatedly, see Periodic.
+type PeriodicStep struct {
+	Steper
+	Interval time.Duration
+
+	mu   sync.Mutex
+	errs []error
+}
+
+func (p *PeriodicStep) Unwrap() Steper { return p.Steper }
+func (p *PeriodicStep) String() string {
+	return fmt.Sprintf("Periodic(%s, %s)", p.Interval, String(p.Steper))
+}
+
+// Errors returns the errors collected from the runs of the inner Step so far.
+func (p *PeriodicStep) Errors() []error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]error(nil), p.errs...)
+}
+
+func (p *PeriodicStep) Do(ctx context.Context) error {
+	p.mu.Lock()
+	p.errs = nil
+	p.mu.Unlock()
+	var clk clock.Clock = clock.New()
+	if sc := stepContextFrom(ctx); sc != nil && sc.workflow.clock != nil {
+		clk = sc.workflow.clock
+	}
+	ticker := clk.Ticker(p.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Steper.Do(ctx); err != nil && ctx.Err() == nil {
+			p.mu.Lock()
+			p.errs = append(p.errs, err)
+			p.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			err := errors.Join(p.Errors()...)
+			if !errors.Is(context.Cause(ctx), ErrPeriodicStopped) {
+				err = errors.Join(ctx.Err(), err) // canceled by others
+			}
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// isPeriodic reports whether the Step is a PeriodicStep, or decorates one.
+func isPeriodic(step Steper) bool {
+	for step != nil {
+		if _, ok := step.(*PeriodicStep); ok {
+			return true
+		}
+		u, ok := step.(interface{ Unwrap() Steper })
+		if !ok {
+			return false
+		}
+		step = u.Unwrap()
+	}
+	return false
+}
+
+// stopPeriodic stops the PeriodicSteps if all the other Steps are terminated,
+// the running ones are canceled with ErrPeriodicStopped, the not started ones are Skipped.
+func (w *Workflow) stopPeriodic(ctx context.Context, steps Set[Steper]) {
+	periodic := []Steper{}
+	for step := range steps {
+		switch {
+		case isPeriodic(step):
+			periodic = append(periodic, step)
+		case !w.StateOf(step).GetStatus().IsTerminated():
+			return
+		}
+	}
+	for _, step := range periodic {
+		state := w.StateOf(step)
+		switch state.GetStatus() {
+		case Pending:
+			w.setStatus(ctx, step, Skipped)
+			w.signalTick()
+		case Running:
+			state.stop(ErrPeriodicStopped)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodic(t *testing.T) {
+	sleep := func(d time.Duration) Steper {
+		return Func("sleep", func(ctx context.Context) error {
+			time.Sleep(d)
+			return nil
+		})
+	}
+	t.Run("run until others terminated", func(t *testing.T) {
+		var count atomic.Int32
+		monitor := Periodic(10*time.Millisecond, Func("monitor", func(ctx context.Context) error {
+			count.Add(1)
+			return nil
+		}))
+		workflow := new(Workflow).Add(Step(monitor), Step(sleep(55*time.Millisecond)))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(monitor).GetStatus())
+		assert.GreaterOrEqual(t, count.Load(), int32(3))
+	})
+	t.Run("failures are collected", func(t *testing.T) {
+		var count atomic.Int32
+		monitor := Periodic(10*time.Millisecond, Func("monitor", func(ctx context.Context) error {
+			if count.Add(1) == 2 {
+				return fmt.Errorf("flaky")
+			}
+			return nil
+		}))
+		workflow := new(Workflow).Add(Step(monitor).Optional(), Step(sleep(55*time.Millisecond)))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, Failed, workflow.StateOf(monitor).GetStatus())
+		assert.ErrorContains(t, workflow.StateOf(monitor).GetError(), "flaky")
+		assert.Len(t, monitor.Errors(), 1)
+	})
+	t.Run("not started is skipped", func(t *testing.T) {
+		first := Periodic(10*time.Millisecond, noopStep("first"))
+		second := Periodic(10*time.Millisecond, noopStep("second"))
+		workflow := new(Workflow).Add(Step(second).DependsOn(first), Step(sleep(20*time.Millisecond)))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(first).GetStatus())
+		assert.Equal(t, Skipped, workflow.StateOf(second).GetStatus())
+	})
+	t.Run("canceled with the Workflow", func(t *testing.T) {
+		monitor := Periodic(10*time.Millisecond, noopStep("monitor"))
+		workflow := new(Workflow).Add(Step(monitor), Step(sleep(100*time.Millisecond)))
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		assert.Error(t, workflow.Do(ctx))
+		assert.Equal(t, Canceled, workflow.StateOf(monitor).GetStatus())
+	})
+}
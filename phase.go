@@ -11,7 +11,7 @@ package flow
 //	}
 //
 // - Only all Steps in previous phase terminated, the next phase will start.
-// - Even if the steps in previous phase are not successful, the next phase will still start.
+// - Even if the steps in previous phase are not successful, the next phase will still start, see WithPhaseOnFailure.
 // - The order of steps in the same phase is not guaranteed. (defer is not stack!)
 //
 // Customized phase can be added to WorkflowPhases.
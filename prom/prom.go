@@ -0,0 +1,129 @@
+// Package prom exports metrics of Workflow to Prometheus.
+//
+// It's a separate module, so the Prometheus client is only required by the users importing it.
+package prom
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	flow "github.com/Azure/go-workflow"
+)
+
+// WithPrometheus registers metrics of Steps to the registerer, and collects them by flow.Notify.
+//
+//   - <namespace>_steps_started_total, counter of started Steps,
+//   - <namespace>_steps_terminated_total, counter of terminated Steps, labeled by status (succeeded, failed, skipped, canceled),
+//   - <namespace>_step_duration_seconds, histogram of Step durations,
+//   - <namespace>_steps_running, gauge of currently running Steps.
+//
+// All metrics are labeled by step, the name of Step (see flow.String), so name the Steps (i.e. flow.WithName)
+// to keep the cardinality low.
+// Notify is called for each attempt, so a retried Step is counted once per attempt.
+//
+// labels are the keys of Step labels (see flow.AddSteps.Labels) exported as metric labels as well,
+// the value is empty if the Step doesn't have the label, i.e.
+//
+//	WithPrometheus(registerer, "ci", "team") // ci_steps_started_total{step="build",team="infra"}
+//
+// The metrics are shared by Workflows using the same registerer, namespace and labels,
+// it's safe to pass WithPrometheus to many Workflows.
+func WithPrometheus(registerer prometheus.Registerer, namespace string, labels ...string) flow.WorkflowOption {
+	step := append([]string{"step"}, labels...)
+	m := &metrics{
+		labels: labels,
+		started: register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "steps_started_total",
+			Help:      "Number of started Steps.",
+		}, step)),
+		terminated: register(registerer, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "steps_terminated_total",
+			Help:      "Number of terminated Steps by status.",
+		}, append(slices.Clone(step), "status"))),
+		duration: register(registerer, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "step_duration_seconds",
+			Help:      "Duration of Steps in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, step)),
+		running: register(registerer, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "steps_running",
+			Help:      "Number of currently running Steps.",
+		}, step)),
+	}
+	return flow.WithNotify(flow.Notify{
+		BeforeStep: m.before,
+		AfterStep:  m.after,
+	})
+}
+
+type metrics struct {
+	labels     []string // keys of Step labels exported
+	started    *prometheus.CounterVec
+	terminated *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	running    *prometheus.GaugeVec
+}
+
+type startKey struct{}
+
+func (m *metrics) before(ctx context.Context, step flow.Steper) context.Context {
+	values := m.valuesOf(ctx, step)
+	m.started.WithLabelValues(values...).Inc()
+	m.running.WithLabelValues(values...).Inc()
+	return context.WithValue(ctx, startKey{}, time.Now())
+}
+
+func (m *metrics) after(ctx context.Context, step flow.Steper, err error) {
+	values := m.valuesOf(ctx, step)
+	m.running.WithLabelValues(values...).Dec()
+	m.terminated.WithLabelValues(append(values, statusOf(err))...).Inc()
+	if start, ok := ctx.Value(startKey{}).(time.Time); ok {
+		m.duration.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+	}
+}
+
+// valuesOf returns the values of metric labels, the name of Step followed by the Step labels.
+func (m *metrics) valuesOf(ctx context.Context, step flow.Steper) []string {
+	values := []string{flow.String(step)}
+	stepLabels := flow.LabelsFrom(ctx)
+	for _, label := range m.labels {
+		values = append(values, stepLabels[label])
+	}
+	return values
+}
+
+// statusOf maps the error of Step to the status label, same as the default mapping in Workflow.
+func statusOf(err error) string {
+	switch {
+	case err == nil:
+		return "succeeded"
+	case flow.DefaultIsCanceled(err):
+		return "canceled"
+	case errors.As(err, new(flow.ErrSkip)):
+		return "skipped"
+	default:
+		return "failed"
+	}
+}
+
+// register registers the collector, or returns the existing one if it's already registered.
+func register[C prometheus.Collector](registerer prometheus.Registerer, c C) C {
+	if err := registerer.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
@@ -0,0 +1,70 @@
+package prom
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	flow "github.com/Azure/go-workflow"
+)
+
+func TestWithPrometheus(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ok := flow.Func("ok", func(ctx context.Context) error { return nil })
+	fail := flow.Func("fail", func(ctx context.Context) error { return fmt.Errorf("fail") })
+	skip := flow.Func("skip", func(ctx context.Context) error { return flow.Skip(fmt.Errorf("skip")) })
+	workflow := new(flow.Workflow).Options(WithPrometheus(registry, "test"))
+	workflow.Add(flow.Steps(ok, fail, skip))
+	assert.Error(t, workflow.Do(context.Background()))
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP test_steps_started_total Number of started Steps.
+# TYPE test_steps_started_total counter
+test_steps_started_total{step="fail"} 1
+test_steps_started_total{step="ok"} 1
+test_steps_started_total{step="skip"} 1
+# HELP test_steps_terminated_total Number of terminated Steps by status.
+# TYPE test_steps_terminated_total counter
+test_steps_terminated_total{status="failed",step="fail"} 1
+test_steps_terminated_total{status="skipped",step="skip"} 1
+test_steps_terminated_total{status="succeeded",step="ok"} 1
+# HELP test_steps_running Number of currently running Steps.
+# TYPE test_steps_running gauge
+test_steps_running{step="fail"} 0
+test_steps_running{step="ok"} 0
+test_steps_running{step="skip"} 0
+`), "test_steps_started_total", "test_steps_terminated_total", "test_steps_running"))
+	count, err := testutil.GatherAndCount(registry, "test_step_duration_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	t.Run("labels of Steps", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		workflow := new(flow.Workflow).Options(WithPrometheus(registry, "test", "team"))
+		workflow.Add(flow.Step(ok).Labels(map[string]string{"team": "infra", "other": "ignored"}), flow.Step(fail))
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP test_steps_terminated_total Number of terminated Steps by status.
+# TYPE test_steps_terminated_total counter
+test_steps_terminated_total{status="failed",step="fail",team=""} 1
+test_steps_terminated_total{status="succeeded",step="ok",team="infra"} 1
+`), "test_steps_terminated_total"))
+	})
+	t.Run("share metrics across Workflows", func(t *testing.T) {
+		another := new(flow.Workflow).Options(WithPrometheus(registry, "test"))
+		another.Add(flow.Step(ok))
+		assert.NoError(t, another.Do(context.Background()))
+		assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP test_steps_started_total Number of started Steps.
+# TYPE test_steps_started_total counter
+test_steps_started_total{step="fail"} 1
+test_steps_started_total{step="ok"} 2
+test_steps_started_total{step="skip"} 1
+`), "test_steps_started_total"))
+	})
+}
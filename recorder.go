@@ -0,0 +1,122 @@
+package flow
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recorder records the status transitions of root Steps with timestamps during Do, see WithRecorder.
+//
+// It's useful to debug nondeterministic issues, i.e. to inspect the order and concurrency of Steps
+// by Timeline, or to visualize the run by Gantt.
+//
+//	recorder := new(flow.Recorder)
+//	workflow := new(flow.Workflow).Options(flow.WithRecorder(recorder))
+//	_ = workflow.Do(ctx)
+//	fmt.Print(recorder.Gantt())
+//
+// Recorder keeps recording across runs, use a new Recorder for each run to visualize the runs separately.
+// It's safe for concurrent use.
+type Recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Event is a StepEvent recorded at the time, see Recorder.
+type Event struct {
+	StepEvent
+	Labels map[string]string // of the Step, see AddSteps.Labels
+	At     time.Time         // by the clock of Workflow, see WithClock
+}
+
+func (r *Recorder) record(event StepEvent, labels map[string]string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, Event{StepEvent: event, Labels: labels, At: at})
+}
+
+// Timeline returns a copy of the recorded Events in the order they happened.
+func (r *Recorder) Timeline() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+// ganttWidth is the number of columns the recorded duration is scaled to in Gantt.
+const ganttWidth = 50
+
+// Gantt renders the Timeline as an ASCII Gantt chart, one row for each Step in the order of first Event,
+// '=' marks the Step is Running, followed by the last status, i.e.
+//
+//	build  |====================                              | Succeeded
+//	test   |                    ==============================| Failed
+//	deploy |                                                  | Skipped
+//	total 50s, 1s per column
+//
+// Steps never Running (i.e. Skipped) have empty rows.
+func (r *Recorder) Gantt() string {
+	events := r.Timeline()
+	if len(events) == 0 {
+		return ""
+	}
+	type row struct {
+		name  string
+		spans [][2]time.Time // start and end of each Running
+		last  StepStatus
+	}
+	var rows []*row
+	byStep := make(map[Steper]*row)
+	start, end := events[0].At, events[0].At
+	for _, e := range events {
+		if e.At.Before(start) {
+			start = e.At
+		}
+		if e.At.After(end) {
+			end = e.At
+		}
+		rw, ok := byStep[e.Step]
+		if !ok {
+			rw = &row{name: String(e.Step)}
+			byStep[e.Step] = rw
+			rows = append(rows, rw)
+		}
+		if n := len(rw.spans); n > 0 && rw.spans[n-1][1].IsZero() {
+			rw.spans[n-1][1] = e.At // the status after Running
+		}
+		if e.Status == Running {
+			rw.spans = append(rw.spans, [2]time.Time{e.At})
+		}
+		rw.last = e.Status
+	}
+	total := end.Sub(start)
+	column := func(at time.Time) int {
+		if total <= 0 {
+			return 0
+		}
+		return int(int64(at.Sub(start)) * ganttWidth / int64(total))
+	}
+	nameWidth := 0
+	for _, rw := range rows {
+		nameWidth = max(nameWidth, len(rw.name))
+	}
+	var builder strings.Builder
+	for _, rw := range rows {
+		bar := []byte(strings.Repeat(" ", ganttWidth))
+		for _, span := range rw.spans {
+			if span[1].IsZero() { // still Running
+				span[1] = end
+			}
+			from := min(column(span[0]), ganttWidth-1)
+			to := min(max(column(span[1]), from+1), ganttWidth) // at least one column for short Running
+			for i := from; i < to; i++ {
+				bar[i] = '='
+			}
+		}
+		fmt.Fprintf(&builder, "%-*s |%s| %s\n", nameWidth, rw.name, bar, rw.last)
+	}
+	fmt.Fprintf(&builder, "total %s, %s per column\n", total, total/ganttWidth)
+	return builder.String()
+}
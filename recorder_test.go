@@ -0,0 +1,63 @@
+package flow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	t.Run("timeline", func(t *testing.T) {
+		a := noopStep("a")
+		b := Func("b", func(ctx context.Context) error { return assert.AnError })
+		c := noopStep("c")
+		recorder := new(Recorder)
+		workflow := new(Workflow).Options(WithRecorder(recorder))
+		workflow.Add(Pipe(a, b, c), Step(b).Labels(map[string]string{"team": "infra"}))
+		assert.Error(t, workflow.Do(context.Background()))
+		var got []StepEvent
+		for _, e := range recorder.Timeline() {
+			got = append(got, StepEvent{Step: e.Step, StatusError: StatusError{Status: e.Status}})
+			if e.Step == b {
+				assert.Equal(t, map[string]string{"team": "infra"}, e.Labels)
+			} else {
+				assert.Nil(t, e.Labels)
+			}
+		}
+		assert.Equal(t, []StepEvent{
+			{Step: a, StatusError: StatusError{Status: Running}},
+			{Step: a, StatusError: StatusError{Status: Succeeded}},
+			{Step: b, StatusError: StatusError{Status: Running}},
+			{Step: b, StatusError: StatusError{Status: Failed}},
+			{Step: c, StatusError: StatusError{Status: Skipped}},
+		}, got)
+	})
+	t.Run("gantt", func(t *testing.T) {
+		build, test, deploy := noopStep("build"), noopStep("test"), noopStep("deploy")
+		start := time.Unix(0, 0)
+		at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+		recorder := new(Recorder)
+		for _, e := range []struct {
+			step    Steper
+			status  StepStatus
+			seconds int
+		}{
+			{build, Running, 0},
+			{build, Succeeded, 20},
+			{test, Running, 20},
+			{test, Failed, 50},
+			{deploy, Skipped, 50},
+		} {
+			recorder.record(StepEvent{Step: e.step, StatusError: StatusError{Status: e.status}}, nil, at(e.seconds))
+		}
+		assert.Equal(t, ""+
+			"build  |====================                              | Succeeded\n"+
+			"test   |                    ==============================| Failed\n"+
+			"deploy |                                                  | Skipped\n"+
+			"total 50s, 1s per column\n",
+			recorder.Gantt())
+		assert.Empty(t, new(Recorder).Gantt())
+	})
+}
@@ -0,0 +1,121 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Report captures the structure, timing, status and results of a run of Workflow in one object,
+// i.e. to be serialized as an artifact for auditing, see DoWithReport.
+type Report struct {
+	Start time.Time    `json:"start"`
+	End   time.Time    `json:"end"`
+	Steps []StepReport `json:"steps"` // root Steps sorted by name
+}
+
+// StepReport is a root Step in Report.
+type StepReport struct {
+	Name      string
+	Phase     Phase
+	Upstreams []string          // names of Upstreams, sorted
+	Labels    map[string]string // see AddSteps.Labels
+	Status    StepStatus
+	Err       error
+	Attempts  []AttemptRecord
+	WorkTime  time.Duration // see State.WorkTime
+	TotalTime time.Duration // see State.TotalTime
+	LeaseWait time.Duration // see State.LeaseWait
+	Output    any           // Output of Succeeded Function, nil for other Steps
+}
+
+// DoWithReport runs the Workflow like Do, and returns the Report of the run along with the error of Do.
+//
+// The Report is returned even if Do returns error, Outputs are only reported for Succeeded Functions.
+//
+//	report, err := workflow.DoWithReport(ctx)
+//	json.NewEncoder(file).Encode(report)
+func (w *Workflow) DoWithReport(ctx context.Context) (*Report, error) {
+	report := &Report{Start: w.Clock().Now()}
+	err := w.Do(ctx)
+	report.End = w.Clock().Now()
+	for step, state := range w.state {
+		sr := StepReport{
+			Name:      String(step),
+			Phase:     w.PhaseOf(step),
+			Labels:    w.LabelsOf(step),
+			Status:    state.GetStatus(),
+			Err:       state.GetStatusError().Err,
+			Attempts:  state.Attempts(),
+			WorkTime:  state.WorkTime(),
+			TotalTime: state.TotalTime(),
+			LeaseWait: state.LeaseWait(),
+		}
+		for up := range w.UpstreamOf(step) {
+			sr.Upstreams = append(sr.Upstreams, String(up))
+		}
+		slices.Sort(sr.Upstreams)
+		if sr.Status == Succeeded {
+			if fs := As[typedFunction](step); len(fs) > 0 {
+				sr.Output = fs[0].getOutput()
+			}
+		}
+		report.Steps = append(report.Steps, sr)
+	}
+	slices.SortFunc(report.Steps, func(a, b StepReport) int { return strings.Compare(a.Name, b.Name) })
+	return report, err
+}
+
+// MarshalJSON serializes the StepReport, the error is serialized as its message,
+// Output not serializable to JSON is omitted, with the reason noted in "output_error".
+func (sr StepReport) MarshalJSON() ([]byte, error) {
+	type attempt struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+		Err   string    `json:"error,omitempty"`
+	}
+	out := struct {
+		Name        string            `json:"name"`
+		Phase       Phase             `json:"phase"`
+		Upstreams   []string          `json:"upstreams,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty"`
+		Status      string            `json:"status"`
+		Err         string            `json:"error,omitempty"`
+		Attempts    []attempt         `json:"attempts,omitempty"`
+		WorkTime    time.Duration     `json:"work_time"`
+		TotalTime   time.Duration     `json:"total_time"`
+		LeaseWait   time.Duration     `json:"lease_wait"`
+		Output      json.RawMessage   `json:"output,omitempty"`
+		OutputError string            `json:"output_error,omitempty"`
+	}{
+		Name:      sr.Name,
+		Phase:     sr.Phase,
+		Upstreams: sr.Upstreams,
+		Labels:    sr.Labels,
+		Status:    sr.Status.String(),
+		WorkTime:  sr.WorkTime,
+		TotalTime: sr.TotalTime,
+		LeaseWait: sr.LeaseWait,
+	}
+	if sr.Err != nil {
+		out.Err = sr.Err.Error()
+	}
+	for _, a := range sr.Attempts {
+		at := attempt{Start: a.Start, End: a.End}
+		if a.Err != nil {
+			at.Err = a.Err.Error()
+		}
+		out.Attempts = append(out.Attempts, at)
+	}
+	if sr.Output != nil {
+		if data, err := json.Marshal(sr.Output); err != nil {
+			out.OutputError = fmt.Sprintf("output of type %T is not serializable: %s", sr.Output, err)
+		} else {
+			out.Output = data
+		}
+	}
+	return json.Marshal(out)
+}
@@ -0,0 +1,46 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoWithReport(t *testing.T) {
+	answer := FuncO("answer", func(ctx context.Context) (int, error) { return 42, nil })
+	channel := FuncO("channel", func(ctx context.Context) (chan int, error) { return make(chan int), nil })
+	failed := Func("failed", func(ctx context.Context) error { return assert.AnError })
+	workflow := new(Workflow)
+	workflow.Add(
+		Step(channel).DependsOn(answer),
+		Step(failed).Labels(map[string]string{"team": "infra"}),
+	)
+	report, err := workflow.DoWithReport(context.Background())
+	assert.Error(t, err)
+	if assert.Len(t, report.Steps, 3) {
+		assert.Equal(t, "answer", report.Steps[0].Name)
+		assert.Equal(t, 42, report.Steps[0].Output)
+		assert.Equal(t, []string{"answer"}, report.Steps[1].Upstreams)
+		assert.Equal(t, Failed, report.Steps[2].Status)
+		assert.Equal(t, map[string]string{"team": "infra"}, report.Steps[2].Labels)
+		assert.Nil(t, report.Steps[2].Output)
+	}
+	assert.False(t, report.End.Before(report.Start))
+
+	data, err := json.Marshal(report)
+	assert.NoError(t, err)
+	var decoded struct {
+		Steps []map[string]any `json:"steps"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	if assert.Len(t, decoded.Steps, 3) {
+		assert.Equal(t, float64(42), decoded.Steps[0]["output"])
+		assert.Contains(t, decoded.Steps[1]["output_error"], "chan int")
+		assert.Equal(t, "Failed", decoded.Steps[2]["status"])
+		assert.Equal(t, assert.AnError.Error(), decoded.Steps[2]["error"])
+		assert.Equal(t, map[string]any{"team": "infra"}, decoded.Steps[2]["labels"])
+		assert.NotContains(t, decoded.Steps[0], "labels")
+	}
+}
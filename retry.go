@@ -2,8 +2,12 @@ package flow
 
 import (
 	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cenkalti/backoff/v4"
 )
 
@@ -13,15 +17,70 @@ var DefaultRetryOption = RetryOption{
 }
 
 // RetryOption customizes retry behavior of a Step in Workflow.
+//
+// Timeout bounds each attempt with a fresh deadline, the backoff waits are not counted,
+// while the Step level Timeout (see AddSteps.Timeout) bounds the total duration of all attempts, including backoff waits.
+// When both are set, each attempt ends at whichever deadline comes first,
+// and no more attempt starts after the Step level Timeout exceeded.
 type RetryOption struct {
 	Timeout  time.Duration // 0 means no timeout, it's per-retry timeout
 	Attempts uint64        // 0 means no limit
 	StopIf   func(ctx context.Context, attempt uint64, since time.Duration, err error) bool
 	Backoff  backoff.BackOff
 	Notify   backoff.Notify
-	Timer    backoff.Timer
+	Timer    backoff.Timer // waits the retry intervals, default to the Workflow's clock (see WithClock)
+	// DelayFunc decides the delay before the next attempt from the failed one, it overrides Backoff,
+	// i.e. to wait as the Retry-After from server.
+	//
+	// attempt is the number of attempts failed so far (since the last reset, see ResetOnProgress), starting from 1,
+	// lastErr is the error of the last attempt.
+	// A negative delay stops retrying, Attempts and StopIf still take effect.
+	DelayFunc func(attempt int, lastErr error) time.Duration
+	// JitterStrategy randomizes the delays from Backoff, so Steps retrying the same dependency spread out,
+	// default (JitterNone) keeps the delays from Backoff.
+	// It doesn't apply to DelayFunc, which returns the exact delay.
+	//
+	// Notice backoff.ExponentialBackOff randomizes by its RandomizationFactor already, set it to 0 to use JitterStrategy only.
+	JitterStrategy JitterStrategy
+	// Rand returns a random number in [0, n) for JitterStrategy, default to math/rand.Int63n,
+	// inject a seeded one for deterministic tests.
+	Rand func(n int64) int64
+	// ResetOnProgress resets the Backoff (including the Attempts budget)
+	// if the failed attempt reported progress via ReportProgress.
+	//
+	// It's useful for streaming Steps making partial progress,
+	// that a Step slowly succeeding will not be stopped by Attempts.
+	// The attempt passed to StopIf is not reset, it's still the total count of attempts,
+	// use StopIf to limit the total attempts if needed.
+	ResetOnProgress bool
 }
 
+// JitterStrategy decides how to randomize the retry delays, see RetryOption.JitterStrategy.
+//
+// Given the delay d from Backoff,
+type JitterStrategy int
+
+const (
+	JitterNone         JitterStrategy = iota // d
+	JitterFull                               // random in [0, d)
+	JitterEqual                              // d/2 + random in [0, d/2)
+	JitterDecorrelated                       // random in [d, 3 * previous delay), the first previous delay is d
+)
+
+// ReportProgress reports that the Step has made progress in the current attempt,
+// the Step should call it from its Do with the context passed in.
+//
+// What progress means is up to the Step, i.e. some records are processed and committed,
+// so a retry will not redo them.
+// See RetryOption.ResetOnProgress.
+func ReportProgress(ctx context.Context) {
+	if progress, ok := ctx.Value(progressKey{}).(func()); ok {
+		progress()
+	}
+}
+
+type progressKey struct{}
+
 // retry constructs a do function with retry enabled according to the option.
 func (w *Workflow) retry(opt *RetryOption) func(
 	ctx context.Context,
@@ -34,7 +93,17 @@ func (w *Workflow) retry(opt *RetryOption) func(
 		}
 	}
 	return func(ctx context.Context, fn func(context.Context) error, notAfter time.Time) error {
-		backOff := opt.Backoff
+		backOff, timer := opt.Backoff, opt.Timer
+		var lastErr error // the error of last attempt, for DelayFunc
+		switch {
+		case opt.DelayFunc != nil:
+			backOff = &delayBackOff{delay: opt.DelayFunc, lastErr: &lastErr}
+		case opt.JitterStrategy != JitterNone:
+			backOff = &jitterBackOff{BackOff: backOff, strategy: opt.JitterStrategy, rand: opt.Rand}
+		}
+		if timer == nil {
+			timer = &clockTimer{clock: w.clock}
+		}
 		backOff = backoff.WithContext(backOff, ctx)
 		if opt.Attempts > 0 {
 			backOff = backoff.WithMaxRetries(backOff, opt.Attempts)
@@ -44,23 +113,110 @@ func (w *Workflow) retry(opt *RetryOption) func(
 		return backoff.RetryNotifyWithTimer(
 			func() error {
 				defer func() { attempt++ }()
-				ctx, cancel := w.clock.WithTimeout(ctx, opt.Timeout)
-				defer cancel()
+				ctx := ctx // each attempt derives its own context
+				if opt.Timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = w.clock.WithTimeout(ctx, opt.Timeout)
+					defer cancel()
+				}
+				var progressed atomic.Bool
+				ctx = context.WithValue(ctx, progressKey{}, func() { progressed.Store(true) })
 				err := fn(ctx)
 				if err == nil {
 					return nil
 				}
+				if opt.ResetOnProgress && progressed.Load() {
+					backOff.Reset()
+				}
+				if errors.As(err, new(ErrSuspended)) { // suspended Step should be resumed, not retried
+					return backoff.Permanent(err)
+				}
 				if !notAfter.IsZero() && w.clock.Now().After(notAfter) { // Step level timeouted
 					err = backoff.Permanent(err)
 				}
 				if opt.StopIf != nil && opt.StopIf(ctx, attempt, w.clock.Since(start), err) {
 					err = backoff.Permanent(err)
 				}
+				lastErr = err
 				return err
 			},
 			backOff,
 			opt.Notify,
-			opt.Timer,
+			timer,
 		)
 	}
 }
+
+// delayBackOff adapts RetryOption.DelayFunc to backoff.BackOff.
+type delayBackOff struct {
+	delay   func(attempt int, lastErr error) time.Duration
+	lastErr *error
+	attempt int
+}
+
+func (b *delayBackOff) NextBackOff() time.Duration {
+	b.attempt++
+	if d := b.delay(b.attempt, *b.lastErr); d >= 0 {
+		return d
+	}
+	return backoff.Stop
+}
+func (b *delayBackOff) Reset() { b.attempt = 0 }
+
+// jitterBackOff randomizes the delays of BackOff by the strategy.
+type jitterBackOff struct {
+	backoff.BackOff
+	strategy JitterStrategy
+	rand     func(n int64) int64
+	prev     time.Duration // previous delay, for JitterDecorrelated
+}
+
+func (b *jitterBackOff) NextBackOff() time.Duration {
+	d := b.BackOff.NextBackOff()
+	if d == backoff.Stop || d <= 0 {
+		return d
+	}
+	random := b.rand
+	if random == nil {
+		random = rand.Int63n
+	}
+	switch b.strategy {
+	case JitterFull:
+		d = time.Duration(random(int64(d)))
+	case JitterEqual:
+		d = d/2 + time.Duration(random(int64(d-d/2)))
+	case JitterDecorrelated:
+		if b.prev == 0 {
+			b.prev = d
+		}
+		if upper := 3 * b.prev; upper > d {
+			d += time.Duration(random(int64(upper - d)))
+		}
+		b.prev = d
+	}
+	return d
+}
+func (b *jitterBackOff) Reset() {
+	b.BackOff.Reset()
+	b.prev = 0
+}
+
+// clockTimer implements backoff.Timer by the clock, so the waits are controllable in tests.
+type clockTimer struct {
+	clock clock.Clock
+	timer *clock.Timer
+}
+
+func (t *clockTimer) Start(duration time.Duration) {
+	if t.timer == nil {
+		t.timer = t.clock.Timer(duration)
+		return
+	}
+	t.timer.Reset(duration)
+}
+func (t *clockTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+}
+func (t *clockTimer) C() <-chan time.Time { return t.timer.C }
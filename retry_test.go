@@ -3,6 +3,7 @@ package flow
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -53,3 +54,279 @@ func (t *testTimer) Start(duration time.Duration) {
 func (t *testTimer) Stop() {
 	t.timer.Stop()
 }
+
+func TestRetryBackoffByClock(t *testing.T) {
+	mock := clock.NewMock()
+	attempts := 0
+	step := Func("flaky", func(ctx context.Context) error {
+		if attempts++; attempts < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	workflow := new(Workflow).Options(WithClock(mock))
+	workflow.Add(Step(step).Retry(func(ro *RetryOption) {
+		ro.Backoff = backoff.NewConstantBackOff(time.Hour)
+	}))
+	done := make(chan error)
+	go func() { done <- workflow.Do(context.Background()) }()
+	start := mock.Now()
+	for {
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+			assert.Equal(t, 3, attempts)
+			assert.GreaterOrEqual(t, mock.Since(start), 2*time.Hour)
+			return
+		case <-time.After(time.Millisecond):
+			mock.Add(time.Minute)
+		}
+	}
+}
+
+func TestRetryResetOnProgress(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		resetOnProgress bool
+		expectErr       bool
+		expectAttempts  int
+	}{
+		{"reset on progress", true, false, 6},
+		{"not reset", false, true, 3},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			attempts := 0
+			step := Func("stream", func(ctx context.Context) error {
+				attempts++
+				if attempts <= 5 {
+					ReportProgress(ctx) // make some progress, then fail
+					return errors.New("interrupted")
+				}
+				return nil
+			})
+			workflow := new(Workflow)
+			workflow.Add(
+				Step(step).Retry(func(ro *RetryOption) {
+					ro.Backoff = backoff.NewConstantBackOff(0)
+					ro.Attempts = 2
+					ro.Timer = new(testTimer)
+					ro.ResetOnProgress = tc.resetOnProgress
+				}),
+			)
+			err := workflow.Do(context.Background())
+			if tc.expectErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectAttempts, attempts)
+		})
+	}
+	t.Run("report progress without retry is no-op", func(t *testing.T) {
+		ReportProgress(context.Background())
+	})
+}
+
+func TestAttempts(t *testing.T) {
+	errs := []error{errors.New("timeout"), errors.New("timeout"), errors.New("connection refused")}
+	attempt := 0
+	step := Func("flaky", func(ctx context.Context) error {
+		defer func() { attempt++ }()
+		if attempt < len(errs) {
+			return errs[attempt]
+		}
+		return nil
+	})
+	mockClock := clock.NewMock()
+	workflow := new(Workflow).Options(WithClock(mockClock))
+	workflow.Add(
+		Step(step).Retry(func(ro *RetryOption) {
+			ro.Attempts = 5
+			ro.Timer = new(testTimer)
+		}),
+	)
+	assert.NoError(t, workflow.Do(context.Background()))
+	attempts := workflow.StateOf(step).Attempts()
+	if assert.Len(t, attempts, 4) {
+		for i, err := range errs {
+			assert.Equal(t, err, attempts[i].Err)
+		}
+		assert.NoError(t, attempts[3].Err)
+		assert.Equal(t, mockClock.Now(), attempts[0].Start)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	t.Run("no timeout", func(t *testing.T) {
+		attempts := 0
+		step := Func("observe ctx", func(ctx context.Context) error {
+			attempts++
+			if attempts < 2 {
+				return errors.New("failed")
+			}
+			return ctx.Err()
+		})
+		workflow := new(Workflow)
+		workflow.Add(Step(step).Retry(func(ro *RetryOption) {
+			ro.Timer = new(testTimer)
+		}))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, 2, attempts)
+	})
+	t.Run("fresh deadline for each attempt", func(t *testing.T) {
+		mock := clock.NewMock()
+		var deadlines []time.Time
+		step := Func("record deadline", func(ctx context.Context) error {
+			deadline, _ := ctx.Deadline()
+			deadlines = append(deadlines, deadline)
+			mock.Add(time.Minute) // each attempt takes 1 minute
+			if len(deadlines) < 3 {
+				return errors.New("failed")
+			}
+			return nil
+		})
+		workflow := new(Workflow).Options(WithClock(mock))
+		workflow.Add(Step(step).Retry(func(ro *RetryOption) {
+			ro.Timer = new(testTimer)
+			ro.Timeout = 2 * time.Minute
+		}))
+		start := mock.Now()
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []time.Time{
+			start.Add(2 * time.Minute),
+			start.Add(3 * time.Minute),
+			start.Add(4 * time.Minute),
+		}, deadlines)
+	})
+	t.Run("step level timeout bounds all attempts", func(t *testing.T) {
+		mock := clock.NewMock()
+		var deadlines []time.Time
+		step := Func("record deadline", func(ctx context.Context) error {
+			deadline, _ := ctx.Deadline()
+			deadlines = append(deadlines, deadline)
+			mock.Add(time.Minute) // each attempt takes 1 minute
+			return errors.New("failed")
+		})
+		workflow := new(Workflow).Options(WithClock(mock))
+		workflow.Add(Step(step).
+			Timeout(150 * time.Second).
+			Retry(func(ro *RetryOption) {
+				ro.Timer = new(testTimer)
+				ro.Timeout = 2 * time.Minute
+			}),
+		)
+		start := mock.Now()
+		assert.Error(t, workflow.Do(context.Background()))
+		// each attempt ends at the earlier deadline, no more attempt after the Step level Timeout exceeded
+		assert.Equal(t, []time.Time{
+			start.Add(2 * time.Minute),
+			start.Add(150 * time.Second),
+			start.Add(150 * time.Second),
+		}, deadlines)
+	})
+}
+
+type retryAfterError struct{ after time.Duration }
+
+func (e retryAfterError) Error() string { return fmt.Sprintf("retry after %s", e.after) }
+
+func TestRetryDelayFunc(t *testing.T) {
+	newStep := func(errs ...error) (Steper, *int) {
+		attempts := 0
+		return Func("call", func(ctx context.Context) error {
+			defer func() { attempts++ }()
+			if attempts < len(errs) {
+				return errs[attempts]
+			}
+			return nil
+		}), &attempts
+	}
+	retryAfter := func(attempt int, lastErr error) time.Duration {
+		var ra retryAfterError
+		if errors.As(lastErr, &ra) {
+			return ra.after
+		}
+		return -1
+	}
+	t.Run("wait by the Workflow's clock", func(t *testing.T) {
+		mock := clock.NewMock()
+		step, attempts := newStep(retryAfterError{10 * time.Second}, retryAfterError{20 * time.Second})
+		workflow := new(Workflow).Options(WithClock(mock))
+		var delays []string
+		workflow.Add(Step(step).Retry(func(ro *RetryOption) {
+			ro.DelayFunc = func(attempt int, lastErr error) time.Duration {
+				delays = append(delays, fmt.Sprintf("%d: %s", attempt, lastErr))
+				return retryAfter(attempt, lastErr)
+			}
+		}))
+		done := make(chan error)
+		go func() { done <- workflow.Do(context.Background()) }()
+		start := mock.Now()
+		for {
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+				assert.Equal(t, 3, *attempts)
+				assert.Equal(t, []string{"1: retry after 10s", "2: retry after 20s"}, delays)
+				assert.GreaterOrEqual(t, mock.Since(start), 30*time.Second)
+				return
+			case <-time.After(time.Millisecond):
+				mock.Add(time.Second)
+			}
+		}
+	})
+	t.Run("negative delay stops retrying", func(t *testing.T) {
+		step, attempts := newStep(errors.New("fatal"), errors.New("fatal"))
+		workflow := new(Workflow)
+		workflow.Add(Step(step).Retry(func(ro *RetryOption) {
+			ro.DelayFunc = retryAfter
+		}))
+		assert.ErrorContains(t, workflow.Do(context.Background()), "fatal")
+		assert.Equal(t, 1, *attempts)
+	})
+}
+
+func TestRetryJitter(t *testing.T) {
+	half := func(n int64) int64 { return n / 2 }
+	delays := func(strategy JitterStrategy) []time.Duration {
+		b := &jitterBackOff{BackOff: backoff.NewConstantBackOff(10 * time.Second), strategy: strategy, rand: half}
+		return []time.Duration{b.NextBackOff(), b.NextBackOff(), b.NextBackOff()}
+	}
+	assert.Equal(t, []time.Duration{10 * time.Second, 10 * time.Second, 10 * time.Second}, delays(JitterNone))
+	assert.Equal(t, []time.Duration{5 * time.Second, 5 * time.Second, 5 * time.Second}, delays(JitterFull))
+	assert.Equal(t, []time.Duration{7500 * time.Millisecond, 7500 * time.Millisecond, 7500 * time.Millisecond}, delays(JitterEqual))
+	assert.Equal(t, []time.Duration{20 * time.Second, 35 * time.Second, 57500 * time.Millisecond}, delays(JitterDecorrelated))
+
+	t.Run("wait by the Workflow's clock", func(t *testing.T) {
+		mock := clock.NewMock()
+		attempts := 0
+		step := Func("flaky", func(ctx context.Context) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("flaky")
+			}
+			return nil
+		})
+		workflow := new(Workflow).Options(WithClock(mock))
+		workflow.Add(Step(step).Retry(func(ro *RetryOption) {
+			ro.Backoff = backoff.NewConstantBackOff(10 * time.Second)
+			ro.JitterStrategy = JitterEqual
+			ro.Rand = half
+		}))
+		done := make(chan error)
+		go func() { done <- workflow.Do(context.Background()) }()
+		start := mock.Now()
+		for {
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+				assert.Equal(t, 3, attempts)
+				assert.GreaterOrEqual(t, mock.Since(start), 15*time.Second)
+				return
+			case <-time.After(time.Millisecond):
+				mock.Add(time.Second)
+			}
+		}
+	})
+}
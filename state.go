@@ -2,7 +2,9 @@ package flow
 
 import (
 	"context"
+	"slices"
 	"sync"
+	"time"
 )
 
 // State is the internal state of a Step in a Workflow.
@@ -13,6 +15,36 @@ type State struct {
 	StatusError
 	Config *StepConfig
 	sync.RWMutex
+
+	seq      int                     // the order of the adder adding the Step into Workflow, see Workflow.Parents
+	cancel   context.CancelCauseFunc // cancel the running Step with cause
+	restored bool                    // the Step is restored as Succeeded from checkpoint
+	attempts []AttemptRecord         // history of attempts
+	done     chan struct{}           // closed when the Step is terminated
+
+	checkpoint  *StepCheckpoint // the checkpoint of last run, to compare Fingerprint
+	fingerprint string          // the Fingerprint of current run
+	cached      bool            // the Step is skipped due to unchanged Fingerprint or cached Output
+
+	lastBeat time.Time // when the running Step last reported alive, see Heartbeat
+
+	watching bool  // a goroutine is waiting for the WaitFor signal
+	signaled bool  // the WaitFor signal is received in current run
+	stopped  error // the cause to cancel the Step once it's running, see stopPeriodic
+
+	partial []byte // the partial state saved when the Step is Suspended, see SuspendedState
+
+	abandoned chan struct{} // closed once the Step abandoned after the grace period returns, see WithCancelGracePeriod
+
+	runnableAt time.Time     // when the Step became runnable in current run, see LeaseWait
+	leaseWait  time.Duration // how long the Step waited for leases in current run
+}
+
+// AttemptRecord is the record of an attempt to run the Step, see State.Attempts.
+type AttemptRecord struct {
+	Start time.Time // when the attempt started
+	End   time.Time // when the attempt ended
+	Err   error     // error returned from the attempt, nil means succeeded
 }
 
 func (s *State) GetStatus() StepStatus {
@@ -23,7 +55,115 @@ func (s *State) GetStatus() StepStatus {
 func (s *State) SetStatus(ss StepStatus) {
 	s.Lock()
 	defer s.Unlock()
+	s.setStatusLocked(ss)
+}
+
+// setStatusLocked sets the status with the lock held, and closes (or renews) the done channel accordingly.
+func (s *State) setStatusLocked(ss StepStatus) {
 	s.Status = ss
+	if s.done == nil {
+		return
+	}
+	select {
+	case <-s.done: // closed
+		if !ss.IsTerminated() { // the Step is reset
+			s.done = make(chan struct{})
+		}
+	default:
+		if ss.IsTerminated() {
+			close(s.done)
+		}
+	}
+}
+
+// reset clears the status, error and records of the last run, the config is preserved.
+func (s *State) reset() {
+	s.Lock()
+	defer s.Unlock()
+	s.StatusError = StatusError{}
+	s.restored = false
+	s.attempts = nil
+	s.checkpoint = nil
+	s.fingerprint = ""
+	s.cached = false
+	s.lastBeat = time.Time{}
+	s.watching = false
+	s.signaled = false
+	s.stopped = nil
+	s.partial = nil
+	s.runnableAt = time.Time{}
+	s.leaseWait = 0
+	if s.done != nil {
+		select {
+		case <-s.done:
+			s.done = make(chan struct{})
+		default:
+		}
+	}
+}
+
+// restore sets the Step Succeeded as restored from checkpoint, with its state unmarshaled from data.
+func (s *State) restore(sm StateMarshaler, data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := sm.UnmarshalState(data); err != nil {
+		return err
+	}
+	s.setStatusLocked(Succeeded)
+	s.restored = true
+	return nil
+}
+
+// isRestored returns true if the Step is restored as Succeeded from checkpoint.
+func (s *State) isRestored() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.restored && s.Status == Succeeded
+}
+
+// setCheckpoint records the checkpoint of last run, to compare the Fingerprint when the Step is about to run.
+func (s *State) setCheckpoint(sc *StepCheckpoint) {
+	s.Lock()
+	defer s.Unlock()
+	s.checkpoint = sc
+}
+
+// setPartial records the partial state saved when the Step is Suspended, see SuspendedState.
+func (s *State) setPartial(partial []byte) {
+	s.Lock()
+	defer s.Unlock()
+	s.partial = partial
+}
+
+// setAbandoned records the channel closed once the Step abandoned after the grace period returns.
+func (s *State) setAbandoned(returned chan struct{}) {
+	s.Lock()
+	defer s.Unlock()
+	s.abandoned = returned
+}
+
+// waitAbandoned waits for the Step abandoned after the grace period to return, if any.
+func (s *State) waitAbandoned() {
+	s.Lock()
+	returned := s.abandoned
+	s.abandoned = nil
+	s.Unlock()
+	if returned != nil {
+		<-returned
+	}
+}
+
+// Done returns a channel that's closed when the Step is terminated.
+func (s *State) Done() <-chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+	if s.done == nil {
+		s.done = make(chan struct{})
+		if s.Status.IsTerminated() {
+			close(s.done)
+		}
+	}
+	return s.done
 }
 func (s *State) GetError() error {
 	s.RLock()
@@ -40,6 +180,137 @@ func (s *State) GetStatusError() StatusError {
 	defer s.RUnlock()
 	return s.StatusError
 }
+
+// Attempts returns the history of attempts to run the Step, in order.
+//
+// A Step without Retry has at most one attempt.
+func (s *State) Attempts() []AttemptRecord {
+	s.RLock()
+	defer s.RUnlock()
+	return slices.Clone(s.attempts)
+}
+
+// WorkTime returns the sum of durations of all attempts, i.e. the time the Step spent doing work.
+func (s *State) WorkTime() time.Duration {
+	s.RLock()
+	defer s.RUnlock()
+	var d time.Duration
+	for _, a := range s.attempts {
+		d += a.End.Sub(a.Start)
+	}
+	return d
+}
+
+// TotalTime returns the duration from the start of the first attempt to the end of the last attempt,
+// including the waits between attempts, i.e. the backoff of Retry.
+//
+// The gap between TotalTime and WorkTime tells whether the Step is slow or stuck retrying.
+func (s *State) TotalTime() time.Duration {
+	s.RLock()
+	defer s.RUnlock()
+	if len(s.attempts) == 0 {
+		return 0
+	}
+	return s.attempts[len(s.attempts)-1].End.Sub(s.attempts[0].Start)
+}
+
+// LeaseWait returns how long the Step waited for leases, from it became runnable to it acquired the leases,
+// see WithMaxConcurrency, WithPhaseConcurrency, WithQueue and WithGroupConcurrency.
+//
+// Compare it with WorkTime to tell whether the concurrency limit is the bottleneck.
+// LeaseWait is zero if no lease is configured for the Step.
+func (s *State) LeaseWait() time.Duration {
+	s.RLock()
+	defer s.RUnlock()
+	return s.leaseWait
+}
+func (s *State) markRunnable(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	if s.runnableAt.IsZero() {
+		s.runnableAt = now
+	}
+}
+func (s *State) markLeased(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.leaseWait = now.Sub(s.runnableAt)
+}
+func (s *State) addAttempt(record AttemptRecord) {
+	s.Lock()
+	defer s.Unlock()
+	s.attempts = append(s.attempts, record)
+}
+
+// IsCached returns true if the Step Succeeded without running its Do,
+// because its Fingerprint is unchanged since the last run (see Fingerprinter),
+// or its Output is cached (see AddSteps.Cache).
+func (s *State) IsCached() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.cached
+}
+func (s *State) getFingerprint() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.fingerprint
+}
+func (s *State) heartbeat(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.lastBeat = now
+}
+func (s *State) getLastBeat() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+	return s.lastBeat
+}
+func (s *State) isSignaled() bool {
+	s.RLock()
+	defer s.RUnlock()
+	return s.signaled
+}
+func (s *State) signal() {
+	s.Lock()
+	defer s.Unlock()
+	s.signaled = true
+}
+
+// watch returns true if the caller should start watching the signal, only once per run.
+func (s *State) watch() bool {
+	s.Lock()
+	defer s.Unlock()
+	if s.watching {
+		return false
+	}
+	s.watching = true
+	return true
+}
+func (s *State) setCancel(cancel context.CancelCauseFunc) {
+	s.Lock()
+	defer s.Unlock()
+	s.cancel = cancel
+	if cancel != nil && s.stopped != nil {
+		cancel(s.stopped)
+	}
+}
+
+// stop cancels the Step with the cause, now if it's running, or once it starts.
+func (s *State) stop(cause error) {
+	s.Lock()
+	defer s.Unlock()
+	s.stopped = cause
+	if s.cancel != nil {
+		s.cancel(cause)
+	}
+}
+func (s *State) cancelWithCause(cause error) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.cancel != nil {
+		s.cancel(cause)
+	}
+}
 func (s *State) Upstreams() Set[Steper] {
 	if s.Config == nil {
 		return nil
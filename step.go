@@ -2,6 +2,10 @@ package flow
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
 	"time"
 )
 
@@ -13,6 +17,22 @@ type Steper interface {
 	Do(context.Context) error
 }
 
+// StepIDer is a Step with a logical identity, Workflow deduplicates Steps by StepID instead of pointer identity.
+//
+// It's useful for decorators, that the same logical Step wrapped twice is still one Step in Workflow:
+// adding a Step with the same StepID as a Step already in Workflow merges the config into the existing one,
+// and depending on it depends on the existing one.
+//
+// Be aware that
+//   - Steps intentionally duplicated (i.e. running the same logic twice) need distinct StepIDs,
+//   - empty StepID opts out of the deduplication,
+//   - the StepID is registered as the id of the Step (see Workflow.Register), so DependsOnID works with it,
+//   - StateOf and other queries take the Step added first, the duplicated ones are not in Workflow.
+type StepIDer interface {
+	Steper
+	StepID() string
+}
+
 // Implement this interface to be added into Workflow!
 type WorkflowAdder interface {
 	Done() map[Steper]*StepConfig
@@ -21,11 +41,36 @@ type StepConfig struct {
 	Upstreams Set[Steper]                 // Upstreams of the Step, means these Steps should happen-before this Step
 	Input     func(context.Context) error // Input callback of the Step, will be called before Do
 	Option    func(*StepOption)           // Option customize the Step settings
+	// UpstreamIDs are Upstreams referenced by id, Workflow resolves them to Steps, see Workflow.Register.
+	UpstreamIDs Set[string]
+	// UpstreamPhases are Upstreams as all Steps in the phases, see DependsOnPhase.
+	UpstreamPhases Set[Phase]
 }
 type StepOption struct {
-	RetryOption *RetryOption   // RetryOption customize how the Step should be retried, default (nil) means no retry.
-	Condition   Condition      // Condition decides whether Workflow should execute the Step, default to DefaultCondition.
-	Timeout     *time.Duration // Timeout sets the Step level timeout, default (nil) means no timeout.
+	RetryOption  *RetryOption    // RetryOption customize how the Step should be retried, default (nil) means no retry.
+	Condition    Condition       // Condition decides whether Workflow should execute the Step, default to DefaultCondition.
+	Timeout      *time.Duration  // Timeout sets the Step level timeout, default (nil) means no timeout.
+	RateLimit    string          // RateLimit is the key of rate limiter set by WithRateLimit, default ("") means unlimited.
+	Queue        string          // Queue is the name of queue set by WithQueue, default ("") means not in any queue.
+	Group        string          // Group is the logical group of the Step, see Workflow.GroupStatus.
+	PanicAs      StepStatus      // PanicAs is the status of a recovered panic Step, default (Pending) means Failed, see DontPanic.
+	RecoverPanic bool            // RecoverPanic recovers panic from the Step regardless of DontPanic, see AddSteps.RecoverPanic.
+	Optional     bool            // Optional Step's failure doesn't fail the Workflow, see AddSteps.Optional.
+	Critical     bool            // Critical Step's failure cancels the Workflow, see AddSteps.Critical.
+	StartJitter  *time.Duration  // StartJitter is the max random delay before the Step starts, default (nil) follows WithStartJitter.
+	CacheKey     string          // CacheKey is the key to cache the Output of Function across runs, default ("") means no cache, see AddSteps.Cache.
+	CacheTTL     time.Duration   // CacheTTL is how long the cached Output is valid, see AddSteps.Cache.
+	WaitFor      <-chan struct{} // WaitFor is the external signal the Step waits for before starting, see AddSteps.WaitFor.
+	LockOSThread bool            // LockOSThread wires the Step to an OS thread while it runs, see AddSteps.LockOSThread.
+	Cost         float64         // Cost is the units the Step costs, see AddSteps.Cost.
+	// UpstreamStatus is the expected statuses of specific Upstreams, see DependsOnSuccess and DependsOnFailure.
+	UpstreamStatus map[Steper][]StepStatus
+	// Labels are arbitrary metadata of the Step, they don't affect scheduling, see Workflow.LabelsOf.
+	Labels map[string]string
+	// StoreWrites are keys the Step writes to the Store, see AddSteps.Writes.
+	StoreWrites Set[string]
+	// StoreReads are keys the Step reads from the Store, they must be written by its Upstreams, see InputFromStore.
+	StoreReads Set[string]
 }
 
 // Steps declares a series of Steps ready to be added into Workflow.
@@ -84,6 +129,23 @@ func Pipe(steps ...Steper) AddSteps {
 	return as
 }
 
+// Sequential chains the Steps into a pipeline, it's the same as Pipe(steps...).
+//
+// It's handy for generated Workflows where Steps are in a slice.
+//
+//	workflow.Add(
+//		Sequential(steps), // steps[0] -> steps[1] -> ... -> steps[n-1]
+//	)
+func Sequential(steps []Steper) AddSteps { return Pipe(steps...) }
+
+// FullyConnect makes every Step in to depend on every Step in from,
+// it's the same as Steps(to...).DependsOn(from...).
+//
+//	workflow.Add(
+//		FullyConnect(layerA, layerB), // all of layerA -> all of layerB
+//	)
+func FullyConnect(from, to []Steper) AddSteps { return Steps(to...).DependsOn(from...) }
+
 // DependsOn declares dependency on the given Steps.
 //
 //	Step(a).DependsOn(b, c)
@@ -96,6 +158,92 @@ func (as AddSteps) DependsOn(ups ...Steper) AddSteps {
 	return as
 }
 
+// DependsOnID declares dependency on the Steps registered with the ids.
+//
+// It's useful when Steps are assembled from different modules, and only ids are known.
+//
+//	workflow.Register("fetch", fetch)
+//	workflow.Add(
+//		Step(parse).DependsOnID("fetch"), // fetch -> parse
+//	)
+//
+// The ids are resolved once registered, either before or after the Step is added.
+// Workflow.Do returns ErrUnresolvedID if any id is still not registered.
+func (as AddSteps) DependsOnID(ids ...string) AddSteps {
+	for down := range as {
+		if as[down].UpstreamIDs == nil {
+			as[down].UpstreamIDs = make(Set[string])
+		}
+		as[down].UpstreamIDs.Add(ids...)
+	}
+	return as
+}
+
+// DependsOnPhase declares dependency on all Steps in the phases, including the ones added later.
+//
+//	workflow.Init(Step(setupA), Step(setupB))
+//	workflow.Add(Step(a).DependsOnPhase(PhaseInit)) // setupA, setupB -> a
+//
+// Steps in previous phases always run before, DependsOnPhase makes them Upstreams,
+// so the Condition decides with their statuses, i.e. the Step(s) are Skipped with DefaultCondition
+// if any Step in the phase is not Succeeded, while Steps without DependsOnPhase proceed anyway.
+//
+// Depending on its own phase, the Step(s) wait for all other Steps in the phase,
+// Steps in the phase depending on each other this way form a cycle, so do the phases after the Step's.
+func (as AddSteps) DependsOnPhase(phases ...Phase) AddSteps {
+	for down := range as {
+		if as[down].UpstreamPhases == nil {
+			as[down].UpstreamPhases = make(Set[Phase])
+		}
+		as[down].UpstreamPhases.Add(phases...)
+	}
+	return as
+}
+
+// DependsOnSuccess declares dependency on the given Steps,
+// and the Step(s) only run if the given Steps are Succeeded, otherwise Skipped.
+//
+//	Step(onSuccess).DependsOnSuccess(a) // a -> onSuccess, if a Succeeded
+func (as AddSteps) DependsOnSuccess(ups ...Steper) AddSteps {
+	return as.DependsOnStatus([]StepStatus{Succeeded}, ups...)
+}
+
+// DependsOnFailure declares dependency on the given Steps,
+// and the Step(s) only run if the given Steps are Failed or TimedOut, otherwise Skipped.
+//
+// It's useful to express try / catch style flows.
+//
+//	workflow.Add(
+//		Step(catch).DependsOnFailure(try),   // try -> catch, if try Failed
+//		Step(then).DependsOnSuccess(try),    // try -> then, if try Succeeded
+//		Step(finally).DependsOn(catch, then).When(Always),
+//	)
+func (as AddSteps) DependsOnFailure(ups ...Steper) AddSteps {
+	return as.DependsOnStatus([]StepStatus{Failed, TimedOut}, ups...)
+}
+
+// DependsOnStatus declares dependency on the given Steps,
+// and the Step(s) only run if the given Steps terminated in one of the statuses, otherwise Skipped.
+//
+// Upstreams with expected statuses are checked by Workflow, they will not be passed to the Condition.
+// The Condition still decides the next status based on the rest Upstreams.
+func (as AddSteps) DependsOnStatus(statuses []StepStatus, ups ...Steper) AddSteps {
+	as.DependsOn(ups...)
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			if so.UpstreamStatus == nil {
+				so.UpstreamStatus = make(map[Steper][]StepStatus)
+			}
+			for _, up := range ups {
+				if up != nil {
+					so.UpstreamStatus[up] = append(so.UpstreamStatus[up], statuses...)
+				}
+			}
+		})
+	}
+	return as
+}
+
 // Input adds Input callback for the Step(s).
 //
 // Input callback will be called before Do,
@@ -130,6 +278,8 @@ func (as AddStep[S]) Input(fns ...func(context.Context, S) error) AddStep[S] {
 //
 // Due to limitation of Go's generic type system,
 // Use Adapt function to workaround the type check.
+// Use Adapt2 or Adapt3 if the Input derives from multiple Upstreams.
+// Use SetInput in the adapter to feed the Input checked at runtime, it fails with ErrTypeMismatch on wrong types.
 //
 //	Step(down).InputDependsOn(
 //		Adapt(up, func(_ context.Context, u *Up, d *Down) error {
@@ -143,6 +293,7 @@ func (as AddStep[S]) InputDependsOn(adapts ...Adapter[S]) AddStep[S] {
 		for _, adapt := range adapts {
 			adapt := adapt
 			as.AddSteps[step].Upstreams.Add(adapt.Upstream)
+			as.AddSteps[step].Upstreams.Add(adapt.Upstreams...)
 			as.AddSteps[step].AddInput(func(ctx context.Context) error {
 				return adapt.Flow(ctx, step)
 			})
@@ -170,7 +321,189 @@ func Adapt[U, D Steper](up U, fn func(context.Context, U, D) error) Adapter[D] {
 	}
 }
 
+// Collect declares dependency on the given Upstreams,
+// and gathers their Outputs into a slice as the Input of the Step.
+//
+// The order of Outputs matches the order of Upstreams.
+// Outputs of Upstreams not Succeeded (i.e. Skipped with When(Always)) are omitted,
+// use CollectZero to keep zero values in place, use CollectAs to gather Outputs of different types.
+//
+//	workflow.Add(
+//		Collect(sum, a, b, c), // sum.Input = []int{a.Output, b.Output, c.Output}
+//	)
+func Collect[T, O any](step *Function[[]T, O], ups ...Outputer[T]) AddStep[*Function[[]T, O]] {
+	return collect(step, false, ups...)
+}
+
+// CollectZero is the same as Collect,
+// except that Outputs of Upstreams not Succeeded are zero values.
+func CollectZero[T, O any](step *Function[[]T, O], ups ...Outputer[T]) AddStep[*Function[[]T, O]] {
+	return collect(step, true, ups...)
+}
+
+func collect[T, O any](step *Function[[]T, O], zero bool, ups ...Outputer[T]) AddStep[*Function[[]T, O]] {
+	as := Step(step)
+	for _, up := range ups {
+		as.AddSteps.DependsOn(up)
+	}
+	return as.Input(func(ctx context.Context, f *Function[[]T, O]) error {
+		sc := stepContextFrom(ctx)
+		f.Input = make([]T, 0, len(ups))
+		for _, up := range ups {
+			if state := sc.stateOf(up); state != nil && state.GetStatus() != Succeeded {
+				if zero {
+					var zeroT T
+					f.Input = append(f.Input, zeroT)
+				}
+				continue
+			}
+			f.Input = append(f.Input, up.GetOutput())
+		}
+		return nil
+	})
+}
+
+// CollectAs is the same as Collect, except that the Upstreams are able to produce Outputs of different types,
+// as long as the Outputs implement (or are assignable to) I, i.e. plugin-style producers of a common interface.
+//
+//	workflow.Add(
+//		CollectAs[Shape](area, circle, square), // area.Input = []Shape{circle.Output, square.Output}
+//	)
+//
+// Outputs of Upstreams not Succeeded are omitted, nil Outputs are collected as zero values.
+// The Step fails with ErrInput wrapping ErrTypeMismatch if any Upstream is not a Function,
+// or its Output is not assignable to I.
+func CollectAs[I, O any](step *Function[[]I, O], ups ...Steper) AddStep[*Function[[]I, O]] {
+	as := Step(step)
+	for _, up := range ups {
+		as.AddSteps.DependsOn(up)
+	}
+	expected := reflect.TypeOf((*I)(nil)).Elem()
+	return as.Input(func(ctx context.Context, f *Function[[]I, O]) error {
+		sc := stepContextFrom(ctx)
+		f.Input = make([]I, 0, len(ups))
+		for _, up := range ups {
+			if state := sc.stateOf(up); state != nil && state.GetStatus() != Succeeded {
+				continue
+			}
+			fs := As[typedFunction](up)
+			if len(fs) == 0 {
+				return ErrTypeMismatch{Step: f, Expected: expected, Got: reflect.TypeOf(up)}
+			}
+			switch output := fs[0].getOutput().(type) {
+			case I:
+				f.Input = append(f.Input, output)
+			case nil:
+				var zero I
+				f.Input = append(f.Input, zero)
+			default:
+				return ErrTypeMismatch{Step: f, Expected: expected, Got: reflect.TypeOf(output)}
+			}
+		}
+		return nil
+	})
+}
+
+// PipeTyped declares down depends on up, and feeds the Output of up as the Input of down.
+//
+//	workflow.Add(
+//		PipeTyped(fetch, parse), // parse.Input = fetch.Output
+//	)
+//
+// The above code is equivalent to:
+//
+//	workflow.Add(
+//		Step(parse).InputDependsOn(Adapt(fetch, func(_ context.Context, f *Function[URL, []byte], p *Function[[]byte, Doc]) error {
+//			p.Input = f.Output
+//			return nil
+//		})),
+//	)
+//
+// It composes with other dependencies and Inputs of down, the Input callbacks are called in the order they are declared,
+// i.e. PipeTyped(a, c).InputDependsOn(Adapt(b, ...)) to adjust the Input of c from b after it's fed by a.
+func PipeTyped[O, D any](up Outputer[O], down *Function[O, D]) AddStep[*Function[O, D]] {
+	as := Step(down)
+	as.AddSteps.DependsOn(up)
+	return as.Input(func(ctx context.Context, f *Function[O, D]) error {
+		f.Input = up.GetOutput()
+		return nil
+	})
+}
+
+// InputFromStore sets the Input of step from the value of key in the Store (see StoreFrom), written by an Upstream.
+//
+//	workflow.Add(
+//		Step(login).Writes("token"),
+//		InputFromStore("token", Func("call", callWithToken)).DependsOn(login),
+//	)
+//
+// It's a middle ground between Adapt and AutoWire, the Upstreams are declared explicitly, the data flows implicitly.
+// Workflow asserts before Do that key is written (see AddSteps.Writes) by an Upstream of step, directly or transitively,
+// otherwise Do returns ErrStoreKeyNotWritten.
+// The Input fails if key is absent, or with ErrTypeMismatch if its value is not an I, when step starts.
+func InputFromStore[I, O any](key string, step *Function[I, O]) AddStep[*Function[I, O]] {
+	as := Step(step)
+	as.AddSteps[step].AddOption(func(so *StepOption) {
+		if so.StoreReads == nil {
+			so.StoreReads = make(Set[string])
+		}
+		so.StoreReads.Add(key)
+	})
+	return as.Input(func(ctx context.Context, f *Function[I, O]) error {
+		store := StoreFrom(ctx)
+		if store == nil {
+			return fmt.Errorf("no Store to read key %q, the Step is not run by Workflow", key)
+		}
+		v, ok := store.Get(key)
+		if !ok {
+			return fmt.Errorf("key %q is not in Store", key)
+		}
+		return f.setInput(v)
+	})
+}
+
+// Adapt2 is the same as Adapt, but bridges two Upstreams of different types to Downstream.
+//
+// Both Upstreams are declared as dependencies,
+// so fn is called after both Upstreams are terminated.
+//
+//	Step(down).InputDependsOn(
+//		Adapt2(up1, up2, func(_ context.Context, u1 *Up1, u2 *Up2, d *Down) error {
+//			// fill Down from Up1 and Up2
+//		}),
+//	)
+func Adapt2[U1, U2, D Steper](up1 U1, up2 U2, fn func(context.Context, U1, U2, D) error) Adapter[D] {
+	return Adapter[D]{
+		Upstream:  up1,
+		Upstreams: []Steper{up2},
+		Flow: func(ctx context.Context, d D) error {
+			return fn(ctx, up1, up2, d)
+		},
+	}
+}
+
+// Adapt3 is the same as Adapt, but bridges three Upstreams of different types to Downstream.
+//
+// All Upstreams are declared as dependencies,
+// so fn is called after all Upstreams are terminated.
+func Adapt3[U1, U2, U3, D Steper](up1 U1, up2 U2, up3 U3, fn func(context.Context, U1, U2, U3, D) error) Adapter[D] {
+	return Adapter[D]{
+		Upstream:  up1,
+		Upstreams: []Steper{up2, up3},
+		Flow: func(ctx context.Context, d D) error {
+			return fn(ctx, up1, up2, up3, d)
+		},
+	}
+}
+
 // Timeout sets the Step level timeout.
+//
+// The timeout starts when the Step starts executing, time waiting for the lease (see WithMaxConcurrency, WithQueue)
+// or the StartJitter doesn't count, while time waiting for the RateLimit counts since it's per attempt.
+//
+// The context of the Step has the deadline, so ctx.Err() is context.DeadlineExceeded instead of context.Canceled,
+// the Step exceeding its Timeout is TimedOut with ErrStepTimeout attached (see ErrCancelCause),
+// to tell apart from the Steps Canceled by the Workflow or the caller.
 func (as AddSteps) Timeout(timeout time.Duration) AddSteps {
 	for step := range as {
 		as[step].AddOption(func(so *StepOption) {
@@ -211,12 +544,243 @@ func (as AddSteps) Retry(opts ...func(*RetryOption)) AddSteps {
 	return as
 }
 
+// RateLimit tags the Steps with a rate limiter key, see WithRateLimit.
+//
+// Steps sharing the same key draw from a common rate limiter before each attempt of Do.
+func (as AddSteps) RateLimit(key string) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.RateLimit = key
+		})
+	}
+	return as
+}
+
+// Queue tags the Steps with a queue name, see WithQueue.
+//
+// Steps in the same queue share the queue's concurrency limit.
+func (as AddSteps) Queue(name string) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.Queue = name
+		})
+	}
+	return as
+}
+
+// WaitFor gates the Steps on an external signal, i.e. a file appears, a message arrives.
+//
+// The Steps are ready once their Upstreams are terminated and the Condition permits,
+// then they wait (stay Pending) until ch is closed or receives a value, without blocking other Steps.
+// Closing ch releases all the Steps waiting for it, while sending a value releases only one of them.
+// Once released, the Step doesn't wait again in the same run.
+// If the Workflow is canceled before the signal, the waiting Steps are Canceled.
+//
+//	ready := make(chan struct{})
+//	workflow.Add(Step(deploy).DependsOn(build).WaitFor(ready))
+//	go func() {
+//		waitForApproval()
+//		close(ready)
+//	}()
+func (as AddSteps) WaitFor(ch <-chan struct{}) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.WaitFor = ch
+		})
+	}
+	return as
+}
+
+// Group tags the Steps with a logical group, i.e. "ingest", "transform", "load",
+// query the aggregated status of the group by Workflow.GroupStatus.
+func (as AddSteps) Group(name string) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.Group = name
+		})
+	}
+	return as
+}
+
+// Labels attaches key / value metadata to the Steps, i.e. for routing or observability,
+// labels are merged with the previous ones, the same key is overridden.
+// Query them by Workflow.LabelsOf.
+func (as AddSteps) Labels(labels map[string]string) AddSteps {
+	labels = maps.Clone(labels)
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			if so.Labels == nil {
+				so.Labels = make(map[string]string)
+			}
+			for k, v := range labels {
+				so.Labels[k] = v
+			}
+		})
+	}
+	return as
+}
+
+// Cost declares the units each of the Steps costs, i.e. for billing per Step.
+//
+// Query the total cost by Workflow.TotalCost, and limit it by WithMaxCost.
+func (as AddSteps) Cost(units float64) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.Cost = units
+		})
+	}
+	return as
+}
+
+// Writes declares the keys the Steps write to the Store (see StoreFrom),
+// so Downstreams reading them by InputFromStore pass the preflight check.
+func (as AddSteps) Writes(keys ...string) AddSteps {
+	keys = slices.Clone(keys)
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			if so.StoreWrites == nil {
+				so.StoreWrites = make(Set[string])
+			}
+			so.StoreWrites.Add(keys...)
+		})
+	}
+	return as
+}
+
+// StartJitter sets the max random delay before the Steps start, overrides WithStartJitter.
+func (as AddSteps) StartJitter(max time.Duration) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.StartJitter = &max
+		})
+	}
+	return as
+}
+
+// Cache caches the Output of the Function Step(s) by key in the cache of Workflow (see WithCache),
+// it's useful for expensive and pure Steps.
+//
+// Within ttl since cached, a run of the Step with the same key gets the cached Output without calling Do,
+// and the Step is Succeeded as cached (see State.IsCached).
+// The cache is shared by the Workflows with the same cache, i.e. clones (see Workflow.Clone) running simultaneously.
+//
+//   - only the Output of Succeeded run is cached, errors are not cached, the next run calls Do again,
+//   - Steps not being Function, or with different Output type from the cached one, are not affected,
+//   - simultaneous runs missing the cache all call Do, the last Succeeded one is cached.
+//
+// Input callbacks are still called, since the cached Output is keyed by key only, not by Input.
+func (as AddSteps) Cache(key string, ttl time.Duration) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.CacheKey = key
+			so.CacheTTL = ttl
+		})
+	}
+	return as
+}
+
+// Optional marks the Steps as best-effort, their failures don't fail the Workflow.
+//
+// An Optional Step that Failed (or TimedOut)
+//   - is still recorded as Failed, the error is available from StateOf,
+//   - is excluded from ErrWorkflow returned by Do,
+//   - is regarded as Succeeded by the Conditions of its Downstreams, so AllSucceeded is satisfied,
+//     but expected statuses of DependsOnStatus are checked against Failed,
+//   - doesn't trigger WithFailFast.
+func (as AddSteps) Optional() AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.Optional = true
+		})
+	}
+	return as
+}
+
+// Critical marks the Steps as critical, once a critical Step Failed, the Workflow is canceled (fail fast)
+// and Do returns ErrFailFast, while failures of ordinary Steps are recorded and the Workflow continues.
+//
+//	workflow.Add(
+//		Step(deploy).Critical(),      // the deploy must succeed
+//		Step(notify).DependsOn(deploy), // notification failing is fine
+//	)
+//
+// With WithFailFast, any (non-Optional) failure cancels the Workflow, Critical makes no difference.
+// Critical takes precedence over Optional, a Step both Critical and Optional cancels the Workflow when Failed,
+// but its failure is still excluded from ErrWorkflow.
+func (as AddSteps) Critical() AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.Critical = true
+		})
+	}
+	return as
+}
+
+// LockOSThread wires the Steps to the OS thread during they run, i.e. Steps calling C libraries
+// that require the same OS thread across calls.
+//
+// The goroutine running the Step calls runtime.LockOSThread before the Step starts,
+// and runtime.UnlockOSThread after the Step (including retries) terminated, even if it panics.
+// With a custom executor (see WithExecutor), the executor's goroutine is locked as well,
+// so it can't be reused by others until the Step terminated.
+func (as AddSteps) LockOSThread() AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.LockOSThread = true
+		})
+	}
+	return as
+}
+
+// RecoverPanic recovers panic from the Steps (including their Input callbacks) as ErrPanic,
+// regardless of DontPanic, i.e. to isolate a risky plugin while other Steps' panics still crash.
+func (as AddSteps) RecoverPanic() AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.RecoverPanic = true
+		})
+	}
+	return as
+}
+
+// PanicAs sets the terminal status when the Step panics, instead of Failed.
+//
+// It only takes effect when the Workflow recovers panic from the Step, see DontPanic and RecoverPanic.
+// The recovered panic is returned as ErrPanic, which will be retried if Retry is set,
+// PanicAs only applies to the panic from the last attempt, custom statuses should be registered by WithStatusMapper.
+//
+//	Step(a).PanicAs(Skipped)
+func (as AddSteps) PanicAs(status StepStatus) AddSteps {
+	for step := range as {
+		as[step].AddOption(func(so *StepOption) {
+			so.PanicAs = status
+		})
+	}
+	return as
+}
+
 func (as AddSteps) Done() map[Steper]*StepConfig { return as } // WorkflowAdder
 
 func (as AddStep[S]) DependsOn(ups ...Steper) AddStep[S] {
 	as.AddSteps = as.AddSteps.DependsOn(ups...)
 	return as
 }
+func (as AddStep[S]) DependsOnID(ids ...string) AddStep[S] {
+	as.AddSteps = as.AddSteps.DependsOnID(ids...)
+	return as
+}
+func (as AddStep[S]) DependsOnSuccess(ups ...Steper) AddStep[S] {
+	as.AddSteps = as.AddSteps.DependsOnSuccess(ups...)
+	return as
+}
+func (as AddStep[S]) DependsOnFailure(ups ...Steper) AddStep[S] {
+	as.AddSteps = as.AddSteps.DependsOnFailure(ups...)
+	return as
+}
+func (as AddStep[S]) DependsOnStatus(statuses []StepStatus, ups ...Steper) AddStep[S] {
+	as.AddSteps = as.AddSteps.DependsOnStatus(statuses, ups...)
+	return as
+}
 func (as AddStep[S]) Timeout(timeout time.Duration) AddStep[S] {
 	as.AddSteps = as.AddSteps.Timeout(timeout)
 	return as
@@ -229,10 +793,67 @@ func (as AddStep[S]) Retry(fns ...func(*RetryOption)) AddStep[S] {
 	as.AddSteps = as.AddSteps.Retry(fns...)
 	return as
 }
+func (as AddStep[S]) StartJitter(max time.Duration) AddStep[S] {
+	as.AddSteps = as.AddSteps.StartJitter(max)
+	return as
+}
+func (as AddStep[S]) Cache(key string, ttl time.Duration) AddStep[S] {
+	as.AddSteps = as.AddSteps.Cache(key, ttl)
+	return as
+}
+func (as AddStep[S]) Optional() AddStep[S] {
+	as.AddSteps = as.AddSteps.Optional()
+	return as
+}
+func (as AddStep[S]) Critical() AddStep[S] {
+	as.AddSteps = as.AddSteps.Critical()
+	return as
+}
+func (as AddStep[S]) LockOSThread() AddStep[S] {
+	as.AddSteps = as.AddSteps.LockOSThread()
+	return as
+}
+func (as AddStep[S]) RecoverPanic() AddStep[S] {
+	as.AddSteps = as.AddSteps.RecoverPanic()
+	return as
+}
+func (as AddStep[S]) PanicAs(status StepStatus) AddStep[S] {
+	as.AddSteps = as.AddSteps.PanicAs(status)
+	return as
+}
+func (as AddStep[S]) RateLimit(key string) AddStep[S] {
+	as.AddSteps = as.AddSteps.RateLimit(key)
+	return as
+}
+func (as AddStep[S]) Queue(name string) AddStep[S] {
+	as.AddSteps = as.AddSteps.Queue(name)
+	return as
+}
+func (as AddStep[S]) WaitFor(ch <-chan struct{}) AddStep[S] {
+	as.AddSteps = as.AddSteps.WaitFor(ch)
+	return as
+}
+func (as AddStep[S]) Group(name string) AddStep[S] {
+	as.AddSteps = as.AddSteps.Group(name)
+	return as
+}
+func (as AddStep[S]) Cost(units float64) AddStep[S] {
+	as.AddSteps = as.AddSteps.Cost(units)
+	return as
+}
+func (as AddStep[S]) Writes(keys ...string) AddStep[S] {
+	as.AddSteps = as.AddSteps.Writes(keys...)
+	return as
+}
+func (as AddStep[S]) Labels(labels map[string]string) AddStep[S] {
+	as.AddSteps = as.AddSteps.Labels(labels)
+	return as
+}
 
 type Adapter[S Steper] struct {
-	Upstream Steper
-	Flow     func(context.Context, S) error
+	Upstream  Steper
+	Upstreams []Steper // more Upstreams, see Adapt2 and Adapt3
+	Flow      func(context.Context, S) error
 }
 type AddStep[S Steper] struct {
 	AddSteps
@@ -292,6 +913,18 @@ func (sc *StepConfig) Merge(other *StepConfig) {
 		sc.Upstreams = make(Set[Steper])
 	}
 	sc.Upstreams.Union(other.Upstreams)
+	if len(other.UpstreamIDs) > 0 {
+		if sc.UpstreamIDs == nil {
+			sc.UpstreamIDs = make(Set[string])
+		}
+		sc.UpstreamIDs.Union(other.UpstreamIDs)
+	}
+	if len(other.UpstreamPhases) > 0 {
+		if sc.UpstreamPhases == nil {
+			sc.UpstreamPhases = make(Set[Phase])
+		}
+		sc.UpstreamPhases.Union(other.UpstreamPhases)
+	}
 	sc.AddInput(other.Input)
 	sc.AddOption(other.Option)
 }
@@ -0,0 +1,591 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependsOnStatus(t *testing.T) {
+	newStep := func(name string, err error) *Function[struct{}, struct{}] {
+		return Func(name, func(ctx context.Context) error { return err })
+	}
+	t.Run("try catch", func(t *testing.T) {
+		for _, tc := range []struct {
+			name                string
+			err                 error
+			catch, then, finale StepStatus
+		}{
+			{"try succeeded", nil, Skipped, Succeeded, Succeeded},
+			{"try failed", fmt.Errorf("failed"), Succeeded, Skipped, Succeeded},
+		} {
+			tc := tc
+			t.Run(tc.name, func(t *testing.T) {
+				try := newStep("try", tc.err)
+				catch := newStep("catch", nil)
+				then := newStep("then", nil)
+				finale := newStep("finally", nil)
+				workflow := new(Workflow)
+				workflow.Add(
+					Step(catch).DependsOnFailure(try),
+					Step(then).DependsOnSuccess(try),
+					Step(finale).DependsOn(catch, then).When(Always),
+				)
+				_ = workflow.Do(context.Background())
+				assert.Equal(t, tc.catch, workflow.StateOf(catch).GetStatus())
+				assert.Equal(t, tc.then, workflow.StateOf(then).GetStatus())
+				assert.Equal(t, tc.finale, workflow.StateOf(finale).GetStatus())
+			})
+		}
+	})
+	t.Run("condition only sees the rest upstreams", func(t *testing.T) {
+		a := newStep("a", fmt.Errorf("failed"))
+		b := newStep("b", nil)
+		down := newStep("down", nil)
+		var seen map[Steper]StatusError
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(down).
+				DependsOnFailure(a).
+				DependsOn(b).
+				When(func(ctx context.Context, ups map[Steper]StatusError) StepStatus {
+					seen = ups
+					return AllSucceeded(ctx, ups)
+				}),
+		)
+		_ = workflow.Do(context.Background())
+		assert.Len(t, seen, 1)
+		assert.Contains(t, seen, b)
+		assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+	})
+	t.Run("any of statuses", func(t *testing.T) {
+		a := newStep("a", context.Canceled)
+		down := newStep("down", nil)
+		workflow := new(Workflow)
+		workflow.Add(Step(down).DependsOnStatus([]StepStatus{Failed, Canceled}, a))
+		_ = workflow.Do(context.Background())
+		assert.Equal(t, Canceled, workflow.StateOf(a).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+	})
+	t.Run("replaced upstream keeps expected statuses", func(t *testing.T) {
+		try := newStep("try", fmt.Errorf("failed"))
+		stub := newStep("stub", nil)
+		catch := newStep("catch", nil)
+		workflow := new(Workflow)
+		workflow.Add(Step(catch).DependsOnFailure(try))
+		assert.NoError(t, workflow.Replace(try, stub))
+		_ = workflow.Do(context.Background())
+		assert.Equal(t, Succeeded, workflow.StateOf(stub).GetStatus())
+		assert.Equal(t, Skipped, workflow.StateOf(catch).GetStatus())
+	})
+}
+
+func TestCollect(t *testing.T) {
+	newUps := func() (a, b, c *Function[struct{}, int]) {
+		a = FuncO("a", func(ctx context.Context) (int, error) { return 1, nil })
+		b = FuncO("b", func(ctx context.Context) (int, error) { return 2, fmt.Errorf("b failed") })
+		c = FuncO("c", func(ctx context.Context) (int, error) { return 3, nil })
+		return
+	}
+	newSum := func() *Function[[]int, []int] {
+		return FuncIO("sum", func(ctx context.Context, ints []int) ([]int, error) { return ints, nil })
+	}
+	t.Run("order matches upstreams", func(t *testing.T) {
+		a, _, c := newUps()
+		sum := newSum()
+		workflow := new(Workflow)
+		workflow.Add(Collect(sum, c, a))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []int{3, 1}, sum.Output)
+	})
+	t.Run("omit not succeeded", func(t *testing.T) {
+		a, b, c := newUps()
+		sum := newSum()
+		workflow := new(Workflow)
+		workflow.Add(Collect(sum, a, b, c).When(Always))
+		_ = workflow.Do(context.Background())
+		assert.Equal(t, []int{1, 3}, sum.Output)
+	})
+	t.Run("zero value for not succeeded", func(t *testing.T) {
+		a, b, c := newUps()
+		sum := newSum()
+		workflow := new(Workflow)
+		workflow.Add(CollectZero(sum, a, b, c).When(Always))
+		_ = workflow.Do(context.Background())
+		assert.Equal(t, []int{1, 0, 3}, sum.Output)
+	})
+}
+
+type shape interface{ area() int }
+type square int
+type rect struct{ w, h int }
+
+func (s square) area() int { return int(s * s) }
+func (r rect) area() int   { return r.w * r.h }
+
+func TestCollectAs(t *testing.T) {
+	sq := FuncO("square", func(ctx context.Context) (square, error) { return 2, nil })
+	rc := FuncO("rect", func(ctx context.Context) (rect, error) { return rect{2, 3}, nil })
+	newTotal := func() *Function[[]shape, int] {
+		return FuncIO("total", func(ctx context.Context, shapes []shape) (int, error) {
+			total := 0
+			for _, s := range shapes {
+				total += s.area()
+			}
+			return total, nil
+		})
+	}
+	t.Run("heterogeneous outputs", func(t *testing.T) {
+		total := newTotal()
+		workflow := new(Workflow)
+		workflow.Add(CollectAs(total, sq, rc))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []shape{square(2), rect{2, 3}}, total.Input)
+		assert.Equal(t, 10, total.Output)
+	})
+	t.Run("output not implementing", func(t *testing.T) {
+		total := newTotal()
+		str := FuncO("string", func(ctx context.Context) (string, error) { return "", nil })
+		workflow := new(Workflow)
+		workflow.Add(CollectAs(total, sq, str))
+		err := workflow.Do(context.Background())
+		var mismatch ErrTypeMismatch
+		if assert.ErrorAs(t, err, &mismatch) {
+			assert.Equal(t, reflect.TypeOf(""), mismatch.Got)
+		}
+		assert.Equal(t, Failed, workflow.StateOf(total).GetStatus())
+	})
+}
+
+func TestPipeTyped(t *testing.T) {
+	fetch := FuncO("fetch", func(ctx context.Context) (string, error) { return "hello", nil })
+	parse := FuncIO("parse", func(ctx context.Context, s string) (int, error) { return len(s), nil })
+	suffix := FuncO("suffix", func(ctx context.Context) (string, error) { return " world", nil })
+	echo := FuncIO("echo", func(ctx context.Context, s string) (string, error) { return s, nil })
+	workflow := new(Workflow)
+	workflow.Add(
+		PipeTyped(fetch, parse),
+		// compose with other Upstreams of the Downstream
+		PipeTyped(fetch, echo).InputDependsOn(Adapt(suffix, func(_ context.Context, s *Function[struct{}, string], e *Function[string, string]) error {
+			e.Input += s.Output
+			return nil
+		})),
+	)
+	assert.Contains(t, workflow.UpstreamOf(parse), fetch)
+	assert.ElementsMatch(t, []Steper{fetch, suffix}, keys(workflow.UpstreamOf(echo)))
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, 5, parse.Output)
+	assert.Equal(t, "hello world", echo.Output)
+}
+
+type identifiedStep struct {
+	Steper
+	id string
+}
+
+func (s *identifiedStep) Unwrap() Steper { return s.Steper }
+func (s *identifiedStep) StepID() string { return s.id }
+
+func TestStepID(t *testing.T) {
+	var runs atomic.Int32
+	inner := Func("inner", func(ctx context.Context) error {
+		runs.Add(1)
+		return nil
+	})
+	first, second := &identifiedStep{inner, "inner"}, &identifiedStep{inner, "inner"}
+	down, byID := noopStep("down"), noopStep("by id")
+	anonymous1, anonymous2 := &identifiedStep{noopStep("anonymous"), ""}, &identifiedStep{noopStep("anonymous"), ""}
+	workflow := new(Workflow)
+	workflow.Add(
+		Step(first).Timeout(time.Minute),
+		Step(second).Group("dedup"),
+		Step(down).DependsOn(second),
+		Step(byID).DependsOnID("inner"),
+		Steps(anonymous1, anonymous2),
+	)
+	assert.ElementsMatch(t, []Steper{first, down, byID, anonymous1, anonymous2}, workflow.Steps())
+	assert.Nil(t, workflow.StateOf(second))
+	assert.Equal(t, []Steper{first}, keys(workflow.UpstreamOf(down)))
+	assert.Equal(t, []Steper{first}, keys(workflow.UpstreamOf(byID)))
+	option := workflow.StateOf(first).Option()
+	assert.Equal(t, time.Minute, *option.Timeout)
+	assert.Equal(t, "dedup", option.Group)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, int32(1), runs.Load())
+}
+
+func TestDependsOnID(t *testing.T) {
+	newStep := func(name string, order *[]string) *Function[struct{}, struct{}] {
+		return Func(name, func(ctx context.Context) error {
+			*order = append(*order, name)
+			return nil
+		})
+	}
+	t.Run("register before add", func(t *testing.T) {
+		var order []string
+		fetch, parse := newStep("fetch", &order), newStep("parse", &order)
+		workflow := new(Workflow)
+		workflow.Register("fetch", fetch)
+		workflow.Add(Step(parse).DependsOnID("fetch"))
+		assert.Contains(t, workflow.UpstreamOf(parse), fetch)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []string{"fetch", "parse"}, order)
+	})
+	t.Run("register after add", func(t *testing.T) {
+		var order []string
+		fetch, parse := newStep("fetch", &order), newStep("parse", &order)
+		workflow := new(Workflow)
+		workflow.Add(Step(parse).DependsOnID("fetch"))
+		workflow.Register("fetch", fetch)
+		assert.Equal(t, PhaseMain, workflow.PhaseOf(fetch))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []string{"fetch", "parse"}, order)
+	})
+	t.Run("unresolved id", func(t *testing.T) {
+		var order []string
+		parse := newStep("parse", &order)
+		workflow := new(Workflow)
+		workflow.Add(Step(parse).DependsOnID("fetch", "auth"))
+		err := workflow.Do(context.Background())
+		var unresolved ErrUnresolvedID
+		assert.ErrorAs(t, err, &unresolved)
+		assert.ElementsMatch(t, []string{"fetch", "auth"}, unresolved[parse])
+		assert.ErrorContains(t, err, "parse: [auth, fetch]")
+		assert.Empty(t, order)
+	})
+}
+
+func TestDependsOnPhase(t *testing.T) {
+	t.Run("gate on previous phase", func(t *testing.T) {
+		setupA := noopStep("setupA")
+		setupB := Func("setupB", func(ctx context.Context) error { return fmt.Errorf("setupB") })
+		gated, ungated := noopStep("gated"), noopStep("ungated")
+		workflow := new(Workflow)
+		workflow.Init(Step(setupA))
+		workflow.Add(Step(gated).DependsOnPhase(PhaseInit), Step(ungated))
+		workflow.Init(Step(setupB)) // added later
+		assert.ElementsMatch(t, []Steper{setupA, setupB}, keys(workflow.UpstreamOf(gated)))
+		assert.Contains(t, workflow.DownstreamOf(setupB), gated)
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, Skipped, workflow.StateOf(gated).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(ungated).GetStatus())
+	})
+	t.Run("gate on own phase", func(t *testing.T) {
+		var order []string
+		step := func(name string) Steper {
+			return Func(name, func(ctx context.Context) error {
+				order = append(order, name)
+				return nil
+			})
+		}
+		a, b, last := step("a"), step("b"), step("last")
+		workflow := new(Workflow).Add(Step(last).DependsOnPhase(PhaseMain), Pipe(a, b))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []string{"a", "b", "last"}, order)
+	})
+	t.Run("gate on each other is a cycle", func(t *testing.T) {
+		a, b := noopStep("a"), noopStep("b")
+		workflow := new(Workflow).Add(Steps(a, b).DependsOnPhase(PhaseMain))
+		assert.ErrorAs(t, workflow.Do(context.Background()), new(ErrCycleDependency))
+	})
+}
+
+func TestAdaptMultipleUpstreams(t *testing.T) {
+	name := FuncO("name", func(ctx context.Context) (string, error) { return "answer", nil })
+	value := FuncO("value", func(ctx context.Context) (int, error) { return 42, nil })
+	unit := FuncO("unit", func(ctx context.Context) (float64, error) { return 1.5, nil })
+	print := FuncIO("print", func(ctx context.Context, s string) (string, error) { return s, nil })
+	workflow := new(Workflow)
+	workflow.Add(
+		Step(print).InputDependsOn(
+			Adapt3(name, value, unit, func(_ context.Context,
+				n *Function[struct{}, string], v *Function[struct{}, int], u *Function[struct{}, float64],
+				p *Function[string, string],
+			) error {
+				p.Input = fmt.Sprintf("%s=%d*%.1f", n.Output, v.Output, u.Output)
+				return nil
+			}),
+		),
+	)
+	assert.ElementsMatch(t, []Steper{name, value, unit}, keys(workflow.UpstreamOf(print)))
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, "answer=42*1.5", print.Output)
+
+	two := FuncIO("two", func(ctx context.Context, s string) (string, error) { return s, nil })
+	workflow = new(Workflow)
+	workflow.Add(
+		Step(two).InputDependsOn(
+			Adapt2(name, value, func(_ context.Context, n *Function[struct{}, string], v *Function[struct{}, int], p *Function[string, string]) error {
+				p.Input = fmt.Sprintf("%s=%d", n.Output, v.Output)
+				return nil
+			}),
+		),
+	)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, "answer=42", two.Output)
+}
+
+func TestAdaptTypeMismatch(t *testing.T) {
+	name := FuncO("name", func(ctx context.Context) (string, error) { return "answer", nil })
+	value := FuncO("value", func(ctx context.Context) (int, error) { return 42, nil })
+	unit := FuncO("unit", func(ctx context.Context) (float64, error) { return 1.5, nil })
+	for _, tc := range []struct {
+		name  string
+		adapt Adapter[Steper]
+	}{
+		{"Adapt", Adapt(value, func(_ context.Context, v *Function[struct{}, int], p Steper) error {
+			return SetInput(p, v.Output)
+		})},
+		{"Adapt2", Adapt2(name, value, func(_ context.Context, _ *Function[struct{}, string], v *Function[struct{}, int], p Steper) error {
+			return SetInput(p, v.Output)
+		})},
+		{"Adapt3", Adapt3(name, value, unit, func(_ context.Context,
+			_ *Function[struct{}, string], v *Function[struct{}, int], _ *Function[struct{}, float64], p Steper,
+		) error {
+			return SetInput(p, v.Output)
+		})},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			print := FuncI("print", func(ctx context.Context, s string) error { return nil })
+			workflow := new(Workflow).Add(Step[Steper](print).InputDependsOn(tc.adapt))
+			err := workflow.Do(context.Background())
+			var mismatch ErrTypeMismatch
+			assert.ErrorAs(t, err, new(ErrInput))
+			if assert.ErrorAs(t, err, &mismatch) {
+				assert.Equal(t, print, mismatch.Step)
+				assert.Equal(t, reflect.TypeOf(""), mismatch.Expected)
+				assert.Equal(t, reflect.TypeOf(0), mismatch.Got)
+			}
+		})
+	}
+	t.Run("not a Function", func(t *testing.T) {
+		down := &fakeStep{Name: "down"}
+		assert.EqualError(t, SetInput(down, 42), "*flow.fakeStep(&{down}) has no Input, got int")
+		assert.NoError(t, SetInput(FuncI("number", func(ctx context.Context, n int) error { return nil }), 42))
+	})
+}
+
+func TestOptional(t *testing.T) {
+	telemetry := Func("telemetry", func(ctx context.Context) error { return fmt.Errorf("telemetry failed") })
+	down := noopStep("down")
+	onFailure := noopStep("on failure")
+	workflow := new(Workflow).Options(WithFailFast())
+	workflow.Add(
+		Step(telemetry).Optional(),
+		Step(down).DependsOn(telemetry),
+		Step(onFailure).DependsOnFailure(telemetry),
+	)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, Failed, workflow.StateOf(telemetry).GetStatus())
+	assert.ErrorContains(t, workflow.StateOf(telemetry).GetError(), "telemetry failed")
+	assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(onFailure).GetStatus())
+}
+
+func TestSequentialAndFullyConnect(t *testing.T) {
+	newSteps := func(prefix string, n int) []Steper {
+		steps := []Steper{}
+		for i := 0; i < n; i++ {
+			steps = append(steps, noopStep(fmt.Sprintf("%s%d", prefix, i)))
+		}
+		return steps
+	}
+	layerA, layerB, chain := newSteps("a", 2), newSteps("b", 3), newSteps("c", 3)
+	workflow := new(Workflow)
+	workflow.Add(
+		FullyConnect(layerA, layerB),
+		Sequential(chain),
+	)
+	for _, b := range layerB {
+		assert.ElementsMatch(t, layerA, keys(workflow.UpstreamOf(b)))
+	}
+	assert.Empty(t, workflow.UpstreamOf(chain[0]))
+	assert.ElementsMatch(t, chain[:1], keys(workflow.UpstreamOf(chain[1])))
+	assert.ElementsMatch(t, chain[1:2], keys(workflow.UpstreamOf(chain[2])))
+	assert.NoError(t, workflow.Do(context.Background()))
+}
+
+func TestLabels(t *testing.T) {
+	var fromCtx map[string]string
+	a := Func("a", func(ctx context.Context) error {
+		fromCtx = LabelsFrom(ctx)
+		return nil
+	})
+	b := noopStep("b")
+	workflow := new(Workflow).Add(
+		Step(a).Labels(map[string]string{"executor": "gpu", "team": "ml"}),
+		Step(a).Labels(map[string]string{"executor": "cpu"}),
+		Step(b).DependsOn(a),
+	)
+	assert.Equal(t, map[string]string{"executor": "cpu", "team": "ml"}, workflow.LabelsOf(a))
+	assert.Nil(t, workflow.LabelsOf(b))
+	assert.Nil(t, workflow.LabelsOf(Func("absent", nil)))
+	// labels are copies, modification doesn't affect the Workflow
+	workflow.LabelsOf(a)["team"] = "infra"
+	assert.Equal(t, "ml", workflow.LabelsOf(a)["team"])
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, map[string]string{"executor": "cpu", "team": "ml"}, fromCtx)
+	assert.Nil(t, LabelsFrom(context.Background()))
+}
+
+func TestCritical(t *testing.T) {
+	build := func() (workflow *Workflow, deploy, notify, slow Steper) {
+		deploy = Func("deploy", func(ctx context.Context) error { return fmt.Errorf("deploy failed") })
+		notify = Func("notify", func(ctx context.Context) error { return fmt.Errorf("notify failed") })
+		slow = Func("slow", func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		})
+		workflow = new(Workflow)
+		return
+	}
+	t.Run("critical Step fails fast", func(t *testing.T) {
+		workflow, deploy, _, slow := build()
+		workflow.Add(Step(deploy).Critical(), Step(slow))
+		err := workflow.Do(context.Background())
+		var failFast ErrFailFast
+		if assert.ErrorAs(t, err, &failFast) {
+			assert.Equal(t, deploy, failFast.Step)
+			assert.Equal(t, []Steper{slow}, failFast.Canceled())
+		}
+		assert.Equal(t, Canceled, workflow.StateOf(slow).GetStatus())
+	})
+	t.Run("ordinary Step runs to completion", func(t *testing.T) {
+		workflow, _, notify, slow := build()
+		workflow.Add(Step(notify), Step(slow))
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(slow).GetStatus())
+	})
+	t.Run("critical and optional", func(t *testing.T) {
+		workflow, deploy, _, slow := build()
+		workflow.Add(Step(deploy).Critical().Optional(), Step(slow))
+		err := workflow.Do(context.Background())
+		assert.Equal(t, Canceled, workflow.StateOf(slow).GetStatus())
+		var errWorkflow ErrWorkflow
+		if assert.ErrorAs(t, err, &errWorkflow) {
+			assert.NotContains(t, errWorkflow, deploy)
+		}
+	})
+}
+
+func TestTimedOutIsFailure(t *testing.T) {
+	wait := func(name string) Steper {
+		return Func(name, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+	t.Run("optional Step times out", func(t *testing.T) {
+		slow, down, onFailure := wait("slow"), noopStep("down"), noopStep("on failure")
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(slow).Optional().Timeout(10*time.Millisecond),
+			Step(down).DependsOn(slow),
+			Step(onFailure).DependsOnFailure(slow),
+		)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, TimedOut, workflow.StateOf(slow).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(onFailure).GetStatus())
+	})
+	t.Run("critical Step times out", func(t *testing.T) {
+		deploy, other := wait("deploy"), wait("other")
+		workflow := new(Workflow)
+		workflow.Add(Step(deploy).Critical().Timeout(10*time.Millisecond), Step(other))
+		err := workflow.Do(context.Background())
+		var failFast ErrFailFast
+		if assert.ErrorAs(t, err, &failFast) {
+			assert.Equal(t, deploy, failFast.Step)
+		}
+		assert.Equal(t, TimedOut, workflow.StateOf(deploy).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(other).GetStatus())
+	})
+	t.Run("AnyFailed", func(t *testing.T) {
+		slow, onFailure := wait("slow"), noopStep("on failure")
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(slow).Timeout(10*time.Millisecond),
+			Step(onFailure).DependsOn(slow).When(AnyFailed),
+		)
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(onFailure).GetStatus())
+	})
+}
+
+func TestWaitFor(t *testing.T) {
+	t.Run("wait until signaled", func(t *testing.T) {
+		var started atomic.Bool
+		ready := make(chan struct{})
+		build := noopStep("build")
+		deploy := Func("deploy", func(ctx context.Context) error {
+			started.Store(true)
+			return nil
+		})
+		workflow := new(Workflow).Add(Step(deploy).DependsOn(build).WaitFor(ready))
+		done := make(chan error)
+		go func() { done <- workflow.Do(context.Background()) }()
+		time.Sleep(50 * time.Millisecond)
+		assert.False(t, started.Load())
+		assert.Equal(t, Pending, workflow.StateOf(deploy).GetStatus())
+		close(ready)
+		assert.NoError(t, <-done)
+		assert.True(t, started.Load())
+	})
+	t.Run("sent value releases one Step", func(t *testing.T) {
+		ready := make(chan struct{}, 1)
+		ready <- struct{}{}
+		a := noopStep("a")
+		workflow := new(Workflow).Add(Step(a).WaitFor(ready))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(a).GetStatus())
+		assert.Empty(t, ready)
+	})
+	t.Run("canceled while waiting", func(t *testing.T) {
+		ready := make(chan struct{})
+		a := noopStep("a")
+		always := noopStep("always")
+		workflow := new(Workflow).Add(
+			Step(a).WaitFor(ready),
+			Step(always).When(Always).WaitFor(ready),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.Error(t, workflow.Do(ctx))
+		assert.Equal(t, Canceled, workflow.StateOf(a).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(always).GetStatus())
+	})
+}
+
+func TestLockOSThread(t *testing.T) {
+	locked := noopStep("locked")
+	panicked := Func("panicked", func(ctx context.Context) error { panic("boom") })
+	workflow := &Workflow{DontPanic: true}
+	workflow.Add(Steps(locked, panicked).LockOSThread())
+	assert.True(t, workflow.StateOf(locked).Option().LockOSThread)
+	assert.Error(t, workflow.Do(context.Background()))
+	assert.Equal(t, Succeeded, workflow.StateOf(locked).GetStatus())
+	assert.Equal(t, Failed, workflow.StateOf(panicked).GetStatus())
+}
+
+func TestRecoverPanic(t *testing.T) {
+	plugin := Func("plugin", func(ctx context.Context) error { panic("plugin bug") })
+	down := noopStep("down")
+	workflow := new(Workflow) // without DontPanic
+	workflow.Add(
+		Step(plugin).RecoverPanic(),
+		Step(down).DependsOn(plugin).When(Always),
+	)
+	assert.ErrorAs(t, workflow.Do(context.Background()), new(ErrPanic))
+	assert.Equal(t, Failed, workflow.StateOf(plugin).GetStatus())
+	assert.ErrorContains(t, workflow.StateOf(plugin).GetError(), "plugin bug")
+	assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+}
@@ -0,0 +1,71 @@
+package flow
+
+import (
+	"context"
+	"sync"
+)
+
+// Store is a key / value "blackboard" shared by Steps in a run of Workflow,
+// it's an alternative to passing Outputs by Input callbacks and Adapters.
+//
+// Workflow creates a Store for each Do, Steps access it by StoreFrom in Input and Do.
+// Nested Workflows share the Store of the outermost Workflow.
+//
+// Writes by Upstreams happen-before reads by Downstreams, because of the dependency ordering.
+// Steps running concurrently (i.e. siblings without dependency) must not rely on each other's writes.
+//
+//	Func("producer", func(ctx context.Context) error {
+//		StoreFrom(ctx).Set("answer", 42)
+//		return nil
+//	})
+//	Func("consumer", func(ctx context.Context) error {
+//		answer, ok := GetAs[int](StoreFrom(ctx), "answer")
+//		...
+//	})
+type Store struct {
+	mu     sync.RWMutex
+	values map[string]any
+}
+
+type storeKey struct{}
+
+// StoreFrom returns the Store of the running Workflow, returns nil if ctx is not from a Workflow.
+func StoreFrom(ctx context.Context) *Store {
+	s, _ := ctx.Value(storeKey{}).(*Store)
+	return s
+}
+
+// withStore attaches a new Store to ctx, unless ctx already has one from the outer Workflow.
+func withStore(ctx context.Context) context.Context {
+	if StoreFrom(ctx) != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, storeKey{}, &Store{values: make(map[string]any)})
+}
+
+// Set stores the value with the key, overwrites the existing value.
+func (s *Store) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+// Get returns the value of the key, and whether the key exists.
+func (s *Store) Get(key string) (any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.values[key]
+	return v, ok
+}
+
+// GetAs returns the value of the key as type T,
+// returns false if the key doesn't exist or the value is not a T.
+func GetAs[T any](s *Store, key string) (T, bool) {
+	v, ok := s.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	t, ok := v.(T)
+	return t, ok
+}
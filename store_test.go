@@ -0,0 +1,95 @@
+package flow
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	assert.Nil(t, StoreFrom(context.Background()))
+
+	var answer int
+	var existed, wrongType bool
+	producer := Func("producer", func(ctx context.Context) error {
+		_, existed = StoreFrom(ctx).Get("answer")
+		StoreFrom(ctx).Set("answer", 42)
+		return nil
+	})
+	consumer := Func("consumer", func(ctx context.Context) error {
+		answer, _ = GetAs[int](StoreFrom(ctx), "answer")
+		_, ok := GetAs[string](StoreFrom(ctx), "answer")
+		wrongType = !ok
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		answer = 0
+		inner := new(Workflow).Add(Step(consumer))
+		workflow := new(Workflow).Add(Step(inner).DependsOn(producer))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.False(t, existed, "each Do has a new Store")
+		assert.Equal(t, 42, answer, "nested Workflow shares the Store")
+		assert.True(t, wrongType)
+	}
+}
+
+func TestInputFromStore(t *testing.T) {
+	newSteps := func() (*Function[struct{}, struct{}], *Function[string, string]) {
+		login := Func("login", func(ctx context.Context) error {
+			StoreFrom(ctx).Set("token", "secret")
+			return nil
+		})
+		call := FuncIO("call", func(ctx context.Context, token string) (string, error) {
+			return "called with " + token, nil
+		})
+		return login, call
+	}
+	t.Run("read from Upstream", func(t *testing.T) {
+		login, call := newSteps()
+		workflow := new(Workflow).Add(
+			Step(login).Writes("token"),
+			InputFromStore("token", call).DependsOn(login),
+		)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, "called with secret", call.Output)
+	})
+	t.Run("written by previous phase", func(t *testing.T) {
+		login, call := newSteps()
+		workflow := new(Workflow)
+		workflow.Init(Step(login).Writes("token"))
+		workflow.Add(InputFromStore("token", call))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, "called with secret", call.Output)
+	})
+	t.Run("no Upstream writes the key", func(t *testing.T) {
+		login, call := newSteps()
+		workflow := new(Workflow).Add(
+			Step(login).Writes("token"),
+			InputFromStore("token", call), // not depends on login
+		)
+		var notWritten ErrStoreKeyNotWritten
+		assert.ErrorAs(t, workflow.Do(context.Background()), &notWritten)
+		assert.Equal(t, []string{"token"}, notWritten[call])
+	})
+	t.Run("value of wrong type", func(t *testing.T) {
+		login := Func("login", func(ctx context.Context) error {
+			StoreFrom(ctx).Set("token", 42)
+			return nil
+		})
+		_, call := newSteps()
+		workflow := new(Workflow).Add(
+			Step(login).Writes("token"),
+			InputFromStore("token", call).DependsOn(login),
+		)
+		err := workflow.Do(context.Background())
+		var mismatch ErrTypeMismatch
+		assert.ErrorAs(t, err, new(ErrInput))
+		assert.ErrorAs(t, err, &mismatch)
+		assert.Equal(t, call, mismatch.Step)
+		assert.Equal(t, reflect.TypeOf(""), mismatch.Expected)
+		assert.Equal(t, reflect.TypeOf(0), mismatch.Got)
+		assert.EqualError(t, mismatch, "Input of call expects string, got int")
+	})
+}
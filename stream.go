@@ -0,0 +1,149 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrStreamStopped is returned from send of StreamStep when a consumer stopped the stream, see StreamStep.Range.
+var ErrStreamStopped = errors.New("stream stopped by consumer")
+
+// Stream creates a StreamStep sending values of type T to its Downstreams incrementally,
+// for pipeline topologies that Downstreams consume partial results before the Step completes.
+//
+//	lines := Stream("read", func(ctx context.Context, send func(string) error) error {
+//		for scanner.Scan() {
+//			if err := send(scanner.Text()); err != nil {
+//				return err
+//			}
+//		}
+//		return scanner.Err()
+//	})
+//	count := Func("count", func(ctx context.Context) error {
+//		return lines.Range(ctx, func(line string) error { n++; return nil })
+//	})
+//	workflow.Add(Step(count).DependsOn(lines))
+//
+// Downstreams of a StreamStep start once the stream opens, i.e. the StreamStep is Running,
+// rather than waiting for it to terminate. The open stream is not passed to the Downstream's Condition,
+// a Downstream starting after the StreamStep terminated is decided by Condition as usual.
+//
+// Values are delivered to consumers calling Range, multiple consumers share the values, each value is received once.
+// Send blocks until a consumer receives the value (or the buffer, see Buffer), so the stream is back-pressured.
+// Don't Retry a StreamStep, the values sent by previous attempts are not replayed.
+func Stream[T any](name string, do func(ctx context.Context, send func(T) error) error) *StreamStep[T] {
+	return &StreamStep[T]{Name: name, DoFunc: do}
+}
+
+// StreamStep sends values to its Downstreams incrementally, see Stream.
+type StreamStep[T any] struct {
+	Name   string
+	DoFunc func(ctx context.Context, send func(T) error) error
+	Buffer int // Buffer is the size of the channel buffer, default (0) means unbuffered
+
+	mu        sync.Mutex
+	ch        chan T
+	stop      chan struct{} // closed when a consumer stopped the stream
+	stopOnce  *sync.Once
+	err       error // error returned from DoFunc in current run
+	streaming bool  // the stream is open in current run
+}
+
+func (s *StreamStep[T]) String() string { return s.Name }
+
+func (s *StreamStep[T]) Do(ctx context.Context) error {
+	ch, stop := make(chan T, s.Buffer), make(chan struct{})
+	s.mu.Lock()
+	s.ch, s.stop, s.stopOnce, s.err, s.streaming = ch, stop, new(sync.Once), nil, true
+	s.mu.Unlock()
+	// the stream is open, tick the Workflow to start Downstreams
+	if sc := stepContextFrom(ctx); sc != nil {
+		sc.workflow.tryTick()
+	}
+	var err error
+	if s.DoFunc != nil {
+		err = s.DoFunc(ctx, func(v T) error {
+			select {
+			case ch <- v:
+				return nil
+			case <-stop:
+				return ErrStreamStopped
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+	s.mu.Lock()
+	s.err, s.streaming = err, false
+	s.mu.Unlock()
+	close(ch)
+	return err
+}
+
+// Range calls fn with each value sent by the StreamStep in current run, until the stream is closed.
+//
+// Range returns
+//   - the error from fn, then the stream is stopped, the StreamStep receives ErrStreamStopped from send,
+//   - the error of the StreamStep once the stream is closed, nil if the StreamStep succeeded,
+//   - ctx.Err() if ctx is done.
+//
+// Range should be called by Downstreams of the StreamStep, it returns nil if the stream never opened.
+func (s *StreamStep[T]) Range(ctx context.Context, fn func(T) error) error {
+	s.mu.Lock()
+	ch, stop, stopOnce := s.ch, s.stop, s.stopOnce
+	s.mu.Unlock()
+	if ch == nil {
+		return nil
+	}
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				if s.err != nil {
+					return fmt.Errorf("stream %s: %w", s.Name, s.err)
+				}
+				return nil
+			}
+			if err := fn(v); err != nil {
+				stopOnce.Do(func() { close(stop) })
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *StreamStep[T]) isStreaming() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streaming
+}
+
+// isOpenStream reports whether the Step is a StreamStep (or decorates one) with the stream open.
+func isOpenStream(step Steper) bool {
+	for step != nil {
+		if s, ok := step.(interface{ isStreaming() bool }); ok {
+			return s.isStreaming()
+		}
+		u, ok := step.(interface{ Unwrap() Steper })
+		if !ok {
+			return false
+		}
+		step = u.Unwrap()
+	}
+	return false
+}
+
+// openStreams removes the Running Upstreams with open streams, so the Step is able to start consuming them, see Stream.
+func openStreams(ups map[Steper]StatusError) {
+	for up, statusErr := range ups {
+		if statusErr.Status == Running && isOpenStream(up) {
+			delete(ups, up)
+		}
+	}
+}
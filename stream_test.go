@@ -0,0 +1,86 @@
+package flow
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	numbers := func(n int) *StreamStep[int] {
+		return Stream("numbers", func(ctx context.Context, send func(int) error) error {
+			for i := 1; i <= n; i++ {
+				if err := send(i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	t.Run("consume while streaming", func(t *testing.T) {
+		// the stream is unbuffered, it never completes if the consumer waits for it to terminate
+		stream := numbers(5)
+		sum := 0
+		consumer := Func("sum", func(ctx context.Context) error {
+			return stream.Range(ctx, func(v int) error {
+				sum += v
+				return nil
+			})
+		})
+		after := noopStep("after")
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(consumer).DependsOn(stream),
+			Step(after).DependsOn(consumer),
+		)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, 15, sum)
+		assert.Equal(t, Succeeded, workflow.StateOf(stream).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(after).GetStatus())
+	})
+	t.Run("stream failed", func(t *testing.T) {
+		stream := Stream("broken", func(ctx context.Context, send func(int) error) error {
+			if err := send(1); err != nil {
+				return err
+			}
+			return assert.AnError
+		})
+		consumer := Func("consumer", func(ctx context.Context) error {
+			return stream.Range(ctx, func(int) error { return nil })
+		})
+		workflow := new(Workflow)
+		workflow.Add(Step(consumer).DependsOn(stream))
+		err := workflow.Do(context.Background())
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.Equal(t, Failed, workflow.StateOf(stream).GetStatus())
+		assert.Equal(t, Failed, workflow.StateOf(consumer).GetStatus())
+	})
+	t.Run("consumer stops the stream", func(t *testing.T) {
+		stream := numbers(100)
+		consumer := Func("consumer", func(ctx context.Context) error {
+			return stream.Range(ctx, func(v int) error {
+				if v == 3 {
+					return assert.AnError
+				}
+				return nil
+			})
+		})
+		workflow := new(Workflow)
+		workflow.Add(Step(consumer).DependsOn(stream))
+		err := workflow.Do(context.Background())
+		assert.ErrorIs(t, err, ErrStreamStopped)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+	t.Run("stream skipped", func(t *testing.T) {
+		stream := numbers(1)
+		consumer := noopStep("consumer")
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(stream).When(func(context.Context, map[Steper]StatusError) StepStatus { return Skipped }),
+			Step(consumer).DependsOn(stream),
+		)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, Skipped, workflow.StateOf(consumer).GetStatus())
+	})
+}
@@ -0,0 +1,101 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Suspend returns ErrSuspended carrying the partial state of the Step, see Workflow.Suspend.
+//
+//	Func("long", func(ctx context.Context) error {
+//		offset := 0
+//		if state, ok := SuspendedState(ctx); ok {
+//			offset, _ = strconv.Atoi(string(state)) // resume from the partial state
+//		}
+//		for ; offset < total; offset++ {
+//			if ShouldSuspend(ctx) {
+//				return Suspend([]byte(strconv.Itoa(offset)))
+//			}
+//			...
+//		}
+//		return nil
+//	})
+func Suspend(state []byte) ErrSuspended { return ErrSuspended{State: state} }
+
+// ErrSuspended is returned by a Step to park itself with its partial state, the Step becomes Suspended.
+type ErrSuspended struct{ State []byte }
+
+func (e ErrSuspended) Error() string { return "step suspended" }
+
+// ErrWorkflowSuspended is returned by Do if the Workflow stopped with Suspended Steps, see Workflow.Suspend.
+type ErrWorkflowSuspended struct{ Steps []Steper }
+
+func (e ErrWorkflowSuspended) Error() string {
+	names := make([]string, 0, len(e.Steps))
+	for _, step := range e.Steps {
+		names = append(names, String(step))
+	}
+	return fmt.Sprintf("workflow suspended with Steps: [%s]", strings.Join(names, ", "))
+}
+
+// Suspend asks the running Workflow to suspend cooperatively, for checkpointing long running Steps.
+//
+// Once suspending, the Workflow starts no new Step, running Steps check ShouldSuspend(ctx) periodically,
+// and return Suspend(partialState) to be parked as Suspended, which is neither terminated nor running.
+// Steps not checking ShouldSuspend run to completion as usual.
+// A Step returning Suspend without being asked suspends the Workflow as well.
+// Do returns ErrWorkflowSuspended once no Step is running, then the caller is able to SaveCheckpoint,
+// the partial states are saved along with the Suspended status.
+//
+// Resume the Workflow by Resume, or LoadCheckpoint into a new Workflow then Do,
+// the Suspended Steps restart with their partial states, see SuspendedState.
+func (w *Workflow) Suspend() {
+	w.suspending.Store(true)
+	if w.oneStepTerminated != nil {
+		w.tryTick()
+	}
+}
+
+// Resume continues the Workflow stopped with Suspended Steps (see Suspend),
+// Suspended Steps restart with their partial states, Steps terminated in previous runs keep their statuses.
+func (w *Workflow) Resume(ctx context.Context) error { return w.do(ctx, nil, true) }
+
+// ShouldSuspend returns true if the Workflow running the Step is asked to suspend, see Workflow.Suspend.
+// Nested Workflows follow the outermost one.
+func ShouldSuspend(ctx context.Context) bool {
+	for sc := stepContextFrom(ctx); sc != nil; sc = sc.parent {
+		if sc.workflow.suspending.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// SuspendedState returns the partial state the Step saved when it was Suspended last time, see Suspend.
+func SuspendedState(ctx context.Context) ([]byte, bool) {
+	sc := stepContextFrom(ctx)
+	if sc == nil {
+		return nil, false
+	}
+	state := sc.workflow.StateOf(sc.step)
+	if state == nil {
+		return nil, false
+	}
+	state.RLock()
+	defer state.RUnlock()
+	return state.partial, state.partial != nil
+}
+
+// suspended returns the Suspended root Steps sorted by name.
+func (w *Workflow) suspended() []Steper {
+	var steps []Steper
+	for step, state := range w.state {
+		if state.GetStatus() == Suspended {
+			steps = append(steps, step)
+		}
+	}
+	slices.SortFunc(steps, func(a, b Steper) int { return strings.Compare(String(a), String(b)) })
+	return steps
+}
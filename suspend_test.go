@@ -0,0 +1,81 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuspend(t *testing.T) {
+	const total = 10
+	type run struct{ from, to int }
+	// build a Workflow with a long Step counting to total, it asks to suspend at suspendAt
+	build := func(suspendAt int, runs *[]run) (workflow *Workflow, long, after Steper) {
+		workflow = new(Workflow)
+		long = Func("long", func(ctx context.Context) error {
+			i := 0
+			if state, ok := SuspendedState(ctx); ok {
+				i, _ = strconv.Atoi(string(state))
+			}
+			from := i
+			for ; i < total; i++ {
+				if i == suspendAt && i != from {
+					workflow.Suspend()
+				}
+				if ShouldSuspend(ctx) {
+					*runs = append(*runs, run{from, i})
+					return Suspend([]byte(strconv.Itoa(i)))
+				}
+			}
+			*runs = append(*runs, run{from, i})
+			return nil
+		})
+		after = noopStep("after")
+		workflow.Add(Step(after).DependsOn(long))
+		return
+	}
+	t.Run("suspend and resume", func(t *testing.T) {
+		var runs []run
+		workflow, long, after := build(4, &runs)
+		err := workflow.Do(context.Background())
+		assert.Equal(t, ErrWorkflowSuspended{Steps: []Steper{long}}, err)
+		assert.Equal(t, Suspended, workflow.StateOf(long).GetStatus())
+		assert.Equal(t, Pending, workflow.StateOf(after).GetStatus())
+
+		assert.NoError(t, workflow.Resume(context.Background()))
+		assert.Equal(t, []run{{0, 4}, {4, total}}, runs)
+		assert.Equal(t, Succeeded, workflow.StateOf(long).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(after).GetStatus())
+	})
+	t.Run("suspended by Step itself", func(t *testing.T) {
+		parked := Func("parked", func(ctx context.Context) error {
+			if _, ok := SuspendedState(ctx); ok {
+				return nil
+			}
+			return Suspend([]byte("partial"))
+		})
+		after := noopStep("after")
+		workflow := new(Workflow)
+		workflow.Add(Step(after).DependsOn(parked))
+		assert.Equal(t, ErrWorkflowSuspended{Steps: []Steper{parked}}, workflow.Do(context.Background()))
+		assert.NoError(t, workflow.Resume(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(after).GetStatus())
+	})
+	t.Run("resume from checkpoint", func(t *testing.T) {
+		var runs []run
+		workflow, _, _ := build(6, &runs)
+		assert.ErrorAs(t, workflow.Do(context.Background()), new(ErrWorkflowSuspended))
+		var buf bytes.Buffer
+		assert.NoError(t, workflow.SaveCheckpoint(&buf))
+
+		restored, long, after := build(-1, &runs)
+		assert.NoError(t, restored.LoadCheckpoint(&buf))
+		assert.NoError(t, restored.Do(context.Background()))
+		assert.Equal(t, []run{{0, 6}, {6, total}}, runs)
+		assert.Equal(t, Succeeded, restored.StateOf(long).GetStatus())
+		assert.Equal(t, Succeeded, restored.StateOf(after).GetStatus())
+	})
+}
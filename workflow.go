@@ -4,10 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"math/rand"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"golang.org/x/time/rate"
 )
 
 // Workflow represents a collection of connected Steps that form a directed acyclic graph (DAG).
@@ -29,18 +36,69 @@ import (
 // Workflow supports Workflow-level configuration,   check WorkflowOption for details.
 // Workflow supports executing Steps phase in phase, check Phase for details.
 // Workflow supports Nested Steps,				     check Is(), As() and StepTree for details.
+//
+// Workflow itself is also a Step, a nested Workflow is orchestrated as a single Step by its outer Workflow,
+// and runs with its own configuration, i.e. WithMaxConcurrency.
 type Workflow struct {
 	tree  StepTree              // tree of Nested / Wrapped Steps, only root Steps are used in the below fields
 	state map[Steper]*State     // the internal states of Steps
 	steps map[Phase]Set[Steper] // all Steps grouped in phases
 
-	leaseBucket       chan struct{}  // constraint max concurrency of running Steps
-	waitGroup         sync.WaitGroup // to prevent goroutine leak
-	isRunning         sync.Mutex     // indicate whether the Workflow is running
-	oneStepTerminated chan struct{}  // signals for next tick
-	clock             clock.Clock    // clock for unit test
-	notify            []Notify       // notify before and after Step
-	DontPanic         bool           // whether recover panic from Step(s)
+	leaseBucket       chan struct{}             // constraint max concurrency of running Steps
+	phaseLeaseBuckets map[Phase]chan struct{}   // constraint max concurrency of running Steps in each phase
+	phaseTimeouts     map[Phase]phaseTimeout    // max duration of each phase, see WithPhaseTimeout
+	phasePolicies     map[Phase]PhasePolicy     // what to do with the phase if previous phases failed, see WithPhaseOnFailure
+	afterPhases       []AfterPhase              // called once each phase terminated, see WithAfterPhase
+	phasesDone        Set[Phase]                // phases the AfterPhase callbacks are called in current run, only accessed by tick
+	phaseCtx          map[Phase]context.Context // context of each started phase in current run, only accessed by tick
+	phaseTimers       []*clock.Timer            // timers of phase timeouts in current run
+	queueLeaseBuckets map[string]chan struct{}  // constraint max concurrency of running Steps in each queue, see WithQueue
+	groupLeaseBuckets map[string]chan struct{}  // constraint max concurrency of running Steps in each group, see WithGroupConcurrency
+	waitGroup         sync.WaitGroup            // to prevent goroutine leak
+	isRunning         sync.Mutex                // indicate whether the Workflow is running
+	running           atomic.Bool               // whether Do is running, for observers not to contend isRunning, see CurrentPhase
+	oneStepTerminated chan struct{}             // signals for next tick
+	inflight          atomic.Int32              // number of running Step goroutines, see stuck
+	clock             clock.Clock               // clock for unit test
+	notify            []Notify                  // notify before and after Step
+	reporters         []Reporter                // report Steps start and end by id, see WithReporter
+	onIdle            []func(pending []Steper)  // called once the Workflow becomes idle, see WithOnIdle
+	middlewares       []StepMiddleware          // wrap every Step's Do
+	rateLimiters      map[string]*rate.Limiter  // rate limiters shared by Steps with the same key
+	statusMappers     []func(error) StepStatus  // map error from Step to terminal status
+	isCanceledFunc    func(error) bool          // regard error from Step as canceled, see WithIsCanceled
+	errorTransformers []ErrorTransformer        // transform error from Step before it's recorded
+	ids               map[string]Steper         // registered Steps by id, see Register
+	maxStartJitter    time.Duration             // max random delay before Steps start
+	timeoutJitter     float64                   // max fraction to spread the Timeout of Steps, see WithStepTimeoutJitter
+	rand              func(n int64) int64       // random number in [0, n), see WithRand
+	faultInjector     FaultInjector             // induce faults before Steps' Do, testing only, see WithFaultInjector
+	leaseTimeout      time.Duration             // max duration to wait for a lease, see WithLeaseTimeout
+	cancelGrace       time.Duration             // max duration to wait for a Step to return after canceled, see WithCancelGracePeriod
+	executor          func(fn func())           // run Steps, see WithExecutor
+	maxSteps          int                       // max number of root Steps, see WithMaxSteps
+	maxDynamic        int                       // max number of Steps added while running, see WithDynamicSteps
+	dynamicAdded      int                       // number of Steps added while running in current run
+	dynamic           []dependency              // added by AddDependency, not applied yet
+	dynamicMu         sync.Mutex                // guards dynamic and dynamicAdded
+	topology          sync.RWMutex              // guards tree, state and steps changed by AddDependency during Do, see applyDynamic
+	added             int                       // number of adders ever added, to order Steps by insertion, see Parents
+	maxCost           float64                   // max total cost of started Steps, see WithMaxCost
+	spent             float64                   // total cost of started Steps in current run, only accessed by tick
+	terminated        atomic.Int32              // number of Steps terminated in current run, see ErrWorkflow.Summary
+	errTooManySteps   *ErrTooManySteps          // the first Step refused by maxSteps, reported by Do
+	events            *eventQueue               // status transitions of Steps, see Run
+	recorder          *Recorder                 // records status transitions of Steps with timestamps, see WithRecorder
+	cache             Cache                     // caches the Outputs of Functions across runs, see WithCache
+	results           map[Steper][]onResult     // callbacks after Steps terminated, see OnResult
+	only              Set[Steper]               // run only these Steps and their Upstreams, see Only
+	without           Set[Steper]               // not run these Steps and their Downstreams, see Without
+	DontPanic         bool                      // whether recover panic from Step(s)
+	FailFast          bool                      // whether cancel the Workflow once a Step Failed
+	skipPropagation   bool                      // whether Skipped Upstreams skip their Downstreams, see WithSkipPropagation
+	strictReach       bool                      // whether Do fails if any Step is unreachable, see WithStrictReachability
+	cancel            context.CancelCauseFunc   // cancel the running Workflow with cause, see WithFailFast and Abort
+	suspending        atomic.Bool               // whether the Workflow is asked to suspend, see Suspend
 }
 
 // Add Steps into Workflow in phase Main.
@@ -68,6 +126,7 @@ func (w *Workflow) PhaseAdd(phase Phase, was ...WorkflowAdder) *Workflow {
 	}
 	for _, wa := range was {
 		if wa != nil {
+			w.added++ // Steps in the same adder are added together, see Parents
 			for step, config := range wa.Done() {
 				w.addStep(phase, step, config)
 			}
@@ -76,15 +135,30 @@ func (w *Workflow) PhaseAdd(phase Phase, was ...WorkflowAdder) *Workflow {
 	return w
 }
 
-// AddStep adds a Step into Workflow with the given phase and config.
-func (w *Workflow) addStep(phase Phase, step Steper, config *StepConfig) {
+// AddStep adds a Step into Workflow with the given phase and config,
+// returns false if the Step is refused by WithMaxSteps.
+func (w *Workflow) addStep(phase Phase, step Steper, config *StepConfig) bool {
 	if step == nil {
-		return
+		return false
+	}
+	step = w.canonical(step)
+	if w.maxSteps > 0 && w.StateOf(step) == nil && len(w.state) >= w.maxSteps {
+		// refuse the new Step with its config, and report the first refused one in Do
+		if w.errTooManySteps == nil {
+			w.errTooManySteps = &ErrTooManySteps{Step: step, Max: w.maxSteps}
+		}
+		return false
 	}
 	w.steps[phase].Add(step)
 	if w.StateOf(step) == nil {
 		// the step is new, it becomes a new root
-		w.state[step] = new(State)
+		w.state[step] = &State{seq: w.added}
+		if ider, ok := step.(StepIDer); ok && ider.StepID() != "" && w.ids[ider.StepID()] == nil {
+			if w.ids == nil {
+				w.ids = make(map[string]Steper)
+			}
+			w.ids[ider.StepID()] = step
+		}
 		// add the new root (and all its descendant steps) to the tree,
 		// tree.Add() returns all old roots in descendant steps.
 		// we need to replace them with the new root.
@@ -108,7 +182,77 @@ func (w *Workflow) addStep(phase Phase, step Steper, config *StepConfig) {
 		config.Upstreams = nil
 		// merge config to the state in the lowest workflow
 		w.StateOf(step).MergeConfig(config)
+		w.resolveUpstreamIDs(w.RootOf(step))
+	}
+	return true
+}
+
+// Register associates the id with the Step, then Steps could depend on it by id, see DependsOnID.
+//
+// The Step doesn't have to be added into Workflow before,
+// it will be added into the same phase of its Downstreams, like DependsOn.
+// Register the same id again overrides the previous one, but resolved dependencies are not affected.
+func (w *Workflow) Register(id string, step Steper) {
+	if step == nil {
+		return
+	}
+	if w.ids == nil {
+		w.ids = make(map[string]Steper)
+	}
+	w.ids[id] = step
+	roots := []Steper{}
+	for root := range w.state {
+		roots = append(roots, root)
+	}
+	for _, root := range roots {
+		w.resolveUpstreamIDs(root)
+	}
+}
+
+// idOf returns the stable id of the Step, in the order of
+//   - StepID, see StepIDer,
+//   - the id registered by Register, the smallest one if registered multiple times,
+//   - the name of the Step, see String.
+func (w *Workflow) idOf(step Steper) string {
+	if ider, ok := step.(StepIDer); ok && ider.StepID() != "" {
+		return ider.StepID()
+	}
+	found := ""
+	for id, registered := range w.ids {
+		if registered == step && (found == "" || id < found) {
+			found = id
+		}
+	}
+	if found != "" {
+		return found
+	}
+	return String(step)
+}
+
+// resolveUpstreamIDs resolves the registered ids the root Step depends on.
+func (w *Workflow) resolveUpstreamIDs(root Steper) {
+	state := w.state[root]
+	if state == nil || state.Config == nil {
+		return
+	}
+	for id := range state.Config.UpstreamIDs {
+		if up, ok := w.ids[id]; ok {
+			delete(state.Config.UpstreamIDs, id)
+			w.setUpstream(w.PhaseOf(root), root, up)
+		}
+	}
+}
+
+// canonical returns the Step in Workflow with the same StepID, or the step itself, see StepIDer.
+func (w *Workflow) canonical(step Steper) Steper {
+	ider, ok := step.(StepIDer)
+	if !ok || ider.StepID() == "" {
+		return step
+	}
+	if existing := w.ids[ider.StepID()]; existing != nil && existing != step && w.StateOf(existing) != nil {
+		return existing
 	}
+	return step
 }
 
 // setUpstreams will put the upstreams into proper state.
@@ -116,9 +260,12 @@ func (w *Workflow) setUpstream(phase Phase, step, up Steper) {
 	if step == nil || up == nil {
 		return
 	}
+	step, up = w.canonical(step), w.canonical(up)
 	// just add the upstream step to the phase
 	// even upstream already in, we still need add it to the phase
-	w.addStep(phase, up, nil)
+	if !w.addStep(phase, up, nil) {
+		return // the upstream is refused by WithMaxSteps, so is the dependency, Do will report it
+	}
 	if w.StateOf(up) == nil { // the upstream is not in the Workflow
 		w.StateOf(w.RootOf(step)).AddUpstream(up)
 		return
@@ -146,6 +293,539 @@ func (w *Workflow) setUpstream(phase Phase, step, up Steper) {
 	w.StateOf(ancestor).AddUpstream(up)
 }
 
+// SetCondition overrides the Condition of the Step after it's added, nil means DefaultCondition.
+//
+// It's useful in tests to force a Step to run regardless of its Upstreams' statuses, without rebuilding the Workflow.
+//
+//	workflow := buildRealWorkflow()
+//	workflow.SetCondition(rollback, Always)
+//
+// The expected statuses set by DependsOnStatus are overridden as well, the Condition decides with all Upstreams.
+// The Condition is set to the root Step, if the Step is wrapped in another one.
+//
+// SetCondition returns error if the Workflow is running, or the Step is not in the Workflow.
+func (w *Workflow) SetCondition(step Steper, cond Condition) error {
+	if !w.isRunning.TryLock() {
+		return ErrWorkflowIsRunning
+	}
+	defer w.isRunning.Unlock()
+	state := w.StateOf(step)
+	if state == nil {
+		return ErrStepNotInWorkflow{Step: step}
+	}
+	state.MergeConfig(&StepConfig{Option: func(so *StepOption) {
+		so.Condition = cond
+		so.UpstreamStatus = nil
+	}})
+	return nil
+}
+
+// Replace swaps the root Step old with new in Workflow,
+// new inherits the phase, config (dependency, input, option) and downstream Steps of old.
+//
+// It's useful in tests to stub out a Step, i.e. the one calling external services.
+//
+//	workflow := buildRealWorkflow()
+//	workflow.Replace(callAPI, Func("stub", func(ctx context.Context) error { return nil }))
+//
+// Steps depending on old (or Steps wrapped in old) will depend on new instead.
+// Be aware that Input callbacks capturing old (i.e. from InputDependsOn) still refer to old.
+//
+// Replace returns error if the Workflow is running, or old is not a root Step in the Workflow.
+func (w *Workflow) Replace(old, new Steper) error {
+	if !w.isRunning.TryLock() {
+		return ErrWorkflowIsRunning
+	}
+	defer w.isRunning.Unlock()
+	if w.empty() || old == nil || w.tree[old] == nil {
+		return ErrStepNotInWorkflow{Step: old}
+	}
+	if !w.tree.IsRoot(old) {
+		return fmt.Errorf("only root Step can be replaced, %s is wrapped in %s", String(old), String(w.RootOf(old)))
+	}
+	if new == nil {
+		return fmt.Errorf("can not replace %s with nil Step", String(old))
+	}
+	if old == new {
+		return nil
+	}
+	if w.tree[new] != nil {
+		return fmt.Errorf("can not replace %s with %s, it's already in Workflow", String(old), String(new))
+	}
+	// remove old and its descendants from the tree
+	removed := make(Set[Steper])
+	for step := range w.tree {
+		if w.tree.RootOf(step) == old {
+			removed.Add(step)
+		}
+	}
+	for step := range removed {
+		delete(w.tree, step)
+	}
+	// new takes over the state and phase of old
+	w.state[new] = w.state[old]
+	delete(w.state, old)
+	for _, steps := range w.steps {
+		if steps.Has(old) {
+			steps.Add(new)
+			delete(steps, old)
+		}
+	}
+	// add new to the tree, same as addStep, the old roots wrapped in new are merged into new
+	for root := range w.tree.Add(new) {
+		w.state[new].MergeConfig(w.state[root].Config)
+		delete(w.state, root)
+		for _, steps := range w.steps {
+			if steps.Has(root) {
+				steps.Add(new)
+				delete(steps, root)
+			}
+		}
+	}
+	// redirect dependencies on old to new
+	for id, step := range w.ids {
+		if removed.Has(step) {
+			w.ids[id] = new
+		}
+	}
+	for step, state := range w.state {
+		ups := state.Upstreams()
+		redirected := false
+		for up := range ups {
+			if removed.Has(up) {
+				delete(ups, up)
+				if step != new {
+					ups.Add(new)
+					redirected = true
+				}
+			}
+		}
+		if redirected {
+			// expected statuses (see DependsOnStatus) are keyed by the Upstreams, redirect them as well
+			state.Config.AddOption(func(so *StepOption) {
+				for up, statuses := range so.UpstreamStatus {
+					if removed.Has(up) {
+						delete(so.UpstreamStatus, up)
+						so.UpstreamStatus[new] = append(so.UpstreamStatus[new], statuses...)
+					}
+				}
+			})
+		}
+	}
+	return nil
+}
+
+// Merge folds the Steps of other into the Workflow, flattening both into one DAG,
+// it's different from nesting other as a Step.
+//
+// The Steps keep their phases, dependencies, inputs and options, and the ids registered in other are registered as well,
+// so Steps could depend on Steps across the two Workflows afterwards, see DependsOn and DependsOnID.
+// The Workflow level options (i.e. WithMaxConcurrency) and the statuses of Steps in other are not merged.
+//
+// Steps in both Workflows are merged as if they are added twice.
+// Merge returns error without modifying the Workflow, if
+//   - either Workflow is running,
+//   - a Step is in different phases in the two Workflows,
+//   - a Step has different options in the two Workflows, i.e. Timeout, Queue, Group,
+//   - an id is registered to different Steps in the two Workflows.
+//
+// other is not modified, but the Steps are shared, don't run both Workflows concurrently.
+func (w *Workflow) Merge(other *Workflow) error {
+	if other == nil || other == w {
+		return nil
+	}
+	if !w.isRunning.TryLock() {
+		return ErrWorkflowIsRunning
+	}
+	defer w.isRunning.Unlock()
+	if !other.isRunning.TryLock() {
+		return ErrWorkflowIsRunning
+	}
+	defer other.isRunning.Unlock()
+	// detect conflicts before modifying the Workflow
+	for id, step := range other.ids {
+		if registered, ok := w.ids[id]; ok && registered != step {
+			return fmt.Errorf("can not merge, id %q is registered to both %s and %s", id, String(registered), String(step))
+		}
+	}
+	for step, state := range other.state {
+		existing := w.state[step]
+		if existing == nil {
+			continue
+		}
+		if phase, otherPhase := w.PhaseOf(step), other.PhaseOf(step); phase != otherPhase {
+			return fmt.Errorf("can not merge, %s is in both phase %s and %s", String(step), phase, otherPhase)
+		}
+		if option := conflictOption(existing.Option(), state.Option()); option != "" {
+			return fmt.Errorf("can not merge, %s has different %s", String(step), option)
+		}
+	}
+	// register ids before adding Steps, so the Steps depend on ids are resolved
+	for id, step := range other.ids {
+		if w.ids == nil {
+			w.ids = make(map[string]Steper)
+		}
+		w.ids[id] = step
+	}
+	// Upstreams pulled into multiple phases are in other.steps of each phase, only merge the config once
+	merged := make(Set[Steper])
+	for _, phase := range WorkflowPhases {
+		for step := range other.steps[phase] {
+			state := other.state[step]
+			if merged.Has(step) || state == nil || state.Config == nil {
+				w.PhaseAdd(phase, AddSteps{step: nil})
+				continue
+			}
+			merged.Add(step)
+			config := &StepConfig{
+				Upstreams: make(Set[Steper]),
+				Input:     state.Config.Input,
+				Option:    state.Config.Option,
+			}
+			config.Upstreams.Union(state.Config.Upstreams)
+			if len(state.Config.UpstreamIDs) > 0 {
+				config.UpstreamIDs = make(Set[string])
+				config.UpstreamIDs.Union(state.Config.UpstreamIDs)
+			}
+			if len(state.Config.UpstreamPhases) > 0 {
+				config.UpstreamPhases = make(Set[Phase])
+				config.UpstreamPhases.Union(state.Config.UpstreamPhases)
+			}
+			w.PhaseAdd(phase, AddSteps{step: config})
+		}
+	}
+	roots := []Steper{}
+	for root := range w.state {
+		roots = append(roots, root)
+	}
+	for _, root := range roots {
+		w.resolveUpstreamIDs(root)
+	}
+	return nil
+}
+
+// conflictOption returns the name of the first option set differently in a and b,
+// options set in only one of them are not conflicts.
+func conflictOption(a, b *StepOption) string {
+	differ := func(x, y *time.Duration) bool { return x != nil && y != nil && *x != *y }
+	differStr := func(x, y string) bool { return x != "" && y != "" && x != y }
+	switch {
+	case differ(a.Timeout, b.Timeout):
+		return "Timeout"
+	case differ(a.StartJitter, b.StartJitter):
+		return "StartJitter"
+	case differStr(a.RateLimit, b.RateLimit):
+		return "RateLimit"
+	case differStr(a.Queue, b.Queue):
+		return "Queue"
+	case differStr(a.Group, b.Group):
+		return "Group"
+	case differStr(string(a.PanicAs), string(b.PanicAs)):
+		return "PanicAs"
+	}
+	return ""
+}
+
+// Only filters the Workflow to run only the given Steps and their transitive Upstreams,
+// other Steps are marked as Skipped when Do, without running.
+//
+// It's useful for debugging a big Workflow, i.e. only run the deploy Step and its dependencies.
+//
+//	workflow.Only(deploy).Do(ctx)
+//
+// Calling Only multiple times unions the Steps, Only() without Steps clears the filter.
+// The filter applies to root Steps, a nested Step is regarded as its root Step.
+func (w *Workflow) Only(steps ...Steper) *Workflow {
+	if len(steps) == 0 {
+		w.only = nil
+		return w
+	}
+	if w.only == nil {
+		w.only = make(Set[Steper])
+	}
+	w.only.Add(steps...)
+	return w
+}
+
+// Without filters the Workflow to not run the given Steps and their transitive Downstreams,
+// they are marked as Skipped when Do, without running.
+//
+// Calling Without multiple times unions the Steps, Without() without Steps clears the filter.
+// Without takes precedence over Only.
+func (w *Workflow) Without(steps ...Steper) *Workflow {
+	if len(steps) == 0 {
+		w.without = nil
+		return w
+	}
+	if w.without == nil {
+		w.without = make(Set[Steper])
+	}
+	w.without.Add(steps...)
+	return w
+}
+
+// Targets resolves the ids (see Register) to the root Steps to run, like targets of make.
+//
+// requested are the Steps of the ids, implied are their transitive Upstreams not requested,
+// both are sorted by name. Targets returns ErrUnknownTarget if any id is not registered.
+func (w *Workflow) Targets(ids ...string) (requested, implied []Steper, err error) {
+	var unknown ErrUnknownTarget
+	roots := make(Set[Steper])
+	for _, id := range ids {
+		step, ok := w.ids[id]
+		if !ok || w.RootOf(step) == nil {
+			unknown = append(unknown, id)
+			continue
+		}
+		roots.Add(w.RootOf(step))
+	}
+	if len(unknown) > 0 {
+		return nil, nil, unknown
+	}
+	seen := make(Set[Steper])
+	queue := []Steper{}
+	for root := range roots {
+		queue = append(queue, root)
+	}
+	for len(queue) > 0 {
+		step := queue[0]
+		queue = queue[1:]
+		if seen.Has(step) {
+			continue
+		}
+		seen.Add(step)
+		if roots.Has(step) {
+			requested = append(requested, step)
+		} else {
+			implied = append(implied, step)
+		}
+		for up := range w.UpstreamOf(step) {
+			queue = append(queue, up)
+		}
+	}
+	byName := func(a, b Steper) int { return strings.Compare(String(a), String(b)) }
+	slices.SortFunc(requested, byName)
+	slices.SortFunc(implied, byName)
+	return requested, implied, nil
+}
+
+// RunTargets runs only the Steps of the ids and their transitive Upstreams, like make, see Targets.
+//
+//	err := workflow.RunTargets(ctx, "test", "lint")
+//
+// Phases are respected, the pruned Steps still run phase by phase,
+// and Steps in Init and Defer always run as the setup and teardown of the Workflow.
+// Other Steps are Skipped, same as Only, the filter set by Only is restored after the run.
+// Unknown ids fail with ErrUnknownTarget before running anything.
+func (w *Workflow) RunTargets(ctx context.Context, ids ...string) error {
+	if !w.isRunning.TryLock() {
+		return ErrWorkflowIsRunning
+	}
+	requested, _, err := w.Targets(ids...)
+	if err != nil {
+		w.isRunning.Unlock()
+		return err
+	}
+	only := w.only
+	w.only = make(Set[Steper])
+	w.only.Add(requested...)
+	w.only.Union(w.steps[PhaseInit])
+	w.only.Union(w.steps[PhaseDefer])
+	w.isRunning.Unlock()
+	defer func() { w.only = only }()
+	return w.Do(ctx)
+}
+
+// excluded returns the root Steps filtered out by Only and Without.
+func (w *Workflow) excluded() Set[Steper] {
+	excluded := make(Set[Steper])
+	if len(w.only) == 0 && len(w.without) == 0 {
+		return excluded
+	}
+	// closure collects the root Steps and their transitive Upstreams or Downstreams
+	closure := func(steps Set[Steper], next func(Steper) map[Steper]StatusError) Set[Steper] {
+		rv := make(Set[Steper])
+		queue := []Steper{}
+		for step := range steps {
+			if root := w.RootOf(step); root != nil && w.state[root] != nil {
+				queue = append(queue, root)
+			}
+		}
+		for len(queue) > 0 {
+			step := queue[0]
+			queue = queue[1:]
+			if rv.Has(step) {
+				continue
+			}
+			rv.Add(step)
+			for s := range next(step) {
+				queue = append(queue, s)
+			}
+		}
+		return rv
+	}
+	if len(w.only) > 0 {
+		included := closure(w.only, w.UpstreamOf)
+		for step := range w.state {
+			if !included.Has(step) {
+				excluded.Add(step)
+			}
+		}
+	}
+	excluded.Union(closure(w.without, w.DownstreamOf))
+	return excluded
+}
+
+// Reset resets all Steps back to Pending, so the Workflow is able to Do again.
+//
+// Statuses, errors, attempts and progress restored from checkpoint are cleared,
+// Steps, dependencies, configs and options are preserved.
+// Nested Workflows are reset as well.
+//
+// Be aware that stateful Steps are not reset, i.e. Function keeps its Output of the last run.
+// Reset returns ErrWorkflowIsRunning if the Workflow is running.
+func (w *Workflow) Reset() error {
+	if !w.isRunning.TryLock() {
+		return ErrWorkflowIsRunning
+	}
+	defer w.isRunning.Unlock()
+	w.waitAbandoned()
+	for step, state := range w.state {
+		state.reset()
+		for _, inner := range As[*Workflow](step) {
+			if inner == w {
+				continue
+			}
+			if err := inner.Reset(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Clone returns a new Workflow with the same definition, ready to Do independently.
+//
+// The Steps, dependencies, configs and options are copied, states of Steps are reset to Pending.
+// Clones share
+//   - the Steps, Step implementations are not copied,
+//   - the rate limiters (see WithRateLimit), so the rate limits apply to all clones,
+//   - the clock, notify, reporters, recorder, cache, middlewares, status mappers and error transformers.
+//
+// Be aware that stateful Steps are shared among clones,
+// i.e. Function writes its Output, a nested Workflow can't run concurrently.
+// Running clones concurrently is only safe if the Steps are stateless.
+func (w *Workflow) Clone() *Workflow {
+	c := &Workflow{
+		clock:             w.clock,
+		notify:            slices.Clone(w.notify),
+		reporters:         slices.Clone(w.reporters),
+		recorder:          w.recorder,
+		cache:             w.cache,
+		onIdle:            slices.Clone(w.onIdle),
+		middlewares:       slices.Clone(w.middlewares),
+		rateLimiters:      w.rateLimiters,
+		statusMappers:     slices.Clone(w.statusMappers),
+		isCanceledFunc:    w.isCanceledFunc,
+		errorTransformers: slices.Clone(w.errorTransformers),
+		maxStartJitter:    w.maxStartJitter,
+		timeoutJitter:     w.timeoutJitter,
+		rand:              w.rand,
+		faultInjector:     w.faultInjector,
+		leaseTimeout:      w.leaseTimeout,
+		cancelGrace:       w.cancelGrace,
+		phaseTimeouts:     maps.Clone(w.phaseTimeouts),
+		phasePolicies:     maps.Clone(w.phasePolicies),
+		afterPhases:       slices.Clone(w.afterPhases),
+		executor:          w.executor,
+		maxSteps:          w.maxSteps,
+		maxDynamic:        w.maxDynamic,
+		maxCost:           w.maxCost,
+		added:             w.added,
+		skipPropagation:   w.skipPropagation,
+		strictReach:       w.strictReach,
+		DontPanic:         w.DontPanic,
+		FailFast:          w.FailFast,
+	}
+	cloneSet := func(s Set[Steper]) Set[Steper] {
+		if s == nil {
+			return nil
+		}
+		rv := make(Set[Steper])
+		rv.Union(s)
+		return rv
+	}
+	if w.leaseBucket != nil {
+		c.leaseBucket = make(chan struct{}, cap(w.leaseBucket))
+	}
+	if w.phaseLeaseBuckets != nil {
+		c.phaseLeaseBuckets = make(map[Phase]chan struct{})
+		for phase, bucket := range w.phaseLeaseBuckets {
+			c.phaseLeaseBuckets[phase] = make(chan struct{}, cap(bucket))
+		}
+	}
+	if w.queueLeaseBuckets != nil {
+		c.queueLeaseBuckets = make(map[string]chan struct{})
+		for queue, bucket := range w.queueLeaseBuckets {
+			c.queueLeaseBuckets[queue] = make(chan struct{}, cap(bucket))
+		}
+	}
+	if w.groupLeaseBuckets != nil {
+		c.groupLeaseBuckets = make(map[string]chan struct{})
+		for group, bucket := range w.groupLeaseBuckets {
+			c.groupLeaseBuckets[group] = make(chan struct{}, cap(bucket))
+		}
+	}
+	if w.results != nil {
+		c.results = make(map[Steper][]onResult)
+		for step, callbacks := range w.results {
+			c.results[step] = slices.Clone(callbacks)
+		}
+	}
+	if w.ids != nil {
+		c.ids = make(map[string]Steper)
+		for id, step := range w.ids {
+			c.ids[id] = step
+		}
+	}
+	c.only, c.without = cloneSet(w.only), cloneSet(w.without)
+	if w.tree != nil {
+		c.tree = make(StepTree)
+		for step, parent := range w.tree {
+			c.tree[step] = parent
+		}
+	}
+	if w.steps != nil {
+		c.steps = make(map[Phase]Set[Steper])
+		for phase, steps := range w.steps {
+			c.steps[phase] = cloneSet(steps)
+		}
+	}
+	if w.state != nil {
+		c.state = make(map[Steper]*State)
+		for step, state := range w.state {
+			cs := &State{seq: state.seq}
+			if state.Config != nil {
+				cs.Config = &StepConfig{
+					Upstreams: cloneSet(state.Config.Upstreams),
+					Input:     state.Config.Input,
+					Option:    state.Config.Option,
+				}
+				if state.Config.UpstreamIDs != nil {
+					cs.Config.UpstreamIDs = make(Set[string])
+					cs.Config.UpstreamIDs.Union(state.Config.UpstreamIDs)
+				}
+				if state.Config.UpstreamPhases != nil {
+					cs.Config.UpstreamPhases = make(Set[Phase])
+					cs.Config.UpstreamPhases.Union(state.Config.UpstreamPhases)
+				}
+			}
+			c.state[step] = cs
+		}
+	}
+	return c
+}
+
 func (w *Workflow) empty() bool { return len(w.tree) == 0 || len(w.state) == 0 || len(w.steps) == 0 }
 
 // Steps returns all root Steps in the Workflow.
@@ -161,6 +841,34 @@ func (w *Workflow) Unwrap() []Steper {
 	return rv
 }
 
+// Clock returns the clock used by Workflow, see WithClock.
+func (w *Workflow) Clock() clock.Clock {
+	if w.clock == nil {
+		return clock.New()
+	}
+	return w.clock
+}
+
+// Wait blocks until the Step is terminated or ctx is done, then returns the status and error of the Step.
+//
+// It's safe to be called from other goroutines while the Workflow is running.
+// Wait returns ErrStepNotInWorkflow if the Step is not in the Workflow,
+// or ctx.Err() if ctx is done before the Step is terminated.
+func (w *Workflow) Wait(ctx context.Context, step Steper) (StatusError, error) {
+	w.topology.RLock()
+	state := w.StateOf(step)
+	w.topology.RUnlock()
+	if state == nil {
+		return StatusError{}, ErrStepNotInWorkflow{Step: step}
+	}
+	select {
+	case <-state.Done():
+		return state.GetStatusError(), nil
+	case <-ctx.Done():
+		return state.GetStatusError(), ctx.Err()
+	}
+}
+
 // RootOf returns the root Step of the given Step.
 func (w *Workflow) RootOf(step Steper) Steper {
 	if w.empty() {
@@ -191,6 +899,48 @@ func (w *Workflow) StateOf(step Steper) *State {
 	return w.state[w.RootOf(ancestor)]
 }
 
+// EffectiveConfig returns the resolved config the Workflow applies to the Step at run time,
+// i.e. configs merged from adding the Step multiple times, from its wrapped Steps, or in nested Workflows.
+//
+//	opt := new(StepOption)
+//	workflow.EffectiveConfig(step).Option(opt)
+//	fmt.Println(opt.Timeout)
+//
+// Upstreams are the resolved root Steps, including Upstreams by ids (see DependsOnID) and phases (see DependsOnPhase),
+// Option fills the Workflow level defaults, i.e. StartJitter from WithStartJitter.
+// Steps in a nested Workflow are resolved by the nested Workflow, Steps not in Workflow get an empty StepConfig.
+func (w *Workflow) EffectiveConfig(step Steper) StepConfig {
+	if w.empty() || step == nil || w.tree[step] == nil {
+		return StepConfig{}
+	}
+	if ancestor := w.tree[step]; ancestor != step {
+		if s, ok := ancestor.(interface{ EffectiveConfig(Steper) StepConfig }); ok {
+			return s.EffectiveConfig(step)
+		}
+	}
+	root := w.RootOf(step)
+	state := w.state[root]
+	if state == nil {
+		return StepConfig{}
+	}
+	ec := StepConfig{Upstreams: make(Set[Steper])}
+	for up := range w.UpstreamOf(root) {
+		ec.Upstreams.Add(up)
+	}
+	option := state.Option()
+	if option.StartJitter == nil && w.maxStartJitter > 0 {
+		jitter := w.maxStartJitter
+		option.StartJitter = &jitter
+	}
+	ec.Option = func(so *StepOption) { *so = *option }
+	if state.Config != nil {
+		ec.Input = state.Config.Input
+		ec.UpstreamIDs = maps.Clone(state.Config.UpstreamIDs)
+		ec.UpstreamPhases = maps.Clone(state.Config.UpstreamPhases)
+	}
+	return ec
+}
+
 // PhaseOf returns the execution phase of the Step.
 func (w *Workflow) PhaseOf(step Steper) Phase {
 	if w.empty() {
@@ -208,7 +958,7 @@ func (w *Workflow) PhaseOf(step Steper) Phase {
 }
 
 // UpstreamOf returns all upstream Steps of the Step.
-// Upstream Steps are the Steps that the Step depends on.
+// Upstream Steps are the Steps that the Step depends on, including the Steps in phases it depends on (see DependsOnPhase).
 func (w *Workflow) UpstreamOf(step Steper) map[Steper]StatusError {
 	if w.empty() {
 		return nil
@@ -225,6 +975,44 @@ func (w *Workflow) UpstreamOf(step Steper) map[Steper]StatusError {
 			}
 		}
 	}
+	if state := w.StateOf(root); state != nil && state.Config != nil {
+		for phase := range state.Config.UpstreamPhases {
+			for up := range w.steps[phase] {
+				if up != root {
+					rv[up] = w.StateOf(up).GetStatusError()
+				}
+			}
+		}
+	}
+	return rv
+}
+
+// Parents returns the direct Upstreams of the Step, in the order they are added into the Workflow.
+//
+// It's the ordered version of UpstreamOf, i.e. for deterministic rendering.
+// Steps added by the same adder (i.e. Steps(a, b) or the Upstreams in DependsOn) are sorted by name.
+func (w *Workflow) Parents(step Steper) []Steper {
+	return w.inAddedOrder(w.UpstreamOf(step))
+}
+
+// Children returns the direct Downstreams of the Step, in the order they are added into the Workflow.
+//
+// It's the ordered version of DownstreamOf, i.e. for deterministic rendering, the order is the same as Parents.
+func (w *Workflow) Children(step Steper) []Steper {
+	return w.inAddedOrder(w.DownstreamOf(step))
+}
+
+func (w *Workflow) inAddedOrder(steps map[Steper]StatusError) []Steper {
+	rv := make([]Steper, 0, len(steps))
+	for step := range steps {
+		rv = append(rv, step)
+	}
+	slices.SortFunc(rv, func(a, b Steper) int {
+		if seqA, seqB := w.StateOf(a).seq, w.StateOf(b).seq; seqA != seqB {
+			return seqA - seqB
+		}
+		return strings.Compare(String(a), String(b))
+	})
 	return rv
 }
 
@@ -243,6 +1031,9 @@ func (w *Workflow) DownstreamOf(step Steper) map[Steper]StatusError {
 					rv[down] = w.StateOf(down).GetStatusError()
 				}
 			}
+			if config := w.StateOf(down).Config; down != root && config != nil && config.UpstreamPhases.Has(w.PhaseOf(root)) {
+				rv[down] = w.StateOf(down).GetStatusError()
+			}
 		}
 	}
 	return rv
@@ -269,59 +1060,272 @@ func (w *Workflow) IsPhaseTerminated(phase Phase) bool {
 	return true
 }
 
-// Do starts the Step execution in topological order,
-// and waits until all Steps terminated.
+// CurrentPhase returns the phase being executed, i.e. the first non-terminated phase in WorkflowPhases, same as tick.
 //
-// Do will block the current goroutine.
-func (w *Workflow) Do(ctx context.Context) error {
+// It's read-only and safe to be called from other goroutines while the Workflow is running, i.e. for progress bars.
+// CurrentPhase returns PhaseUnknown if the Workflow is not running, or all phases are terminated.
+func (w *Workflow) CurrentPhase() Phase {
+	if !w.running.Load() {
+		return PhaseUnknown
+	}
+	w.topology.RLock()
+	defer w.topology.RUnlock()
+	for _, phase := range WorkflowPhases {
+		if !w.IsPhaseTerminated(phase) {
+			return phase
+		}
+	}
+	return PhaseUnknown
+}
+
+// Do starts the Step execution in topological order,
+// and waits until all Steps terminated.
+//
+// Do will block the current goroutine.
+//
+// Once ctx is done, Running Steps observe it from their context,
+// Pending Steps without explicit Condition are Canceled immediately,
+// Pending Steps with explicit Condition are still decided by their Condition.
+func (w *Workflow) Do(ctx context.Context) error { return w.do(ctx, nil, false) }
+
+// StepEvent is a status transition of a root Step, see Run.
+type StepEvent struct {
+	Step Steper
+	StatusError
+}
+
+// Run is the streaming version of Do, it yields a StepEvent for each status transition of root Steps,
+// and ends when the Workflow terminated. The error returned by Do is yielded at last if not nil.
+//
+// Run returns an iterator in the shape of iter.Seq2[StepEvent, error], call it with yield,
+// returning false from yield stops the iteration,
+//
+//	workflow.Run(ctx)(func(event flow.StepEvent, err error) bool {
+//		if err != nil {
+//			// the Workflow terminated with error
+//			return false
+//		}
+//		fmt.Println(event.Step, event.Status)
+//		return true
+//	})
+//
+// Since Go 1.23, it's also able to be consumed by range-over-func.
+// Events are buffered, so Steps never wait for a slow consumer.
+// Stopping the iteration early cancels the Workflow, and waits until it terminated.
+func (w *Workflow) Run(ctx context.Context) func(yield func(StepEvent, error) bool) {
+	return func(yield func(StepEvent, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var err error
+		events := newEventQueue()
+		go func() {
+			defer events.close()
+			err = w.do(ctx, events, false)
+		}()
+		for {
+			batch, closed := events.pop()
+			for _, event := range batch {
+				if !yield(event, nil) {
+					cancel()
+					for !closed { // drain until the Workflow terminated
+						_, closed = events.pop()
+					}
+					return
+				}
+			}
+			if closed {
+				break
+			}
+		}
+		if err != nil {
+			yield(StepEvent{}, err)
+		}
+	}
+}
+
+// eventQueue buffers StepEvents without bound, so setStatus never waits for the consumer of Run.
+type eventQueue struct {
+	mu     sync.Mutex
+	events []StepEvent
+	closed bool
+	wake   chan struct{} // signaled once events are pushed or the queue is closed
+}
+
+func newEventQueue() *eventQueue { return &eventQueue{wake: make(chan struct{}, 1)} }
+
+func (q *eventQueue) push(event StepEvent) {
+	q.mu.Lock()
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *eventQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// pop waits for events pushed or the queue closed, returns the events in order and whether the queue is closed.
+func (q *eventQueue) pop() ([]StepEvent, bool) {
+	<-q.wake
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := q.events
+	q.events = nil
+	return events, q.closed
+}
+
+// DoWithin runs the Workflow like Do, but gives up once d elapsed, and returns the partial result anyway.
+//
+// Once d elapsed, the Workflow is canceled with ErrWorkflowTimeout as the cause,
+// Pending Steps are Canceled unless their Conditions decide to run (i.e. cleanups with Always),
+// Running Steps observe the cancellation from their context, set WithCancelGracePeriod to stop waiting for them.
+//
+// Unlike Do with a deadline in ctx, DoWithin always returns the statuses of all root Steps as the partial result,
+// the error is ErrWorkflowTimeout if the Workflow failed after d elapsed, otherwise the error returned by Do.
+//
+//	partial, err := workflow.DoWithin(ctx, 10*time.Minute)
+//	for step, serr := range partial {
+//		// Succeeded Steps are kept even if err is ErrWorkflowTimeout
+//	}
+func (w *Workflow) DoWithin(ctx context.Context, d time.Duration) (ErrWorkflow, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timeout := ErrWorkflowTimeout{Timeout: d}
+	timer := w.Clock().AfterFunc(d, func() { cancel(timeout) })
+	defer timer.Stop()
+	err := w.Do(ctx)
+	partial := make(ErrWorkflow, len(w.state))
+	for step, state := range w.state {
+		partial[step] = state.GetStatusError()
+	}
+	if err != nil && errors.Is(context.Cause(ctx), timeout) {
+		return partial, timeout
+	}
+	return partial, err
+}
+
+// do runs the Workflow, emits status transitions to events if not nil (see Run),
+// resume restarts the Suspended Steps and keeps the terminated ones (see Resume).
+func (w *Workflow) do(ctx context.Context, events *eventQueue, resume bool) error {
 	// assert the Workflow is not running
 	if !w.isRunning.TryLock() {
 		return ErrWorkflowIsRunning
 	}
 	defer w.isRunning.Unlock()
+	w.running.Store(true)
+	defer w.running.Store(false)
+	w.waitAbandoned()
+	w.events = events
+	defer func() { w.events = nil }()
 	// if no steps to run
 	if w.empty() {
 		return nil
 	}
+	if resume {
+		for _, state := range w.state {
+			if state.GetStatus() == Suspended {
+				state.SetStatus(Pending)
+			}
+		}
+	}
 	// preflight check
-	if err := w.preflight(); err != nil {
+	if err := w.preflight(resume); err != nil {
 		return err
 	}
+	// skip Steps filtered out by Only and Without
+	for step := range w.excluded() {
+		w.setStatus(ctx, step, Skipped)
+	}
 	// new fields for ready to tick
 	if w.clock == nil {
 		w.clock = clock.New()
 	}
-	w.oneStepTerminated = make(chan struct{}, len(w.state)+1) // need one more for the first tick
+	ctx = withStore(ctx)
+	ctx, w.cancel = context.WithCancelCause(ctx)
+	w.phaseCtx, w.phaseTimers = make(map[Phase]context.Context), nil
+	defer func() {
+		for _, timer := range w.phaseTimers {
+			timer.Stop()
+		}
+		w.cancel(nil)
+		w.cancel = nil
+	}()
+	w.spent = 0
+	w.terminated.Store(0)
+	w.suspending.Store(false)
+	w.phasesDone = make(Set[Phase])
+	w.dynamic, w.dynamicAdded = nil, 0
+	// each Step signals once when terminated, and once more when its WaitFor signal is received,
+	// including the Steps added while running (see WithDynamicSteps), need one more for the first tick
+	w.oneStepTerminated = make(chan struct{}, 2*(len(w.state)+w.maxDynamic)+1)
 	// signal for the first tick
 	w.signalTick()
-	// each time one Step terminated, tick forward
-	for range w.oneStepTerminated {
+	// each time one Step terminated, or the context is done, tick forward
+	ctxDone := ctx.Done()
+	var deadlock ErrDeadlock
+	idle, suspended := false, false
+	for {
+		select {
+		case <-w.oneStepTerminated:
+		case <-ctxDone:
+			ctxDone = nil // only need to be notified once
+		}
 		if done := w.tick(ctx); done {
 			break
 		}
+		// suspended once no Step is running, the Steps not started are parked, see Suspend
+		if suspended = w.suspending.Load() && w.inflight.Load() == 0 && len(w.oneStepTerminated) == 0; suspended {
+			break
+		}
+		if deadlock = w.stuck(); len(deadlock) > 0 {
+			break
+		}
+		// notify once the Workflow becomes idle, see WithOnIdle
+		pending := w.idle()
+		if len(pending) > 0 && !idle {
+			for _, onIdle := range w.onIdle {
+				onIdle(pending)
+			}
+		}
+		idle = len(pending) > 0
 	}
 	// ensure all goroutines are exited
 	w.waitGroup.Wait()
+	if suspended {
+		return ErrWorkflowSuspended{Steps: w.suspended()}
+	}
+	if len(deadlock) > 0 {
+		return deadlock
+	}
 	// return the error
 	err := make(ErrWorkflow)
 	for step, state := range w.state {
+		if isFailure(state.GetStatus()) && state.Option().Optional {
+			continue // failure of optional Step doesn't fail the Workflow
+		}
 		err[step] = state.GetStatusError()
 	}
 	if err.IsNil() {
 		return nil
 	}
+	var failFast ErrFailFast
+	if errors.As(context.Cause(ctx), &failFast) {
+		failFast.Steps = err
+		return failFast
+	}
 	return err
 }
 
-const scanned StepStatus = "scanned" // a private status for preflight
-func isAllUpstreamScanned(ups map[Steper]StatusError) bool {
-	for _, up := range ups {
-		if up.Status != scanned {
-			return false
-		}
-	}
-	return true
-}
 func isAnyUpstreamNotTerminated(ups map[Steper]StatusError) bool {
 	for _, up := range ups {
 		if !up.Status.IsTerminated() {
@@ -330,10 +1334,20 @@ func isAnyUpstreamNotTerminated(ups map[Steper]StatusError) bool {
 	}
 	return false
 }
-func (w *Workflow) preflight() error {
+func (w *Workflow) preflight(resume bool) error {
+	// assert no Step is refused by WithMaxSteps
+	if w.errTooManySteps != nil {
+		return *w.errTooManySteps
+	}
 	// assert all Steps' status start with Pending
 	unexpectStatusSteps := make(ErrUnexpectStepInitStatus)
 	for step, state := range w.state {
+		if state.isRestored() { // restored from checkpoint
+			continue
+		}
+		if resume && state.GetStatus().IsTerminated() { // terminated before suspended, see Resume
+			continue
+		}
 		if status := state.GetStatus(); status != Pending {
 			unexpectStatusSteps[step] = status
 		}
@@ -341,133 +1355,1091 @@ func (w *Workflow) preflight() error {
 	if len(unexpectStatusSteps) > 0 {
 		return unexpectStatusSteps
 	}
+	// assert all ids are resolved
+	unresolved := make(ErrUnresolvedID)
+	for step, state := range w.state {
+		if state.Config != nil {
+			for id := range state.Config.UpstreamIDs {
+				unresolved[step] = append(unresolved[step], id)
+			}
+		}
+	}
+	if len(unresolved) > 0 {
+		return unresolved
+	}
 	// assert all dependency would not form a cycle
-	// start scanning, mark Step as Scanned only when its all depdencies are Scanned
-	for {
-		hasNewScanned := false // whether a new Step being marked as Scanned this turn
-		for step, state := range w.state {
-			if state.GetStatus() == scanned {
-				continue
+	if _, stepsInCycle := w.levels(); len(stepsInCycle) > 0 {
+		return stepsInCycle
+	}
+	// assert keys read from Store are written by Upstreams
+	notWritten := make(ErrStoreKeyNotWritten)
+	for step, state := range w.state {
+		reads := state.Option().StoreReads
+		if len(reads) == 0 {
+			continue
+		}
+		written := w.storeWrittenBefore(step)
+		for key := range reads {
+			if !written.Has(key) {
+				notWritten[step] = append(notWritten[step], key)
 			}
-			if isAllUpstreamScanned(w.UpstreamOf(step)) {
-				hasNewScanned = true
-				state.SetStatus(scanned)
+		}
+	}
+	if len(notWritten) > 0 {
+		return notWritten
+	}
+	// assert all Steps are able to become runnable
+	if w.strictReach {
+		if unreachable := w.Unreachable(); len(unreachable) > 0 {
+			return unreachable
+		}
+	}
+	return nil
+}
+
+// Unreachable returns the root Steps that can never become runnable given the phases and dependencies,
+// along with the reasons, i.e.
+//   - the Step depends on a phase executing after its own phase (see DependsOnPhase), the phases wait for each other
+//   - the Step depends on a PeriodicStep, which only stops after all other Steps in its phase terminated
+//   - the Step depends on an unreachable Step
+//
+// Only and Without always filter a Step together with its Upstreams or Downstreams, so they never strand a Step.
+// Use WithStrictReachability to fail Do with the result before running anything.
+func (w *Workflow) Unreachable() ErrUnreachable {
+	unreachable := make(ErrUnreachable)
+	order := make(map[Phase]int)
+	for i, phase := range WorkflowPhases {
+		order[phase] = i
+	}
+	for step, state := range w.state {
+		if state.Config != nil {
+			for phase := range state.Config.UpstreamPhases {
+				if i, ok := order[phase]; ok && i > order[w.PhaseOf(step)] && len(w.steps[phase]) > 0 {
+					unreachable[step] = fmt.Sprintf("depends on phase %s, which executes after its phase %s", phase, w.PhaseOf(step))
+				}
 			}
 		}
-		if !hasNewScanned { // break when no new Step being Scanned
-			break
+		if _, ok := unreachable[step]; ok {
+			continue
+		}
+		for up := range state.Upstreams() { // Steps in previous phases terminate, see DependsOnPhase
+			if up = w.RootOf(up); isPeriodic(up) {
+				unreachable[step] = fmt.Sprintf("depends on periodic Step %s, which stops only after all other Steps terminated", String(up))
+				break
+			}
 		}
 	}
-	// check whether still have Steps not Scanned,
-	// not Scanned Steps are in a cycle.
-	stepsInCycle := make(ErrCycleDependency)
+	// propagate to the Downstreams, each Step is queued at most once
+	queue := make([]Steper, 0, len(unreachable))
+	for step := range unreachable {
+		queue = append(queue, step)
+	}
+	for len(queue) > 0 {
+		step := queue[0]
+		queue = queue[1:]
+		for _, down := range w.Children(step) {
+			if _, ok := unreachable[down]; !ok {
+				unreachable[down] = fmt.Sprintf("depends on unreachable Step %s", String(step))
+				queue = append(queue, down)
+			}
+		}
+	}
+	return unreachable
+}
+
+// storeWrittenBefore returns the Store keys written by Steps happen-before the Step,
+// i.e. its Upstreams (transitively) and Steps in previous phases.
+func (w *Workflow) storeWrittenBefore(step Steper) Set[string] {
+	written := make(Set[string])
+	phase := w.PhaseOf(step)
+	for p, steps := range w.steps {
+		if slices.Index(WorkflowPhases, p) < slices.Index(WorkflowPhases, phase) {
+			for s := range steps {
+				written.Union(w.StateOf(s).Option().StoreWrites)
+			}
+		}
+	}
+	visited := make(Set[Steper])
+	var visit func(Steper)
+	visit = func(s Steper) {
+		for up := range w.UpstreamOf(s) {
+			if !visited.Has(up) {
+				visited.Add(up)
+				written.Union(w.StateOf(up).Option().StoreWrites)
+				visit(up)
+			}
+		}
+	}
+	visit(step)
+	return written
+}
+
+// LabelsOf returns the labels of the Step, see AddSteps.Labels.
+//
+// It returns nil if the Step is not in the Workflow or has no labels.
+func (w *Workflow) LabelsOf(step Steper) map[string]string {
+	state := w.StateOf(step)
+	if state == nil {
+		return nil
+	}
+	return state.Option().Labels
+}
+
+// LabelsFrom returns the labels of the running Step from its context (see AddSteps.Labels),
+// i.e. in Notify callbacks, Input callbacks and Do of the Step.
+//
+// It returns nil if ctx is not from a Workflow, or the Step has no labels.
+func LabelsFrom(ctx context.Context) map[string]string {
+	sc := stepContextFrom(ctx)
+	if sc == nil {
+		return nil
+	}
+	return sc.workflow.LabelsOf(sc.step)
+}
+
+// TotalCost returns the sum of costs of Succeeded Steps (see AddSteps.Cost), it's safe to call during Do,
+// so it's the running total so far.
+func (w *Workflow) TotalCost() float64 {
+	w.topology.RLock()
+	defer w.topology.RUnlock()
+	total := 0.0
+	for _, state := range w.state {
+		if state.GetStatus() == Succeeded {
+			total += state.Option().Cost
+		}
+	}
+	return total
+}
+
+// RunningSteps returns the root Steps in Running status, it's safe to call during Do.
+//
+// It's cheaper than inspecting StateOf for each Step, i.e. for a live status endpoint.
+func (w *Workflow) RunningSteps() []Steper {
+	w.topology.RLock()
+	defer w.topology.RUnlock()
+	running := []Steper{}
 	for step, state := range w.state {
-		if state.GetStatus() == scanned {
+		if state.GetStatus() == Running {
+			running = append(running, step)
+		}
+	}
+	return running
+}
+
+// GroupStatus aggregates the statuses of Steps in the group, see AddSteps.Group.
+//
+//   - Pending, if no Step in the group, or all Steps are Pending
+//   - Running, if any Step is Running, or some Steps are terminated while others are Pending
+//   - Failed, if any Failed
+//   - TimedOut, if any TimedOut
+//   - Canceled, if any Canceled
+//   - custom status (see WithStatusMapper), if any, the first one in lexical order if there are many
+//   - Skipped, if any Skipped
+//   - Succeeded, if all Succeeded
+func (w *Workflow) GroupStatus(name string) StepStatus {
+	count := make(map[StepStatus]int)
+	total := 0
+	var custom StepStatus
+	for _, state := range w.state {
+		if state.Option().Group != name {
 			continue
 		}
-		for up, statusErr := range w.UpstreamOf(step) {
-			if statusErr.Status != scanned {
-				stepsInCycle[step] = append(stepsInCycle[step], up)
+		total++
+		status := state.GetStatus()
+		count[status]++
+		switch status {
+		case Pending, Running, Failed, Succeeded, TimedOut, Canceled, Skipped:
+		default:
+			if custom == "" || status < custom {
+				custom = status
 			}
 		}
 	}
+	switch {
+	case count[Pending] == total:
+		return Pending
+	case count[Running] > 0, count[Pending] > 0:
+		return Running
+	case count[Failed] > 0:
+		return Failed
+	case count[TimedOut] > 0:
+		return TimedOut
+	case count[Canceled] > 0:
+		return Canceled
+	case custom != "":
+		return custom
+	case count[Skipped] > 0:
+		return Skipped
+	default:
+		return Succeeded
+	}
+}
+
+// WorkflowStats is the composition of a Workflow, see Workflow.Stats.
+type WorkflowStats struct {
+	Steps  int           // number of root Steps
+	Phases map[Phase]int // number of root Steps in each phase
+	Depth  int           // number of levels, it's the length of the longest dependency chain across phases
+	Width  int           // number of Steps in the widest level, it's the max parallelism
+}
+
+// Stats analyzes the composition of the Workflow without running it.
+//
+// Steps in a cycle are not counted in Depth and Width.
+func (w *Workflow) Stats() WorkflowStats {
+	stats := WorkflowStats{Phases: make(map[Phase]int)}
+	if w.empty() {
+		return stats
+	}
+	stats.Steps = len(w.state)
+	for step := range w.state {
+		stats.Phases[w.PhaseOf(step)]++
+	}
+	levels, _ := w.levels()
+	width := make(map[int]int)
+	for _, level := range levels {
+		width[level]++
+		stats.Depth = max(stats.Depth, level+1)
+		stats.Width = max(stats.Width, width[level])
+	}
+	return stats
+}
+
+// LevelOf returns the topological level of the Step, it's useful to render swim-lane diagrams.
+//
+// Steps without Upstreams are level 0, a Step is one level deeper than its deepest Upstream.
+// Phases are taken into account, i.e. Main Steps are deeper than all Init Steps.
+// Nested Steps are at the level of their root Step.
+// LevelOf returns -1 if the Step is not in the Workflow or in a cycle.
+func (w *Workflow) LevelOf(step Steper) int {
+	if w.StateOf(step) == nil {
+		return -1
+	}
+	levels, _ := w.levels()
+	if level, ok := levels[w.RootOf(step)]; ok {
+		return level
+	}
+	return -1
+}
+
+// TopoSorted returns the root Steps in topological order, every Step comes after its Upstreams,
+// i.e. to generate a flat execution plan or report.
+//
+// The order is stable, Steps are sorted by level (see LevelOf), then by name.
+// TopoSorted returns ErrCycleDependency if any Steps are in a cycle.
+func (w *Workflow) TopoSorted() ([]Steper, error) {
+	levels, stepsInCycle := w.levels()
 	if len(stepsInCycle) > 0 {
-		return stepsInCycle
+		return nil, stepsInCycle
 	}
-	// reset all Steps' status to Pending
-	for _, step := range w.state {
-		step.SetStatus(Pending)
+	sorted := make([]Steper, 0, len(levels))
+	for step := range levels {
+		sorted = append(sorted, step)
 	}
-	return nil
+	slices.SortFunc(sorted, func(a, b Steper) int {
+		if levels[a] != levels[b] {
+			return levels[a] - levels[b]
+		}
+		return strings.Compare(String(a), String(b))
+	})
+	return sorted, nil
+}
+
+// CriticalPath returns the chain of root Steps that determined the total runtime of the last run,
+// from the first to the last, it's the chain to parallelize or speed up to make the Workflow faster.
+//
+// The duration of a Step is State.TotalTime, from the start of its first attempt to the end of its last attempt,
+// including retries and backoff between them, the critical path is the dependency chain with the max sum of durations.
+// Use State.WorkTime to tell slow Steps from Steps stuck retrying.
+// Phases are taken into account, i.e. Main Steps depend on all Init Steps.
+// CriticalPath returns empty before a run, Steps in a cycle are ignored.
+func (w *Workflow) CriticalPath() []Steper {
+	levels, _ := w.levels()
+	durations := make(map[Steper]time.Duration)
+	ran := false
+	for step := range levels {
+		if state := w.StateOf(step); len(state.Attempts()) > 0 {
+			durations[step] = state.TotalTime()
+			ran = true
+		}
+	}
+	if !ran {
+		return nil
+	}
+	var (
+		sums = make(map[Steper]time.Duration) // max sum of durations of chains ending with the Step
+		prev = make(map[Steper]Steper)        // previous Step in the chain
+		last Steper                           // last Step of the critical path so far
+	)
+	for _, phase := range w.phasedSteps() {
+		steps := []Steper{}
+		for step := range phase {
+			if _, ok := levels[step]; ok {
+				steps = append(steps, step)
+			}
+		}
+		// Upstreams first, sort by name for a stable result
+		slices.SortFunc(steps, func(a, b Steper) int {
+			if levels[a] != levels[b] {
+				return levels[a] - levels[b]
+			}
+			return strings.Compare(String(a), String(b))
+		})
+		phaseLast := last // Steps in this phase run after the critical path of previous phases
+		for _, step := range steps {
+			from := phaseLast
+			for up := range w.UpstreamOf(step) {
+				if from == nil || sums[up] > sums[from] {
+					from = up
+				}
+			}
+			if from != nil {
+				prev[step] = from
+				sums[step] = sums[from]
+			}
+			sums[step] += durations[step]
+			if last == nil || sums[step] > sums[last] {
+				last = step
+			}
+		}
+	}
+	var path []Steper
+	for step := last; step != nil; step = prev[step] {
+		path = append(path, step)
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// levels assigns each root Step a level (starts from 0) in topological order,
+// Steps in the same level are able to run in parallel.
+//
+// A Step's level is greater than its Upstreams' levels, and all levels in previous phases.
+// Steps can't be leveled are in a cycle, they are returned as ErrCycleDependency.
+func (w *Workflow) levels() (map[Steper]int, ErrCycleDependency) {
+	levels := make(map[Steper]int)
+	offset := 0 // the first level of current phase
+	for _, steps := range w.phasedSteps() {
+		next := offset
+		// level a Step only when all its Upstreams are leveled
+		for {
+			hasNewLeveled := false // whether a new Step being leveled this turn
+			for step := range steps {
+				if _, ok := levels[step]; ok {
+					continue
+				}
+				level, ok := offset, true
+				for up := range w.UpstreamOf(step) {
+					upLevel, leveled := levels[up]
+					if !leveled {
+						ok = false
+						break
+					}
+					level = max(level, upLevel+1)
+				}
+				if ok {
+					hasNewLeveled = true
+					levels[step] = level
+					next = max(next, level+1)
+				}
+			}
+			if !hasNewLeveled { // break when no new Step being leveled
+				break
+			}
+		}
+		offset = next
+	}
+	// Steps not leveled are in a cycle
+	stepsInCycle := make(ErrCycleDependency)
+	for step := range w.state {
+		if _, ok := levels[step]; ok {
+			continue
+		}
+		for up := range w.UpstreamOf(step) {
+			if _, ok := levels[up]; !ok {
+				stepsInCycle[step] = append(stepsInCycle[step], up)
+			}
+		}
+	}
+	return levels, stepsInCycle
+}
+
+// phasedSteps returns root Steps grouped in the order of WorkflowPhases,
+// Steps not in WorkflowPhases are grouped at last.
+func (w *Workflow) phasedSteps() []Set[Steper] {
+	rv := []Set[Steper]{}
+	for _, phase := range WorkflowPhases {
+		rv = append(rv, w.steps[phase])
+	}
+	others := make(Set[Steper])
+	for step := range w.state {
+		if w.PhaseOf(step) == PhaseUnknown {
+			others.Add(step)
+		}
+	}
+	return append(rv, others)
 }
 
 func (w *Workflow) signalTick() { w.oneStepTerminated <- struct{}{} }
 
+// tryTick signals for next tick without blocking, no need to wait if ticks are already pending.
+func (w *Workflow) tryTick() {
+	select {
+	case w.oneStepTerminated <- struct{}{}:
+	default:
+	}
+}
+
+// afterPhase calls the callbacks once the phase terminated, see WithAfterPhase,
+// if any callback returns error, the Pending Steps in the remaining phases are Canceled with ErrAfterPhase.
+func (w *Workflow) afterPhase(ctx context.Context, phase Phase) {
+	if len(w.afterPhases) == 0 || len(w.steps[phase]) == 0 || w.phasesDone.Has(phase) {
+		return
+	}
+	w.phasesDone.Add(phase)
+	errs := make(ErrWorkflow)
+	for step := range w.steps[phase] {
+		errs[step] = w.StateOf(step).GetStatusError()
+	}
+	var err error
+	if !errs.IsNil() {
+		err = errs
+	}
+	for _, callback := range w.afterPhases {
+		cerr := callback(ctx, phase, err)
+		if cerr == nil {
+			continue
+		}
+		cause := ErrAfterPhase{Phase: phase, Err: cerr}
+		w.cancel(cause)
+		for _, phase := range WorkflowPhases {
+			for step := range w.steps[phase] {
+				if state := w.StateOf(step); state.GetStatus() == Pending {
+					w.terminate(ctx, step, state, Cancel(cause))
+				}
+			}
+		}
+		return
+	}
+}
+
+// applyPhasePolicy applies the policy of the phase if any previous phase has failures, see WithPhaseOnFailure,
+// it returns true if the Pending Steps in the phase are terminated by the policy.
+func (w *Workflow) applyPhasePolicy(ctx context.Context, phase Phase) bool {
+	policy := w.phasePolicies[phase]
+	if policy == OnFailureRunAnyway {
+		return false
+	}
+	failed := false
+	for _, previous := range WorkflowPhases {
+		if previous == phase {
+			break
+		}
+		for step := range w.steps[previous] {
+			if state := w.StateOf(step); isFailure(state.GetStatus()) && !state.Option().Optional {
+				failed = true
+			}
+		}
+	}
+	if !failed {
+		return false
+	}
+	status := Skipped
+	if policy == OnFailureAbort {
+		status = Canceled
+		w.cancel(ErrPhaseAborted{Phase: phase})
+	}
+	for step := range w.steps[phase] {
+		if w.StateOf(step).GetStatus() == Pending {
+			w.setStatus(ctx, step, status)
+		}
+	}
+	w.signalTick()
+	return true
+}
+
+type phaseTimeout struct {
+	timeout time.Duration
+	abort   bool // cancel the whole Workflow, see WithPhaseTimeoutAbort
+}
+
+// phaseContext returns the context for Steps in the phase, it's canceled when the phase timeout fires,
+// see WithPhaseTimeout. The timer starts when the phase is ticked at the first time.
+func (w *Workflow) phaseContext(ctx context.Context, phase Phase) context.Context {
+	pt, ok := w.phaseTimeouts[phase]
+	if !ok {
+		return ctx
+	}
+	if phaseCtx, ok := w.phaseCtx[phase]; ok {
+		return phaseCtx
+	}
+	phaseCtx, cancel := context.WithCancelCause(ctx)
+	w.phaseCtx[phase] = phaseCtx
+	abort, ticks := w.cancel, w.oneStepTerminated
+	w.phaseTimers = append(w.phaseTimers, w.clock.AfterFunc(pt.timeout, func() {
+		cause := ErrPhaseTimeout{Phase: phase, Timeout: pt.timeout}
+		if pt.abort {
+			abort(cause)
+		}
+		cancel(cause)
+		// tick to cancel the Pending Steps, no need to wait if ticks are already pending
+		select {
+		case ticks <- struct{}{}:
+		default:
+		}
+	}))
+	return phaseCtx
+}
+
 // tick will not block, it starts a goroutine for each runnable Step.
 // tick returns true if all steps in all phases are terminated.
 func (w *Workflow) tick(ctx context.Context) bool {
+	w.applyDynamic()
 	var steps Set[Steper]
+	var bucket chan struct{}
 	for _, phase := range WorkflowPhases {
-		if !w.IsPhaseTerminated(phase) {
-			steps = w.steps[phase]
-			break
+		if w.IsPhaseTerminated(phase) {
+			w.afterPhase(ctx, phase)
+			continue
+		}
+		steps = w.steps[phase]
+		bucket = w.leaseBucketOf(phase)
+		ctx = w.phaseContext(ctx, phase)
+		if w.applyPhasePolicy(ctx, phase) {
+			return false // the Pending Steps in the phase are terminated, tick again to move on
 		}
+		break
 	}
 	if steps == nil {
 		return true
 	}
+	w.stopPeriodic(ctx, steps)
+	// once the context is done, Pending Steps with DefaultCondition would be Canceled anyway,
+	// cancel them immediately instead of waiting for their Upstreams terminated.
+	if DefaultIsCanceled(ctx.Err()) {
+		for step := range steps {
+			state := w.StateOf(step)
+			if state.GetStatus() != Pending {
+				continue
+			}
+			if option := state.Option(); option != nil && option.Condition != nil {
+				continue // let the explicit Condition decide
+			}
+			w.setStatus(ctx, step, Canceled)
+			w.signalTick()
+		}
+	}
 	for step := range steps {
 		state := w.StateOf(step)
 		// continue if the Step is not Pending
 		if state.GetStatus() != Pending {
 			continue
 		}
-		// continue if any Upstream is not terminated
+		// continue if any Upstream is not terminated, except the open streams, see Stream
 		ups := w.UpstreamOf(step)
+		openStreams(ups)
 		if isAnyUpstreamNotTerminated(ups) {
 			continue
 		}
-		option := state.Option()
-		cond := DefaultCondition
-		if option != nil && option.Condition != nil {
-			cond = option.Condition
+		if nextStatus := w.evaluate(ctx, state.Option(), ups); nextStatus.IsTerminated() {
+			w.setStatus(ctx, step, nextStatus)
+			w.signalTick()
+			continue
+		}
+		// wait for the external signal, leave the Step Pending,
+		// it will be ticked again once the signal is received or the context is done.
+		if !w.signaled(ctx, step, state) {
+			continue
 		}
-		if nextStatus := cond(ctx, ups); nextStatus.IsTerminated() {
-			state.SetStatus(nextStatus)
+		// cancel the Step if it costs more than the budget left, see WithMaxCost
+		if option := state.Option(); w.maxCost > 0 && w.spent+option.Cost > w.maxCost {
+			w.terminate(ctx, step, state, Cancel(ErrMaxCost{MaxCost: w.maxCost, Cost: w.spent + option.Cost}))
 			w.signalTick()
 			continue
 		}
+		state.markRunnable(w.clock.Now())
+		// the group or queue is full, leave the Step Pending,
+		// it will be ticked again once a Step in the group or queue terminates.
+		// leases are taken in order of group, queue, then max concurrency, only the last one is waited,
+		// which is released by running Steps, so it never waits for leases held by Pending Steps.
+		group := w.groupLeaseBucketOf(state.Option())
+		if !tryLease(group) {
+			continue
+		}
+		queue := w.queueLeaseBucketOf(state.Option())
+		if !tryLease(queue) {
+			unlease(group)
+			continue
+		}
+		// start no new Step once suspending (see Suspend), or dependencies are to be added (see AddDependency)
+		if w.suspending.Load() || w.hasDynamic() {
+			unlease(queue)
+			unlease(group)
+			continue
+		}
 		// start the Step
-		w.lease()
-		state.SetStatus(Running)
+		if err := w.lease(ctx, bucket); err != nil {
+			unlease(queue)
+			unlease(group)
+			w.terminate(ctx, step, state, err)
+			w.signalTick()
+			continue
+		}
+		if group != nil || queue != nil || bucket != nil {
+			state.markLeased(w.clock.Now())
+		}
+		w.setStatus(ctx, step, Running)
+		w.spent += state.Option().Cost
 		w.waitGroup.Add(1)
-		go func(ctx context.Context, step Steper, state *State) {
+		w.inflight.Add(1)
+		step, state, group, queue, bucket := step, state, group, queue, bucket // the closure may run after the loop moves on
+		w.execute(func() {
 			defer w.waitGroup.Done()
+			defer w.exited() // after signalTick, so the signal is visible once inflight is 0
 			defer w.signalTick()
-			defer w.unlease()
-
-			err := w.runStep(ctx, step, state)
-			var result StepStatus
-			switch {
-			case err == nil:
-				result = Succeeded
-			case DefaultIsCanceled(err):
-				result = Canceled
-			case errors.Is(err, &ErrSkip{}):
-				result = Skipped
-			default:
-				result = Failed
-			}
-			state.SetStatus(result)
-			state.SetError(err)
-		}(ctx, step, state)
+			defer unlease(group)
+			defer unlease(queue)
+			defer unlease(bucket)
+
+			w.terminate(ctx, step, state, w.transformError(ctx, step, w.runStepWithGrace(ctx, step, state)))
+		})
+	}
+	return false
+}
+
+// exited counts an inflight goroutine out, the last one ticks again,
+// since the previous tick may have observed it still inflight, i.e. to apply AddDependency or detect stuck.
+func (w *Workflow) exited() {
+	if w.inflight.Add(-1) == 0 {
+		w.tryTick()
+	}
+}
+
+// execute runs fn with the executor (see WithExecutor), default spawns a goroutine.
+func (w *Workflow) execute(fn func()) {
+	if w.executor != nil {
+		w.executor(fn)
+		return
+	}
+	go fn()
+}
+
+// terminate sets the terminal status of the Step by its error.
+func (w *Workflow) terminate(ctx context.Context, step Steper, state *State, err error) {
+	status := w.statusOf(err, state.Option())
+	state.SetError(err) // set error before status, so the error is ready once terminated
+	var suspended ErrSuspended
+	if status == Suspended && errors.As(err, &suspended) {
+		state.setPartial(suspended.State)
+		w.suspending.Store(true) // a Suspended Step suspends the Workflow, its Downstreams would never start otherwise
+	}
+	w.setStatus(ctx, step, status)
+	if option := state.Option(); isFailure(status) && (option.Critical || w.FailFast && !option.Optional) {
+		w.cancel(ErrFailFast{Step: step, Cause: err})
+	}
+}
+
+// signaled returns true if the Step is free to start, i.e. it has no WaitFor signal or the signal is received.
+//
+// Otherwise it starts a goroutine (once per run) to wait for the signal and tick again,
+// the goroutine counts as inflight, so a Step waiting for signal is not a deadlock.
+func (w *Workflow) signaled(ctx context.Context, step Steper, state *State) bool {
+	option := state.Option()
+	if option == nil || option.WaitFor == nil || state.isSignaled() {
+		return true
+	}
+	select {
+	case <-option.WaitFor:
+		state.signal()
+		return true
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		w.terminate(ctx, step, state, err)
+		w.signalTick()
+		return false
 	}
+	if !state.watch() {
+		return false
+	}
+	w.waitGroup.Add(1)
+	w.inflight.Add(1)
+	go func() {
+		defer w.waitGroup.Done()
+		defer w.exited() // after signalTick, so the signal is visible once inflight is 0
+		defer w.signalTick()
+		select {
+		case <-option.WaitFor:
+			state.signal()
+		case <-ctx.Done():
+		}
+	}()
 	return false
 }
 
+// idle returns the Pending Steps with terminated Upstreams, sorted by name,
+// if no Step is running and no tick is signaled, which means the Workflow is waiting for external signals (see WaitFor).
+func (w *Workflow) idle() []Steper {
+	if len(w.onIdle) == 0 {
+		return nil
+	}
+	for _, state := range w.state {
+		if state.GetStatus() == Running {
+			return nil
+		}
+	}
+	if len(w.oneStepTerminated) > 0 {
+		return nil
+	}
+	var pending []Steper
+	for step, state := range w.state {
+		if state.GetStatus() == Pending && !isAnyUpstreamNotTerminated(w.UpstreamOf(step)) {
+			pending = append(pending, step)
+		}
+	}
+	slices.SortFunc(pending, func(a, b Steper) int { return strings.Compare(String(a), String(b)) })
+	return pending
+}
+
+// stuck returns the non-terminated Steps with their non-terminated Upstreams,
+// if no Step is running and no tick is signaled, which means the Workflow would never progress.
+func (w *Workflow) stuck() ErrDeadlock {
+	if w.inflight.Load() > 0 || len(w.oneStepTerminated) > 0 {
+		return nil
+	}
+	stuck := make(ErrDeadlock)
+	for step, state := range w.state {
+		if state.GetStatus().IsTerminated() {
+			continue
+		}
+		stuck[step] = []Steper{}
+		for up, statusErr := range w.UpstreamOf(step) {
+			if !statusErr.Status.IsTerminated() {
+				stuck[step] = append(stuck[step], up)
+			}
+		}
+	}
+	return stuck
+}
+
+// setStatus is the only place to transit the status of root Steps during Do,
+// it emits the transition as StepEvent before the status is set (see Run),
+// so events of Upstreams are always emitted before events of their Downstreams.
+//
+// Callbacks registered by OnResult are called after the Step terminated.
+func (w *Workflow) setStatus(ctx context.Context, step Steper, status StepStatus) {
+	state := w.StateOf(step)
+	event := StepEvent{Step: step, StatusError: StatusError{Status: status, Err: state.GetStatusError().Err}}
+	if w.events != nil {
+		w.events.push(event)
+	}
+	if w.recorder != nil {
+		w.recorder.record(event, w.LabelsOf(step), w.Clock().Now())
+	}
+	state.SetStatus(status)
+	if status.IsTerminated() {
+		state.Lock()
+		state.order = int(w.terminated.Add(1))
+		state.Unlock()
+	}
+	if status == Running {
+		for _, r := range w.reporters {
+			r.ReportStart(w.idOf(step), w.Clock().Now())
+		}
+	}
+	if !status.IsTerminated() {
+		return
+	}
+	for _, r := range w.reporters {
+		r.ReportEnd(w.idOf(step), status, state.GetStatusError().Err, w.Clock().Now())
+	}
+	for s, callbacks := range w.results {
+		if w.RootOf(s) == step {
+			for _, callback := range callbacks {
+				callback(ctx, state.GetStatusError())
+			}
+		}
+	}
+}
+
+// transformError applies the error transformers in order to the non-nil error of Step, see WithErrorTransformer.
+func (w *Workflow) transformError(ctx context.Context, step Steper, err error) error {
+	for _, transform := range w.errorTransformers {
+		if err == nil {
+			return nil
+		}
+		err = transform(ctx, step, err)
+	}
+	return err
+}
+
+// statusOf maps the error returned from Step to its terminal status.
+func (w *Workflow) statusOf(err error, option *StepOption) StepStatus {
+	if err == nil {
+		return Succeeded
+	}
+	if option != nil && option.PanicAs.IsTerminated() && errors.As(err, new(ErrPanic)) {
+		return option.PanicAs
+	}
+	for _, mapper := range w.statusMappers {
+		if status := mapper(err); status.IsTerminated() {
+			return status
+		}
+	}
+	switch {
+	case errors.As(err, new(ErrSuspended)):
+		return Suspended
+	case isStepTimeout(err): // before it's regarded as canceled
+		return TimedOut
+	case w.isCanceled(err):
+		return Canceled
+	case errors.As(err, new(ErrSkip)): // by type, same as ErrCancel in DefaultIsCanceled
+		return Skipped
+	default:
+		return Failed
+	}
+}
+
+// evaluate decides the next status of the Step based on its terminated Upstreams.
+//
+// Upstreams with expected statuses (see DependsOnStatus) are checked here,
+// the rest Upstreams are passed to the Condition, unless any of them is Skipped with WithSkipPropagation.
+func (w *Workflow) evaluate(ctx context.Context, option *StepOption, ups map[Steper]StatusError) StepStatus {
+	cond := DefaultCondition
+	if option != nil && option.Condition != nil {
+		cond = option.Condition
+	}
+	expects := make(map[Steper][]StepStatus)
+	if option != nil {
+		for up, statuses := range option.UpstreamStatus {
+			root := w.RootOf(w.canonical(up))
+			expects[root] = append(expects[root], statuses...)
+		}
+	}
+	rest := make(map[Steper]StatusError)
+	for up, statusErr := range ups {
+		if _, ok := expects[up]; !ok {
+			if isFailure(statusErr.Status) && w.StateOf(up).Option().Optional {
+				statusErr.Status = Succeeded // failure of optional Step is regarded as satisfied
+			}
+			rest[up] = statusErr
+		}
+	}
+	if w.skipPropagation {
+		for _, statusErr := range rest {
+			if statusErr.Status == Skipped {
+				return Skipped
+			}
+		}
+	}
+	nextStatus := cond(ctx, rest)
+	if nextStatus.IsTerminated() {
+		return nextStatus
+	}
+	for up, statuses := range expects {
+		if statusErr, ok := ups[up]; ok && !slices.Contains(statuses, statusErr.Status) {
+			return Skipped
+		}
+	}
+	return nextStatus
+}
+
+// runStepWithGrace runs the Step, and stops waiting for it the grace period after ctx is done, see WithCancelGracePeriod.
+//
+// The abandoned Step keeps running with its State, so the next Do or Reset waits for it to return, see waitAbandoned.
+func (w *Workflow) runStepWithGrace(ctx context.Context, step Steper, state *State) error {
+	ctx = withStepContext(ctx, w, step) // captures the fields of the run, the abandoned Step may outlive it
+	if w.cancelGrace <= 0 {
+		return w.runStep(ctx, step, state)
+	}
+	result := make(chan error, 1) // buffered, so the abandoned Step is able to exit
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		result <- w.runStep(ctx, step, state)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+	}
+	grace := w.clock.Timer(w.cancelGrace)
+	defer grace.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-grace.C:
+		state.setAbandoned(returned)
+		return Cancel(ErrCancelGracePeriod{GracePeriod: w.cancelGrace})
+	}
+}
+
+// waitAbandoned waits for the Steps abandoned after the grace period in previous runs to return,
+// before their States are reused, see WithCancelGracePeriod.
+func (w *Workflow) waitAbandoned() {
+	for _, state := range w.state {
+		state.waitAbandoned()
+	}
+}
+
 func (w *Workflow) runStep(ctx context.Context, step Steper, state *State) error {
+	state.heartbeat(w.clock.Now()) // the Step is alive since it started, see Heartbeat
+	// the Step could be canceled with cause by CancelStep
+	ctx, cancelCause := context.WithCancelCause(ctx)
+	defer cancelCause(nil)
+	state.setCancel(cancelCause)
+	defer state.setCancel(nil)
+	option := state.Option()
+	if option != nil && option.LockOSThread {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	// stagger the start of the Step
+	if err := w.startJitter(ctx, option); err != nil {
+		return w.withCancelCause(ctx, err, nil, time.Time{})
+	}
 	// set Step-level timeout for the Step
 	var notAfter time.Time
-	option := state.Option()
 	if option != nil && option.Timeout != nil {
-		notAfter = w.clock.Now().Add(*option.Timeout)
+		timeout := w.jitterTimeout(*option.Timeout)
+		option.Timeout = &timeout // option is a copy, the jittered timeout is reported by ErrStepTimeout
+		notAfter = w.clock.Now().Add(timeout)
 		var cancel func()
 		ctx, cancel = w.clock.WithDeadline(ctx, notAfter)
 		defer cancel()
 	}
 	// run the Step with or without retry
 	do := w.makeDoForStep(step, state)
-	return w.retry(option.RetryOption)(ctx, do, notAfter)
+	err := w.retry(option.RetryOption)(ctx, do, notAfter)
+	return w.withCancelCause(ctx, err, option.Timeout, notAfter)
+}
+
+// startJitter waits a random delay in [0, max) before the Step starts, see WithStartJitter.
+func (w *Workflow) startJitter(ctx context.Context, option *StepOption) error {
+	maxJitter := w.maxStartJitter
+	if option != nil && option.StartJitter != nil {
+		maxJitter = *option.StartJitter
+	}
+	if maxJitter <= 0 {
+		return nil
+	}
+	timer := w.clock.Timer(time.Duration(w.random(int64(maxJitter))))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isCanceled determines whether the error of Step is regarded as canceled, see WithIsCanceled.
+func (w *Workflow) isCanceled(err error) bool {
+	if w.isCanceledFunc != nil {
+		return w.isCanceledFunc(err)
+	}
+	return DefaultIsCanceled(err)
+}
+
+// random returns a random number in [0, n), see WithRand.
+func (w *Workflow) random(n int64) int64 {
+	if w.rand != nil {
+		return w.rand(n)
+	}
+	return rand.Int63n(n)
+}
+
+// jitterTimeout spreads the timeout randomly by the fraction, see WithStepTimeoutJitter.
+func (w *Workflow) jitterTimeout(timeout time.Duration) time.Duration {
+	delta := int64(float64(timeout) * w.timeoutJitter)
+	if delta <= 0 {
+		return timeout
+	}
+	return timeout + time.Duration(w.random(2*delta+1)-delta)
+}
+
+// isStepTimeout returns true if the Step is canceled due to its own Timeout, see withCancelCause,
+// the ErrStepTimeout of other Steps (i.e. the cause of ErrFailFast) doesn't count.
+func isStepTimeout(err error) bool {
+	var cancelCause ErrCancelCause
+	if !errors.As(err, &cancelCause) {
+		return false
+	}
+	_, ok := cancelCause.Cause.(ErrStepTimeout)
+	return ok
+}
+
+// withCancelCause attaches the cause of cancellation to the error of a canceled Step.
+func (w *Workflow) withCancelCause(ctx context.Context, err error, timeout *time.Duration, notAfter time.Time) error {
+	if err == nil || ctx.Err() == nil || !w.isCanceled(err) {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) &&
+		!notAfter.IsZero() && !w.clock.Now().Before(notAfter) { // Step level timeouted
+		cause = ErrStepTimeout{Timeout: *timeout}
+	}
+	if cause == nil || errors.Is(err, cause) {
+		return err
+	}
+	return ErrCancelCause{Err: err, Cause: cause}
+}
+
+// CancelStep cancels the running Step with the cause,
+// the cause will be attached to the error of the Step, see ErrCancelCause.
+//
+// CancelStep is no-op if the Step is not running.
+func (w *Workflow) CancelStep(step Steper, cause error) {
+	if state := w.StateOf(step); state != nil {
+		state.cancelWithCause(cause)
+	}
+}
+
+// Abort cancels the whole run of Workflow from inside a Step's Input or Do,
+// Steps return the error from Abort, then they are Failed with ErrAbort.
+//
+//	Func("check", func(ctx context.Context) error {
+//		if fatal {
+//			return Abort(ctx, fmt.Errorf("fatal condition"))
+//		}
+//		...
+//	})
+//
+// The outermost Workflow is canceled with ErrAbort as the cause,
+// so other Steps are Canceled with ErrAbort attached (see ErrCancelCause),
+// and the error returned from Do can be checked by errors.As(err, &ErrAbort{}).
+// Abort only returns ErrAbort if ctx is not from a running Workflow.
+func Abort(ctx context.Context, err error) error {
+	abort := ErrAbort{Err: err}
+	sc := stepContextFrom(ctx)
+	if sc == nil {
+		return abort
+	}
+	abort.Step = sc.step
+	for sc.parent != nil {
+		sc = sc.parent
+	}
+	if sc.cancel != nil {
+		sc.cancel(abort)
+	}
+	return abort
 }
 
 // makeDoForStep is panic-free from Step's Do and Input.
 func (w *Workflow) makeDoForStep(step Steper, state *State) func(ctx context.Context) error {
-	return func(ctx context.Context) error {
+	return func(ctx context.Context) (err error) {
+		start := w.clock.Now()
+		defer func() {
+			state.addAttempt(AttemptRecord{Start: start, End: w.clock.Now(), Err: err})
+		}()
 		do := func(fn func() error) error { return fn() }
-		if w.DontPanic {
+		if w.DontPanic || state.Option().RecoverPanic {
 			do = catchPanicAsError
 		}
 		return do(func() error {
+			if err := w.waitRateLimit(ctx, state); err != nil {
+				return err
+			}
 			var err error
 			ctx, afterStep := w.notifyStep(ctx, step)
 			defer func() {
@@ -480,11 +2452,62 @@ func (w *Workflow) makeDoForStep(step Steper, state *State) func(ctx context.Con
 				err = ErrInput{Err: ierr}
 				return err
 			}
-			err = step.Do(ctx)
+			// skip Do if the Fingerprint is unchanged since the checkpoint
+			if cached, ferr := w.fingerprint(ctx, step, state); ferr != nil || cached {
+				err = ferr
+				return err
+			}
+			// skip Do if the Output is cached
+			option := state.Option()
+			if w.loadCache(step, state, option) {
+				return nil
+			}
+			// induce faults before Do, testing only, see WithFaultInjector
+			if err = w.injectFault(ctx, step); err != nil {
+				return err
+			}
+			err = w.stepDo()(ctx, step)
+			if err == nil {
+				w.storeCache(step, option)
+			}
 			return err
 		})
 	}
 }
+
+// waitRateLimit blocks until the rate limiter of the Step permits, or the context is done.
+func (w *Workflow) waitRateLimit(ctx context.Context, state *State) error {
+	option := state.Option()
+	if option == nil || option.RateLimit == "" {
+		return nil
+	}
+	limiter, ok := w.rateLimiters[option.RateLimit]
+	if !ok {
+		return nil
+	}
+	if err := limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, ok := ctx.Deadline(); ok { // limiter fails fast if it would wait beyond the deadline
+			return fmt.Errorf("%w: %s", context.DeadlineExceeded, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// stepDo composes middlewares, the first one is the outermost.
+func (w *Workflow) stepDo() StepDo {
+	do := StepDo(func(ctx context.Context, step Steper) error { return step.Do(ctx) })
+	for i := len(w.middlewares) - 1; i >= 0; i-- {
+		if w.middlewares[i] != nil {
+			do = w.middlewares[i](do)
+		}
+	}
+	return do
+}
+
 func (w *Workflow) notifyStep(ctx context.Context, step Steper) (context.Context, func(context.Context, Steper, error)) {
 	afterStep := []func(context.Context, Steper, error){}
 	for _, notify := range w.notify {
@@ -501,14 +2524,70 @@ func (w *Workflow) notifyStep(ctx context.Context, step Steper) (context.Context
 		}
 	}
 }
-func (w *Workflow) lease() {
-	if w.leaseBucket != nil {
-		w.leaseBucket <- struct{}{}
+
+// leaseBucketOf returns the lease bucket of the phase, fallback to the Workflow's.
+func (w *Workflow) leaseBucketOf(phase Phase) chan struct{} {
+	if bucket, ok := w.phaseLeaseBuckets[phase]; ok {
+		return bucket
 	}
+	return w.leaseBucket
 }
-func (w *Workflow) unlease() {
-	if w.leaseBucket != nil {
-		<-w.leaseBucket
+
+// queueLeaseBucketOf returns the lease bucket of the Step's queue, nil means the Step is not in any queue.
+func (w *Workflow) queueLeaseBucketOf(option *StepOption) chan struct{} {
+	if option == nil || option.Queue == "" {
+		return nil
+	}
+	return w.queueLeaseBuckets[option.Queue]
+}
+
+// groupLeaseBucketOf returns the lease bucket of the Step's group, nil means the group is not limited.
+func (w *Workflow) groupLeaseBucketOf(option *StepOption) chan struct{} {
+	if option == nil || option.Group == "" {
+		return nil
+	}
+	return w.groupLeaseBuckets[option.Group]
+}
+
+// lease takes a lease from the bucket, it blocks until the lease is taken,
+// the context is done, or the lease timeout (see WithLeaseTimeout) exceeded.
+func (w *Workflow) lease(ctx context.Context, bucket chan struct{}) error {
+	if bucket == nil {
+		return nil
+	}
+	ctxDone := ctx.Done()
+	if ctx.Err() != nil {
+		ctxDone = nil // Steps still to run after canceled (i.e. When(Always)) wait for the lease
+	}
+	var timeout <-chan time.Time
+	if w.leaseTimeout > 0 {
+		timer := w.clock.Timer(w.leaseTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case bucket <- struct{}{}:
+		return nil
+	case <-ctxDone:
+		return ctx.Err()
+	case <-timeout:
+		return ErrLeaseTimeout{Timeout: w.leaseTimeout}
+	}
+}
+func tryLease(bucket chan struct{}) bool {
+	if bucket == nil {
+		return true
+	}
+	select {
+	case bucket <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+func unlease(bucket chan struct{}) {
+	if bucket != nil {
+		<-bucket
 	}
 }
 
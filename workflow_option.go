@@ -1,6 +1,12 @@
 package flow
 
-import "github.com/benbjohnson/clock"
+import (
+	"context"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"golang.org/x/time/rate"
+)
 
 // WorkflowOption alters the behavior of a Workflow.
 type WorkflowOption func(*Workflow)
@@ -13,6 +19,14 @@ func (s *Workflow) Options(opts ...WorkflowOption) *Workflow {
 }
 
 // WithMaxConcurrency limits the max concurrency of Steps in StepStatusRunning.
+//
+// Each Workflow has its own lease bucket, leases are not shared across nesting levels.
+// When a Workflow is nested as a Step in another Workflow,
+//   - the nested Workflow occupies one lease of the outer Workflow during its whole Do,
+//   - Steps inside the nested Workflow only take leases from the nested Workflow's bucket.
+//
+// So the nested Workflow runs with its own concurrency budget,
+// and the outer Workflow orchestrates it as a single Step.
 func WithMaxConcurrency(n int) WorkflowOption {
 	return func(s *Workflow) {
 		// use buffered channel as a sized bucket
@@ -22,6 +36,317 @@ func WithMaxConcurrency(n int) WorkflowOption {
 	}
 }
 
+// WithCancelGracePeriod bounds how long the Workflow waits for a running Step to return after the Workflow is canceled,
+// like SIGTERM-then-SIGKILL.
+//
+// Once canceled, the context of the Step is canceled, then
+//   - if the Step returns within the grace period, its status is decided by its error as usual, i.e. Succeeded if it returns nil,
+//   - otherwise the Step is Canceled with ErrCancelGracePeriod, and the Workflow moves on without waiting for it.
+//
+// Be aware that Go can't kill a goroutine, the abandoned Step keeps running in background and may outlive Do,
+// the next Do (or Reset) waits for it to return before running the Step again.
+// Without the option, the Workflow waits until all running Steps return.
+// The grace period is measured by the Workflow's clock, see WithClock.
+func WithCancelGracePeriod(d time.Duration) WorkflowOption {
+	return func(w *Workflow) {
+		w.cancelGrace = d
+	}
+}
+
+// WithLeaseTimeout limits how long a runnable Step waits for a lease from WithMaxConcurrency (or WithPhaseConcurrency),
+// the Step fails with ErrLeaseTimeout if it can't acquire a lease within the timeout.
+//
+// Without the option, the Step waits until a lease is released, or the Workflow is canceled.
+// The timeout is measured by the Workflow's clock, see WithClock.
+func WithLeaseTimeout(timeout time.Duration) WorkflowOption {
+	return func(w *Workflow) {
+		w.leaseTimeout = timeout
+	}
+}
+
+// WithExecutor submits Steps to the executor instead of spawning a goroutine for each Step,
+// i.e. to reuse goroutines from a pool.
+//
+//	pool, _ := ants.NewPool(100)
+//	WithExecutor(func(fn func()) { _ = pool.Submit(fn) })
+//
+// The executor must run fn eventually, in another goroutine, Do waits until all submitted fn return.
+// Executor should not block for long, since the Workflow submits Steps one by one.
+func WithExecutor(executor func(fn func())) WorkflowOption {
+	return func(w *Workflow) {
+		w.executor = executor
+	}
+}
+
+// TaskGroup submits tasks to run in goroutines, it's implemented by *errgroup.Group (golang.org/x/sync/errgroup).
+type TaskGroup interface {
+	Go(task func() error)
+}
+
+// WithTaskGroup runs Steps as tasks of the group, i.e. to share the goroutine budget of an errgroup across subsystems.
+//
+//	var group errgroup.Group
+//	group.SetLimit(10) // Steps and other tasks of the group run at most 10 at a time
+//	workflow := new(Workflow).Options(WithTaskGroup(&group))
+//	group.Go(func() error { return workflow.Do(ctx) })
+//	...
+//	err := group.Wait()
+//
+// The tasks always return nil, errors of Steps are reported by Do as usual, so they don't cancel the group,
+// return the error of Do in a task as above to do so.
+// Submitting to a group with limit blocks the Workflow from starting more Steps until a task returns,
+// be aware Do itself takes a slot if it's run in the same group, so the limit must be more than 1.
+// It's built on WithExecutor, and applies to the root Steps, nested Workflows run with their own options.
+func WithTaskGroup(group TaskGroup) WorkflowOption {
+	return WithExecutor(func(fn func()) {
+		group.Go(func() error {
+			fn()
+			return nil
+		})
+	})
+}
+
+// WithStartJitter introduces a random delay in [0, max) before each Step starts,
+// it smooths out the load spikes when many Steps become runnable at the same time.
+//
+// The delay is waited with the Workflow's clock (see WithClock), and is canceled with the Step's context.
+// The delay happens after the Step takes the lease (see WithMaxConcurrency), and before its Timeout starts.
+// Use AddSteps.StartJitter to override it for specific Steps.
+func WithStartJitter(max time.Duration) WorkflowOption {
+	return func(w *Workflow) {
+		w.maxStartJitter = max
+	}
+}
+
+// WithStepTimeoutJitter spreads the Timeout (see AddSteps.Timeout) of each Step randomly by ±fraction,
+// so the timeouts of Steps started together don't fire at the same instant, i.e. 0.1 for ±10%.
+//
+// The jitter applies on top of the Timeout of each run of the Step, Steps without Timeout are not affected.
+// The jittered timeout is measured by the Workflow's clock (see WithClock), and drawn from WithRand.
+func WithStepTimeoutJitter(fraction float64) WorkflowOption {
+	return func(w *Workflow) {
+		w.timeoutJitter = fraction
+	}
+}
+
+// WithRand sets the random source of the Workflow, it returns a random number in [0, n),
+// default to math/rand.Int63n. It's useful to make the randomness deterministic in unit test,
+// i.e. WithStartJitter and WithStepTimeoutJitter.
+func WithRand(rand func(n int64) int64) WorkflowOption {
+	return func(w *Workflow) {
+		w.rand = rand
+	}
+}
+
+// WithPhaseConcurrency limits the max concurrency of Steps in StepStatusRunning in the phase,
+// it overrides WithMaxConcurrency for the phase.
+//
+// Phases run sequentially, so it only bounds the parallelism within the phase.
+//
+//	WithPhaseConcurrency(PhaseInit, 1) // Init Steps run one at a time
+func WithPhaseConcurrency(phase Phase, n int) WorkflowOption {
+	return func(s *Workflow) {
+		if s.phaseLeaseBuckets == nil {
+			s.phaseLeaseBuckets = make(map[Phase]chan struct{})
+		}
+		s.phaseLeaseBuckets[phase] = make(chan struct{}, n)
+	}
+}
+
+// WithPhaseTimeout limits the wall-clock duration of the phase, since the phase starts.
+//
+// When the timeout fires, the running Steps in the phase are canceled with ErrPhaseTimeout as the cause,
+// and the rest Steps in the phase are Canceled (with DefaultCondition, see Condition),
+// then the Workflow moves on to the next phase, use WithPhaseTimeoutAbort to cancel the whole Workflow instead.
+//
+//	WithPhaseTimeout(PhaseInit, time.Minute)
+//	WithPhaseTimeout(PhaseMain, 10*time.Minute)
+func WithPhaseTimeout(phase Phase, timeout time.Duration) WorkflowOption {
+	return func(w *Workflow) {
+		if w.phaseTimeouts == nil {
+			w.phaseTimeouts = make(map[Phase]phaseTimeout)
+		}
+		w.phaseTimeouts[phase] = phaseTimeout{timeout: timeout}
+	}
+}
+
+// WithPhaseTimeoutAbort is the same as WithPhaseTimeout,
+// except that the whole Workflow is canceled with ErrPhaseTimeout when the timeout fires.
+func WithPhaseTimeoutAbort(phase Phase, timeout time.Duration) WorkflowOption {
+	return func(w *Workflow) {
+		if w.phaseTimeouts == nil {
+			w.phaseTimeouts = make(map[Phase]phaseTimeout)
+		}
+		w.phaseTimeouts[phase] = phaseTimeout{timeout: timeout, abort: true}
+	}
+}
+
+// PhasePolicy decides what to do with a phase if any previous phase has failures, see WithPhaseOnFailure.
+type PhasePolicy int
+
+const (
+	OnFailureRunAnyway PhasePolicy = iota // run the phase as usual, it's the default
+	OnFailureSkip                         // Skip all Steps in the phase
+	OnFailureAbort                        // Cancel all Steps in the phase, and cancel the Workflow with ErrPhaseAborted
+)
+
+// WithPhaseOnFailure sets the policy of the phase when any Step in previous phases Failed (Optional Steps excluded).
+//
+// By default (OnFailureRunAnyway), phases run in order regardless of failures in previous phases,
+// i.e. Main runs even if Init failed, the Steps decide by their Conditions.
+//
+//	WithPhaseOnFailure(PhaseMain, OnFailureSkip)       // skip Main if Init failed
+//	WithPhaseOnFailure(PhaseDefer, OnFailureRunAnyway) // always run Defer, it's the default
+//
+// With OnFailureAbort, Steps in the later phases are Canceled unless their Conditions decide to run, i.e. Always.
+func WithPhaseOnFailure(phase Phase, policy PhasePolicy) WorkflowOption {
+	return func(w *Workflow) {
+		if w.phasePolicies == nil {
+			w.phasePolicies = make(map[Phase]PhasePolicy)
+		}
+		w.phasePolicies[phase] = policy
+	}
+}
+
+// AfterPhase is called once a phase terminated, see WithAfterPhase.
+type AfterPhase func(ctx context.Context, phase Phase, err error) error
+
+// WithAfterPhase registers a callback called once all Steps in the phase terminated, before the next phase begins,
+// i.e. to persist progress (see SaveCheckpoint) or make decisions between phases.
+//
+// err is the ErrWorkflow of Steps in the phase, nil if no Step has error. Phases without Steps are not called back.
+// Returning error aborts the remaining phases, the Workflow is canceled with ErrAfterPhase,
+// and the Pending Steps are Canceled with it.
+//
+//	WithAfterPhase(func(ctx context.Context, phase Phase, err error) error {
+//		return workflow.SaveCheckpoint(file)
+//	})
+func WithAfterPhase(callback AfterPhase) WorkflowOption {
+	return func(w *Workflow) {
+		if callback != nil {
+			w.afterPhases = append(w.afterPhases, callback)
+		}
+	}
+}
+
+// WithQueue limits the max concurrency of running Steps tagged with the queue name, see AddSteps.Queue.
+//
+// Steps in the queue take a lease from the queue in addition to the lease from WithMaxConcurrency
+// (or WithPhaseConcurrency), so the queue models a dedicated resource pool, i.e. GPUs.
+// Steps waiting for the queue remain Pending, they don't block other Steps from starting.
+// Steps without queue, or with a queue not set by WithQueue, are only limited by WithMaxConcurrency.
+//
+//	workflow := new(Workflow).Options(WithMaxConcurrency(10), WithQueue("gpu", 2))
+//	workflow.Add(Steps(train1, train2, train3).Queue("gpu")) // at most 2 of them run at the same time
+func WithQueue(name string, size int) WorkflowOption {
+	return func(w *Workflow) {
+		if w.queueLeaseBuckets == nil {
+			w.queueLeaseBuckets = make(map[string]chan struct{})
+		}
+		w.queueLeaseBuckets[name] = make(chan struct{}, size)
+	}
+}
+
+// WithGroupConcurrency limits the max concurrency of running Steps in the group, see AddSteps.Group.
+//
+// Steps in the group take a lease from the group in addition to the leases from WithQueue and WithMaxConcurrency,
+// other groups are not affected, i.e. at most 3 "database" Steps run at the same time.
+// Steps waiting for the group remain Pending, they don't block other Steps from starting.
+//
+// To avoid deadlock, the leases are taken in order of group, queue, then max concurrency,
+// the Step gives up the taken leases and stays Pending if the group or queue is full,
+// only the lease from max concurrency is waited, which is always released by running Steps.
+//
+//	workflow := new(Workflow).Options(WithGroupConcurrency("database", 3))
+//	workflow.Add(Steps(migrate1, migrate2, migrate3, migrate4).Group("database"))
+func WithGroupConcurrency(name string, n int) WorkflowOption {
+	return func(w *Workflow) {
+		if w.groupLeaseBuckets == nil {
+			w.groupLeaseBuckets = make(map[string]chan struct{})
+		}
+		w.groupLeaseBuckets[name] = make(chan struct{}, n)
+	}
+}
+
+// WithMaxSteps limits the max number of root Steps in the Workflow,
+// it guards against accidental explosion when Steps are generated, i.e. by Sequential or FullyConnect.
+//
+// Set it before adding Steps, Steps exceeding the limit are refused by Add, together with their configs
+// and the dependencies on them, and Do returns ErrTooManySteps naming the first refused Step.
+// Steps in a nested Workflow are counted by the nested Workflow, with its own limit.
+func WithMaxSteps(n int) WorkflowOption {
+	return func(w *Workflow) {
+		w.maxSteps = n
+	}
+}
+
+// WithDynamicSteps allows at most n new Steps added by AddDependency in each run,
+// AddDependency refuses new Steps without it.
+func WithDynamicSteps(n int) WorkflowOption {
+	return func(w *Workflow) {
+		w.maxDynamic = n
+	}
+}
+
+// WithMaxCost stops scheduling new Steps once the total cost (see AddSteps.Cost) would exceed max,
+// the cost of a Step is accounted when it starts, regardless of its result.
+//
+// The Steps can't afford are Canceled with ErrMaxCost, their Downstreams are Skipped with DefaultCondition.
+func WithMaxCost(max float64) WorkflowOption {
+	return func(w *Workflow) {
+		w.maxCost = max
+	}
+}
+
+// WithSkipPropagation makes Downstreams of a Skipped Step Skipped as well, without evaluating their Conditions,
+// so the skip cascades transitively.
+//
+// Upstreams with expected statuses (see DependsOnStatus) are not affected,
+// i.e. a Step depends on an Upstream being Skipped still runs.
+// Without this option, Conditions decide whether to run, i.e. Always runs after a Skipped Upstream.
+func WithSkipPropagation() WorkflowOption {
+	return func(w *Workflow) {
+		w.skipPropagation = true
+	}
+}
+
+// WithStrictReachability makes Do fail with ErrUnreachable before running anything,
+// if any Step can never become runnable given the phases and dependencies, see Workflow.Unreachable.
+//
+// Without this option, such Steps are left Pending until Do reports ErrDeadlock,
+// call Workflow.Unreachable to inspect them as warnings instead.
+func WithStrictReachability() WorkflowOption {
+	return func(w *Workflow) {
+		w.strictReach = true
+	}
+}
+
+// WithClock sets the clock used by Workflow, it's useful to pass a *clock.Mock in tests.
+//
+// Workflow uses the clock for Step level timeout (see Timeout), retry level timeout (see RetryOption.Timeout),
+// the elapsed time in RetryOption.StopIf and the retry intervals, unless RetryOption.Timer is set.
+//
+// Advancing the mock clock only fires timers already created,
+// so advance it after the Step starts, otherwise the tick is lost.
+// Timers of the timeouts are created before Notify.BeforeStep is called,
+// so BeforeStep (or a signal from the Step's Do) is a safe point to advance the clock.
+//
+//	mock := clock.NewMock()
+//	started := make(chan struct{})
+//	workflow := new(Workflow).Options(
+//		WithClock(mock),
+//		WithNotify(Notify{
+//			BeforeStep: func(ctx context.Context, _ Steper) context.Context {
+//				started <- struct{}{}
+//				return ctx
+//			},
+//		}),
+//	)
+//	go func() {
+//		for range started {
+//			mock.Add(time.Minute)
+//		}
+//	}()
 func WithClock(clock clock.Clock) WorkflowOption {
 	return func(s *Workflow) {
 		s.clock = clock
@@ -34,6 +359,201 @@ func WithNotify(notify Notify) WorkflowOption {
 	}
 }
 
+// WithReporter reports the start and end of each Step to the reporter by stable ids, see Reporter.
+//
+// Different from Notify, which is called around each attempt with the Step,
+// Reporter is called once per run of the Step with its terminal status.
+func WithReporter(reporter Reporter) WorkflowOption {
+	return func(w *Workflow) {
+		w.reporters = append(w.reporters, reporter)
+	}
+}
+
+// WithRecorder records the status transitions of root Steps with timestamps into the recorder,
+// to inspect or visualize the run later, see Recorder.
+func WithRecorder(recorder *Recorder) WorkflowOption {
+	return func(w *Workflow) {
+		w.recorder = recorder
+	}
+}
+
+// WithCache caches the Outputs of Functions in the cache across runs, see AddSteps.Cache.
+//
+// The cache is owned by the caller, share it among Workflows to reuse the Outputs, i.e.
+//
+//	cache := new(flow.MemoryCache)
+//	workflow := new(flow.Workflow).Options(flow.WithCache(cache))
+//
+// Without the option, AddSteps.Cache takes no effect.
+func WithCache(cache Cache) WorkflowOption {
+	return func(w *Workflow) {
+		w.cache = cache
+	}
+}
+
+// WithOnIdle registers a callback called when the Workflow becomes idle but not done,
+// i.e. it launched all Steps it can, no Step is running, and the pending Steps are waiting for external signals (see AddSteps.WaitFor).
+// It's useful for manual gates, i.e. to tell the UI which Steps are waiting for approval.
+//
+// pending are the Pending Steps whose Upstreams are terminated, sorted by name.
+// The callback is called once each time the Workflow becomes idle, synchronously in the tick, so keep it fast.
+// Different from ErrDeadlock, which means the Workflow has no way forward, an idle Workflow progresses once a signal is received.
+func WithOnIdle(onIdle func(pending []Steper)) WorkflowOption {
+	return func(w *Workflow) {
+		if onIdle != nil {
+			w.onIdle = append(w.onIdle, onIdle)
+		}
+	}
+}
+
+// OnResult registers a typed callback receiving the Output of the Function after it terminated.
+//
+// The callback is called once the Step terminated in any status, even if it's Failed, Skipped or Canceled,
+// in that case the output is the zero value and err is the error of the Step (could be nil).
+// Different from Notify.AfterStep, which is called after each attempt with the Step only.
+//
+//	workflow.Options(OnResult(step, func(ctx context.Context, output int, err error) {
+//		log.Printf("%s: %d, %v", step, output, err)
+//	}))
+func OnResult[I, O any](step *Function[I, O], callback func(ctx context.Context, output O, err error)) WorkflowOption {
+	return func(w *Workflow) {
+		if w.results == nil {
+			w.results = make(map[Steper][]onResult)
+		}
+		w.results[step] = append(w.results[step], func(ctx context.Context, se StatusError) {
+			var output O
+			if se.Status == Succeeded {
+				output = step.GetOutput()
+			}
+			callback(ctx, output, se.Err)
+		})
+	}
+}
+
+// WithStepMiddleware wraps every Step's Do with the middleware.
+//
+// Multiple middlewares are composed in order, the first one is the outermost.
+// Middleware is inside the retry and timeout machinery, so it sees each attempt of the Step.
+func WithStepMiddleware(mw StepMiddleware) WorkflowOption {
+	return func(w *Workflow) {
+		w.middlewares = append(w.middlewares, mw)
+	}
+}
+
+// WithRateLimit sets a rate limiter for Steps tagged with the key, see AddSteps.RateLimit.
+//
+// Steps sharing the same key draw from a common rate limiter,
+// blocking (respecting context) before each attempt of Do.
+// Steps without key, or with a key not set by WithRateLimit, are unlimited.
+//
+// Different from WithMaxConcurrency which bounds how many Steps run at the same time,
+// WithRateLimit bounds how often Steps start.
+func WithRateLimit(key string, limit rate.Limit, burst int) WorkflowOption {
+	return func(w *Workflow) {
+		if w.rateLimiters == nil {
+			w.rateLimiters = make(map[string]*rate.Limiter)
+		}
+		w.rateLimiters[key] = rate.NewLimiter(limit, burst)
+	}
+}
+
+// WithStatusMapper extends how the error returned from Step maps to its terminal status.
+//
+// The mapper should return Pending for errors it doesn't recognize,
+// then the default mapping applies:
+//   - nil: Succeeded
+//   - canceled due to the Step's Timeout (ErrStepTimeout): TimedOut
+//   - canceled (see DefaultIsCanceled and WithIsCanceled): Canceled
+//   - ErrSkip: Skipped
+//   - others: Failed
+//
+// The mapper is only called with non-nil error.
+// The custom statuses the mapper returns should be passed as statuses to register them,
+// then they are regarded as terminated (see StepStatus.IsTerminated), i.e.
+//
+//	const Degraded flow.StepStatus = "Degraded"
+//	WithStatusMapper(func(err error) flow.StepStatus {
+//		if errors.Is(err, ErrDegraded) {
+//			return Degraded
+//		}
+//		return flow.Pending
+//	}, Degraded)
+//
+// The registration is global, since StepStatus is a plain value.
+// Pending, Running and Suspended can't be registered.
+// Multiple mappers are tried in order, the first terminal status wins.
+func WithStatusMapper(mapper func(error) StepStatus, statuses ...StepStatus) WorkflowOption {
+	for _, status := range statuses {
+		switch status {
+		case Pending, Running, Suspended:
+		default:
+			customStatuses.Store(status, struct{}{})
+		}
+	}
+	return func(w *Workflow) {
+		if mapper != nil {
+			w.statusMappers = append(w.statusMappers, mapper)
+		}
+	}
+}
+
+// ErrorTransformer transforms the error returned from Step, see WithErrorTransformer.
+type ErrorTransformer func(ctx context.Context, step Steper, err error) error
+
+// WithErrorTransformer transforms the error of Step before it's recorded in State and ErrWorkflow,
+// i.e. to redact secrets or normalize errors from third-party libraries.
+//
+// The transformer is called once the Step finished all attempts (see Retry), only with non-nil error,
+// multiple transformers are applied in order, each one receives the error returned by the previous one.
+// The transformed error is then classified to the terminal status (see WithStatusMapper),
+// so the transformer is able to change the status, i.e. returning nil turns a failure into a success.
+//
+//	WithErrorTransformer(func(ctx context.Context, step flow.Steper, err error) error {
+//		return redact(err)
+//	})
+func WithErrorTransformer(transform ErrorTransformer) WorkflowOption {
+	return func(w *Workflow) {
+		if transform != nil {
+			w.errorTransformers = append(w.errorTransformers, transform)
+		}
+	}
+}
+
+// WithIsCanceled customizes how the error returned from Step is regarded as canceled, default is DefaultIsCanceled.
+//
+// The predicate replaces DefaultIsCanceled for errors of Steps in the Workflow,
+// call DefaultIsCanceled in it to extend the default, i.e. recognize the cancellation wrapped by an RPC layer.
+//
+//	WithIsCanceled(func(err error) bool {
+//		return flow.DefaultIsCanceled(err) || status.Code(err) == codes.Canceled
+//	})
+//
+// Status mappers (see WithStatusMapper) are tried before it.
+func WithIsCanceled(isCanceled func(error) bool) WorkflowOption {
+	return func(w *Workflow) {
+		w.isCanceledFunc = isCanceled
+	}
+}
+
 func DontPanic(w *Workflow) {
 	w.DontPanic = true
 }
+
+// WithFailFast cancels the Workflow once a Step terminates as Failed or TimedOut.
+//
+// The context of the Workflow is canceled, so that
+//   - Running Steps observe the cancellation from their context,
+//   - Pending Steps without explicit Condition are Canceled, and not scheduled anymore,
+//   - Pending Steps with explicit Condition are still decided by their Condition,
+//     i.e. cleanup Steps with When(Always) still run.
+//
+// Do returns ErrFailFast identifying the Failed Step triggered the cancellation,
+// the Canceled Steps are available from ErrFailFast.Canceled.
+//
+// Without the option, independent branches run to completion,
+// unless the Failed Step is Critical, see AddSteps.Critical.
+func WithFailFast() WorkflowOption {
+	return func(w *Workflow) {
+		w.FailFast = true
+	}
+}
@@ -0,0 +1,1186 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestNestedWorkflowConcurrency(t *testing.T) {
+	t.Run("inner runs with its own max concurrency", func(t *testing.T) {
+		t.Parallel()
+		// both inner steps need to be running at the same time to finish,
+		// it only works when inner leases are not taken from outer bucket.
+		var wg sync.WaitGroup
+		wg.Add(2)
+		rendezvous := func(ctx context.Context) error {
+			wg.Done()
+			wg.Wait()
+			return nil
+		}
+		inner := new(Workflow).Options(WithMaxConcurrency(2))
+		inner.Add(Steps(Func("a", rendezvous), Func("b", rendezvous)))
+		outer := new(Workflow).Options(WithMaxConcurrency(1))
+		outer.Add(Step(inner))
+		assert.NoError(t, outer.Do(context.Background()))
+	})
+	t.Run("inner max concurrency is respected", func(t *testing.T) {
+		t.Parallel()
+		var running, maxRunning atomic.Int32
+		count := func(ctx context.Context) error {
+			defer trackMax(&running, &maxRunning)()
+			time.Sleep(time.Millisecond)
+			return nil
+		}
+		inner := new(Workflow).Options(WithMaxConcurrency(1))
+		inner.Add(Steps(Func("a", count), Func("b", count), Func("c", count)))
+		outer := new(Workflow)
+		outer.Add(Steps(inner, noopStep("d")))
+		assert.NoError(t, outer.Do(context.Background()))
+		assert.Equal(t, int32(1), maxRunning.Load())
+	})
+	t.Run("inner Do receives the outer context", func(t *testing.T) {
+		t.Parallel()
+		type key struct{}
+		var got any
+		inner := new(Workflow)
+		inner.Add(Step(Func("a", func(ctx context.Context) error {
+			got = ctx.Value(key{})
+			return nil
+		})))
+		outer := new(Workflow)
+		outer.Add(Step(inner))
+		ctx := context.WithValue(context.Background(), key{}, "outer")
+		assert.NoError(t, outer.Do(ctx))
+		assert.Equal(t, "outer", got)
+	})
+}
+
+func TestStepMiddleware(t *testing.T) {
+	t.Run("compose in order", func(t *testing.T) {
+		var order []string
+		mw := func(name string) StepMiddleware {
+			return func(next StepDo) StepDo {
+				return func(ctx context.Context, step Steper) error {
+					order = append(order, "before "+name)
+					err := next(ctx, step)
+					order = append(order, "after "+name)
+					return err
+				}
+			}
+		}
+		step := Func("step", func(ctx context.Context) error {
+			order = append(order, "step")
+			return nil
+		})
+		workflow := new(Workflow).Options(
+			WithStepMiddleware(mw("outer")),
+			WithStepMiddleware(mw("inner")),
+		)
+		workflow.Add(Step(step))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []string{
+			"before outer", "before inner", "step", "after inner", "after outer",
+		}, order)
+	})
+	t.Run("see each attempt", func(t *testing.T) {
+		var attempts atomic.Int32
+		step := Func("step", func(ctx context.Context) error {
+			if attempts.Load() < 3 {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		})
+		workflow := new(Workflow).Options(
+			WithStepMiddleware(func(next StepDo) StepDo {
+				return func(ctx context.Context, step Steper) error {
+					attempts.Add(1)
+					return next(ctx, step)
+				}
+			}),
+		)
+		workflow.Add(Step(step).Retry(func(ro *RetryOption) {
+			ro.Timer = new(testTimer)
+			ro.Attempts = 5
+		}))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, int32(3), attempts.Load())
+	})
+	t.Run("short-circuit and transform error", func(t *testing.T) {
+		called := false
+		step := Func("step", func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+		blocked := fmt.Errorf("blocked")
+		workflow := new(Workflow).Options(
+			WithStepMiddleware(func(next StepDo) StepDo {
+				return func(ctx context.Context, step Steper) error {
+					return blocked
+				}
+			}),
+		)
+		workflow.Add(Step(step))
+		err := workflow.Do(context.Background())
+		assert.ErrorIs(t, err, blocked)
+		assert.False(t, called)
+		assert.Equal(t, Failed, workflow.StateOf(step).GetStatus())
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Run("steps sharing key are rate limited", func(t *testing.T) {
+		var starts []time.Time
+		var mu sync.Mutex
+		newStep := func(name string) Steper {
+			return Func(name, func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				starts = append(starts, time.Now())
+				return nil
+			})
+		}
+		workflow := new(Workflow).Options(
+			WithRateLimit("api", rate.Every(20*time.Millisecond), 1),
+		)
+		workflow.Add(
+			Steps(newStep("a"), newStep("b"), newStep("c")).RateLimit("api"),
+			Step(noopStep("unlimited")),
+		)
+		start := time.Now()
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Len(t, starts, 3)
+		assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+	})
+	t.Run("wait respects context", func(t *testing.T) {
+		a := noopStep("a")
+		b := noopStep("b")
+		workflow := new(Workflow).Options(
+			WithRateLimit("api", rate.Every(time.Hour), 1),
+		)
+		workflow.Add(Steps(a, b).RateLimit("api"))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := workflow.Do(ctx)
+		assert.Error(t, err)
+		statuses := []StepStatus{
+			workflow.StateOf(a).GetStatus(),
+			workflow.StateOf(b).GetStatus(),
+		}
+		assert.ElementsMatch(t, []StepStatus{Succeeded, Canceled}, statuses)
+	})
+}
+
+func TestStatusMapper(t *testing.T) {
+	const (
+		Degraded     StepStatus = "Degraded"
+		Unregistered StepStatus = "Unregistered"
+	)
+	errDegraded := fmt.Errorf("degraded")
+	newStep := func(name string, err error) *Function[struct{}, struct{}] {
+		return Func(name, func(ctx context.Context) error { return err })
+	}
+	var (
+		degraded  = newStep("degraded", fmt.Errorf("wrap: %w", errDegraded))
+		failed    = newStep("failed", fmt.Errorf("failed"))
+		canceled  = newStep("canceled", Cancel(fmt.Errorf("cancel")))
+		skipped   = newStep("skipped", Skip(fmt.Errorf("skip")))
+		succeeded = newStep("succeeded", nil)
+		down      = newStep("down", nil)
+	)
+	workflow := new(Workflow).Options(
+		WithStatusMapper(func(err error) StepStatus {
+			if errors.Is(err, errDegraded) {
+				return Degraded
+			}
+			return Pending
+		}, Degraded),
+		WithStatusMapper(func(err error) StepStatus { return Unregistered }), // not terminal, falls through
+	)
+	workflow.Add(
+		Steps(degraded, failed, canceled, skipped, succeeded),
+		Step(down).DependsOnStatus([]StepStatus{Degraded}, degraded),
+	)
+	_ = workflow.Do(context.Background())
+	assert.True(t, Degraded.IsTerminated())
+	assert.False(t, Unregistered.IsTerminated())
+	assert.Equal(t, "Degraded", Degraded.String())
+	assert.Equal(t, Degraded, workflow.StateOf(degraded).GetStatus())
+	assert.Equal(t, Failed, workflow.StateOf(failed).GetStatus())
+	assert.Equal(t, Canceled, workflow.StateOf(canceled).GetStatus())
+	assert.Equal(t, Skipped, workflow.StateOf(skipped).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(succeeded).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+}
+
+func TestPhaseConcurrency(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	maxRunningOf := map[Phase]int32{}
+	newStep := func(name string) Steper {
+		return Func(name, func(ctx context.Context) error {
+			defer trackMax(&running, &maxRunning)()
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+	}
+	record := func(phase Phase) Steper {
+		return Func("record "+string(phase), func(ctx context.Context) error {
+			maxRunningOf[phase] = maxRunning.Swap(0)
+			return nil
+		})
+	}
+	workflow := new(Workflow).Options(
+		WithMaxConcurrency(2),
+		WithPhaseConcurrency(PhaseInit, 1),
+		WithPhaseConcurrency(PhaseMain, 3),
+	)
+	initSteps := []Steper{newStep("init1"), newStep("init2"), newStep("init3")}
+	mainSteps := []Steper{newStep("main1"), newStep("main2"), newStep("main3")}
+	deferSteps := []Steper{newStep("defer1"), newStep("defer2"), newStep("defer3")}
+	recordInit, recordMain := record(PhaseInit), record(PhaseMain)
+	workflow.Init(Steps(initSteps...))
+	workflow.Add(Steps(mainSteps...).DependsOn(recordInit))
+	workflow.Defer(Steps(deferSteps...).DependsOn(recordMain))
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, int32(1), maxRunningOf[PhaseInit])
+	assert.Equal(t, int32(3), maxRunningOf[PhaseMain])
+	assert.Equal(t, int32(2), maxRunning.Load()) // Defer falls back to WithMaxConcurrency
+}
+
+func TestQueue(t *testing.T) {
+	var gpu, maxGPU, all, maxAll atomic.Int32
+	newStep := func(name string, inGPU bool) Steper {
+		return Func(name, func(ctx context.Context) error {
+			defer trackMax(&all, &maxAll)()
+			if inGPU {
+				defer trackMax(&gpu, &maxGPU)()
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+	}
+	workflow := new(Workflow).Options(
+		WithMaxConcurrency(5),
+		WithQueue("gpu", 2),
+	)
+	workflow.Add(
+		Steps(newStep("gpu1", true), newStep("gpu2", true), newStep("gpu3", true), newStep("gpu4", true)).Queue("gpu"),
+		Steps(newStep("cpu1", false), newStep("cpu2", false), newStep("cpu3", false)),
+		Step(newStep("unknown queue", false)).Queue("unknown"),
+	)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, int32(2), maxGPU.Load())
+	assert.Equal(t, int32(5), maxAll.Load()) // Steps waiting for queue don't block others
+}
+
+func TestGroupConcurrency(t *testing.T) {
+	var db, maxDB, gpu, maxGPU, all, maxAll atomic.Int32
+	newStep := func(name string, inDB, inGPU bool) Steper {
+		return Func(name, func(ctx context.Context) error {
+			defer trackMax(&all, &maxAll)()
+			if inDB {
+				defer trackMax(&db, &maxDB)()
+			}
+			if inGPU {
+				defer trackMax(&gpu, &maxGPU)()
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+	}
+	workflow := new(Workflow).Options(
+		WithMaxConcurrency(6),
+		WithGroupConcurrency("database", 2),
+		WithQueue("gpu", 1),
+	)
+	workflow.Add(
+		Steps(newStep("db1", true, false), newStep("db2", true, false), newStep("db3", true, false)).Group("database"),
+		Steps(newStep("db-gpu1", true, true), newStep("db-gpu2", true, true)).Group("database").Queue("gpu"),
+		Steps(newStep("web1", false, false), newStep("web2", false, false), newStep("web3", false, false)).Group("web"),
+	)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, int32(2), maxDB.Load())
+	assert.Equal(t, int32(1), maxGPU.Load())
+	assert.Equal(t, int32(5), maxAll.Load()) // Steps waiting for group don't block other groups
+}
+
+func TestOnIdle(t *testing.T) {
+	approve := make(chan struct{})
+	a, gate, b := noopStep("a"), noopStep("gate"), noopStep("b")
+	var idles [][]Steper
+	workflow := new(Workflow).Options(WithOnIdle(func(pending []Steper) {
+		idles = append(idles, pending)
+		close(approve)
+	}))
+	workflow.Add(
+		Step(gate).DependsOn(a).WaitFor(approve),
+		Step(b).DependsOn(gate),
+	)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, [][]Steper{{gate}}, idles)
+	assert.Equal(t, Succeeded, workflow.StateOf(b).GetStatus())
+}
+
+type rpcError struct{ code string }
+
+func (e rpcError) Error() string { return "rpc error: code = " + e.code }
+
+func TestIsCanceled(t *testing.T) {
+	errRPCCanceled := rpcError{code: "Canceled"}
+	newStep := func(name string, err error) Steper {
+		return Func(name, func(ctx context.Context) error { return err })
+	}
+	var (
+		rpcCanceled = newStep("rpc canceled", fmt.Errorf("wrap: %w", errRPCCanceled))
+		rpcFailed   = newStep("rpc failed", rpcError{code: "Internal"})
+		ctxCanceled = newStep("ctx canceled", context.Canceled)
+	)
+	build := func(opts ...WorkflowOption) *Workflow {
+		workflow := new(Workflow).Options(opts...)
+		workflow.Add(Steps(rpcCanceled, rpcFailed, ctxCanceled))
+		return workflow
+	}
+	t.Run("default", func(t *testing.T) {
+		workflow := build()
+		_ = workflow.Do(context.Background())
+		assert.Equal(t, Failed, workflow.StateOf(rpcCanceled).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(ctxCanceled).GetStatus())
+	})
+	t.Run("custom", func(t *testing.T) {
+		workflow := build(WithIsCanceled(func(err error) bool {
+			var rpcErr rpcError
+			return DefaultIsCanceled(err) || errors.As(err, &rpcErr) && rpcErr.code == "Canceled"
+		}))
+		_ = workflow.Do(context.Background())
+		assert.Equal(t, Canceled, workflow.StateOf(rpcCanceled).GetStatus())
+		assert.Equal(t, Failed, workflow.StateOf(rpcFailed).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(ctxCanceled).GetStatus())
+	})
+}
+
+func TestStepTimeoutJitter(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		rand    func(n int64) int64
+		timeout time.Duration
+	}{
+		{"min", func(int64) int64 { return 0 }, 10 * time.Millisecond},
+		{"max", func(n int64) int64 { return n - 1 }, 30 * time.Millisecond},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			step := Func("wait", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+			workflow := new(Workflow).Options(WithStepTimeoutJitter(0.5), WithRand(c.rand))
+			workflow.Add(Step(step).Timeout(20 * time.Millisecond))
+			err := workflow.Do(context.Background())
+			var timeout ErrStepTimeout
+			assert.ErrorAs(t, err, &timeout)
+			assert.Equal(t, c.timeout, timeout.Timeout)
+			opt := new(StepOption)
+			workflow.EffectiveConfig(step).Option(opt)
+			assert.Equal(t, 20*time.Millisecond, *opt.Timeout, "base timeout is not changed")
+		})
+	}
+}
+
+func TestFaultInjector(t *testing.T) {
+	errChaos := fmt.Errorf("chaos")
+	var calls sync.Map // name -> *atomic.Int32, calls of Do
+	newStep := func(name string) Steper {
+		calls.Store(name, new(atomic.Int32))
+		return Func(name, func(ctx context.Context) error {
+			v, _ := calls.Load(name)
+			v.(*atomic.Int32).Add(1)
+			return nil
+		})
+	}
+	flaky, broken, slow, down := newStep("flaky"), newStep("broken"), newStep("slow"), newStep("down")
+	var flakyFaults atomic.Int32
+	workflow := new(Workflow).Options(WithFaultInjector(func(step Steper) (time.Duration, error) {
+		switch String(step) {
+		case "flaky":
+			if flakyFaults.Add(1) == 1 {
+				return 0, errChaos
+			}
+		case "broken":
+			return 0, errChaos
+		case "slow":
+			return 20 * time.Millisecond, nil
+		}
+		return 0, nil
+	}))
+	workflow.Add(
+		Step(flaky).Retry(func(ro *RetryOption) {
+			ro.DelayFunc = func(int, error) time.Duration { return time.Millisecond }
+		}),
+		Step(down).DependsOn(broken),
+		Step(slow),
+	)
+	err := workflow.Do(context.Background())
+	assert.ErrorIs(t, err, errChaos)
+	count := func(name string) int32 {
+		v, _ := calls.Load(name)
+		return v.(*atomic.Int32).Load()
+	}
+	assert.Equal(t, Succeeded, workflow.StateOf(flaky).GetStatus())
+	assert.EqualValues(t, 1, count("flaky"), "Do is not called for the induced fault")
+	assert.Equal(t, Failed, workflow.StateOf(broken).GetStatus())
+	assert.EqualValues(t, 0, count("broken"))
+	assert.Equal(t, Skipped, workflow.StateOf(down).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(slow).GetStatus())
+	assert.GreaterOrEqual(t, workflow.StateOf(slow).WorkTime(), 20*time.Millisecond)
+}
+
+func TestErrorTransformer(t *testing.T) {
+	errIgnored := fmt.Errorf("ignored")
+	var attempts atomic.Int32
+	leak := Func("leak", func(ctx context.Context) error {
+		attempts.Add(1)
+		return fmt.Errorf("token=secret")
+	})
+	ignored := Func("ignored", func(ctx context.Context) error { return errIgnored })
+	succeeded := Func("succeeded", func(ctx context.Context) error { return nil })
+	var calls []string
+	var mu sync.Mutex
+	workflow := new(Workflow).Options(
+		WithErrorTransformer(func(ctx context.Context, step Steper, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, String(step))
+			if errors.Is(err, errIgnored) {
+				return nil
+			}
+			return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), "secret", "***"))
+		}),
+	)
+	workflow.Add(
+		Step(leak).Retry(func(ro *RetryOption) {
+			ro.Attempts = 2
+			ro.DelayFunc = func(int, error) time.Duration { return time.Millisecond }
+		}),
+		Steps(ignored, succeeded),
+	)
+	err := workflow.Do(context.Background())
+	assert.ErrorContains(t, err, "token=***")
+	assert.NotContains(t, err.Error(), "secret")
+	assert.EqualValues(t, 3, attempts.Load(), "transformer is applied after retries")
+	assert.Equal(t, Failed, workflow.StateOf(leak).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(ignored).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(succeeded).GetStatus())
+	assert.ElementsMatch(t, []string{"leak", "ignored"}, calls)
+}
+
+func TestCancelGracePeriod(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	stubborn := Func("stubborn", func(ctx context.Context) error {
+		<-release // ignores ctx
+		return nil
+	})
+	flush := Func("flush", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(5 * time.Millisecond) // flush before return
+		return nil
+	})
+	workflow := new(Workflow).Options(WithCancelGracePeriod(50 * time.Millisecond))
+	workflow.Add(Steps(stubborn, flush))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := workflow.Do(ctx)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.ErrorAs(t, err, new(ErrCancelGracePeriod))
+	assert.Equal(t, Canceled, workflow.StateOf(stubborn).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(flush).GetStatus(), "returned within grace period")
+
+	t.Run("run again after abandoned", func(t *testing.T) {
+		var runs, returned atomic.Int32
+		block := make(chan struct{})
+		stubborn := Func("stubborn", func(ctx context.Context) error {
+			defer returned.Add(1)
+			if runs.Add(1) == 1 {
+				<-block // ignores ctx
+			}
+			Heartbeat(ctx)
+			return nil
+		})
+		workflow := new(Workflow).Options(WithCancelGracePeriod(10 * time.Millisecond))
+		workflow.Add(Step(stubborn))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorAs(t, workflow.Do(ctx), new(ErrCancelGracePeriod))
+		time.AfterFunc(20*time.Millisecond, func() { close(block) })
+		assert.NoError(t, workflow.Reset())
+		assert.EqualValues(t, 1, returned.Load(), "Reset waits for the abandoned Step to return")
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.EqualValues(t, 2, runs.Load())
+		assert.Equal(t, Succeeded, workflow.StateOf(stubborn).GetStatus())
+	})
+}
+
+func TestAfterPhase(t *testing.T) {
+	build := func(opts ...WorkflowOption) (workflow *Workflow, init, main, deferred Steper) {
+		init = Func("init", func(ctx context.Context) error { return assert.AnError })
+		main, deferred = noopStep("main"), noopStep("defer")
+		workflow = new(Workflow).Options(opts...)
+		workflow.Init(Step(init))
+		workflow.Add(Step(main))
+		workflow.Defer(Step(deferred).When(Always))
+		return
+	}
+	t.Run("called after each phase", func(t *testing.T) {
+		type called struct {
+			phase  Phase
+			failed bool
+		}
+		var calls []called
+		workflow, _, main, _ := build(WithAfterPhase(func(ctx context.Context, phase Phase, err error) error {
+			calls = append(calls, called{phase, err != nil})
+			return nil
+		}))
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, []called{{PhaseInit, true}, {PhaseMain, false}, {PhaseDefer, false}}, calls)
+		assert.Equal(t, Succeeded, workflow.StateOf(main).GetStatus())
+	})
+	t.Run("abort remaining phases", func(t *testing.T) {
+		errStop := fmt.Errorf("stop")
+		workflow, _, main, deferred := build(WithAfterPhase(func(ctx context.Context, phase Phase, err error) error {
+			if phase == PhaseInit && err != nil {
+				return errStop
+			}
+			return nil
+		}))
+		err := workflow.Do(context.Background())
+		assert.ErrorIs(t, err, errStop)
+		assert.ErrorAs(t, err, new(ErrAfterPhase))
+		assert.Equal(t, Canceled, workflow.StateOf(main).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(deferred).GetStatus())
+	})
+}
+
+func TestPhaseTimeout(t *testing.T) {
+	build := func(opt WorkflowOption) (workflow *Workflow, slow, after, main Steper) {
+		slow = Func("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		after, main = noopStep("after"), noopStep("main")
+		workflow = new(Workflow).Options(opt)
+		workflow.Init(Step(after).DependsOn(slow))
+		workflow.Add(Step(main))
+		return
+	}
+	t.Run("move on to next phase", func(t *testing.T) {
+		workflow, slow, after, main := build(WithPhaseTimeout(PhaseInit, 20*time.Millisecond))
+		err := workflow.Do(context.Background())
+		assert.ErrorAs(t, err, new(ErrPhaseTimeout))
+		assert.Equal(t, Canceled, workflow.StateOf(slow).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(after).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(main).GetStatus())
+	})
+	t.Run("abort", func(t *testing.T) {
+		workflow, slow, after, main := build(WithPhaseTimeoutAbort(PhaseInit, 20*time.Millisecond))
+		err := workflow.Do(context.Background())
+		assert.ErrorAs(t, err, new(ErrPhaseTimeout))
+		assert.Equal(t, Canceled, workflow.StateOf(slow).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(after).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(main).GetStatus())
+	})
+	t.Run("phase finished in time", func(t *testing.T) {
+		a := noopStep("a")
+		workflow := new(Workflow).Options(WithPhaseTimeout(PhaseMain, time.Minute))
+		workflow.Add(Step(a))
+		assert.NoError(t, workflow.Do(context.Background()))
+	})
+}
+
+func TestPhaseOnFailure(t *testing.T) {
+	build := func(opts ...WorkflowOption) (workflow *Workflow, init, main, deferred Steper) {
+		init = Func("init", func(ctx context.Context) error { return assert.AnError })
+		main, deferred = noopStep("main"), noopStep("defer")
+		workflow = new(Workflow).Options(opts...)
+		workflow.Init(Step(init))
+		workflow.Add(Step(main))
+		workflow.Defer(Step(deferred))
+		return
+	}
+	t.Run("run anyway by default", func(t *testing.T) {
+		workflow, init, main, deferred := build()
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, Failed, workflow.StateOf(init).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(main).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(deferred).GetStatus())
+	})
+	t.Run("skip main, run defer", func(t *testing.T) {
+		workflow, _, main, deferred := build(WithPhaseOnFailure(PhaseMain, OnFailureSkip))
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, Skipped, workflow.StateOf(main).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(deferred).GetStatus())
+	})
+	t.Run("abort", func(t *testing.T) {
+		workflow, _, main, deferred := build(WithPhaseOnFailure(PhaseMain, OnFailureAbort))
+		err := workflow.Do(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, Canceled, workflow.StateOf(main).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(deferred).GetStatus())
+	})
+	t.Run("no failure", func(t *testing.T) {
+		main := noopStep("main")
+		workflow := new(Workflow).Options(WithPhaseOnFailure(PhaseMain, OnFailureSkip))
+		workflow.Init(Step(noopStep("init")))
+		workflow.Add(Step(main))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(main).GetStatus())
+	})
+}
+
+type reported struct {
+	id     string
+	start  bool
+	status StepStatus
+	err    error
+}
+
+type recordReporter struct {
+	mu      sync.Mutex
+	reports []reported
+}
+
+func (r *recordReporter) ReportStart(id string, _ time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, reported{id: id, start: true})
+}
+
+func (r *recordReporter) ReportEnd(id string, status StepStatus, err error, _ time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, reported{id: id, status: status, err: err})
+}
+
+func TestReporter(t *testing.T) {
+	a := &identifiedStep{Steper: noopStep("a"), id: "id-a"}
+	b := Func("b", func(ctx context.Context) error { return assert.AnError })
+	c := noopStep("c")
+	reporter := new(recordReporter)
+	workflow := new(Workflow).Options(WithReporter(reporter))
+	workflow.Register("id-b", b)
+	workflow.Add(Pipe(a, b, c))
+	assert.Error(t, workflow.Do(context.Background()))
+	assert.Equal(t, []reported{
+		{id: "id-a", start: true},
+		{id: "id-a", status: Succeeded},
+		{id: "id-b", start: true},
+		{id: "id-b", status: Failed, err: assert.AnError},
+		{id: "c", status: Skipped},
+	}, reporter.reports)
+}
+
+func TestMockClock(t *testing.T) {
+	mock := clock.NewMock()
+	started := make(chan struct{})
+	workflow := new(Workflow).Options(
+		WithClock(mock),
+		WithNotify(Notify{
+			BeforeStep: func(ctx context.Context, _ Steper) context.Context {
+				started <- struct{}{}
+				return ctx
+			},
+		}),
+	)
+	assert.Equal(t, mock, workflow.Clock())
+	assert.NotNil(t, new(Workflow).Clock())
+	attempts := 0
+	step := Func("wait done", func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	workflow.Add(
+		Step(step).
+			Retry(func(ro *RetryOption) {
+				ro.Attempts = 5
+				ro.Timer = new(testTimer)
+				ro.Timeout = time.Minute // retry level timeout
+			}).
+			Timeout(90 * time.Second), // step level timeout
+	)
+	go func() {
+		for range started {
+			mock.Add(time.Minute)
+		}
+	}()
+	err := workflow.Do(context.Background())
+	close(started)
+	assert.ErrorAs(t, err, new(ErrStepTimeout))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestFailFast(t *testing.T) {
+	build := func(opts ...WorkflowOption) (workflow *Workflow, failed, slow, after, cleanup Steper) {
+		failed = Func("failed", func(ctx context.Context) error { return fmt.Errorf("failed") })
+		slow = Func("slow", func(ctx context.Context) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+				return nil
+			}
+		})
+		after = noopStep("after")
+		cleanup = noopStep("cleanup")
+		workflow = new(Workflow).Options(opts...)
+		workflow.Add(
+			Step(failed),
+			Step(after).DependsOn(slow),
+			Step(cleanup).DependsOn(after).When(Always),
+		)
+		return
+	}
+	t.Run("fail fast", func(t *testing.T) {
+		workflow, failed, slow, after, cleanup := build(WithFailFast())
+		start := time.Now()
+		err := workflow.Do(context.Background())
+		assert.Less(t, time.Since(start), time.Second)
+		var failFast ErrFailFast
+		if assert.ErrorAs(t, err, &failFast) {
+			assert.Equal(t, failed, failFast.Step)
+			assert.EqualError(t, failFast.Cause, "failed")
+			assert.EqualError(t, failFast, "fail fast: failed failed: failed")
+			assert.ElementsMatch(t, []Steper{slow, after}, failFast.Canceled())
+			assert.ErrorAs(t, err, new(ErrWorkflow), "the statuses of all Steps are still available")
+		}
+		var cause ErrCancelCause
+		if assert.ErrorAs(t, workflow.StateOf(slow).GetError(), &cause) {
+			assert.ErrorAs(t, cause.Cause, new(ErrFailFast))
+		}
+		assert.Equal(t, Canceled, workflow.StateOf(slow).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(after).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(cleanup).GetStatus())
+	})
+	t.Run("run to completion", func(t *testing.T) {
+		workflow, _, slow, after, cleanup := build()
+		err := workflow.Do(context.Background())
+		assert.Error(t, err)
+		assert.False(t, errors.As(err, new(ErrFailFast)))
+		assert.Equal(t, Succeeded, workflow.StateOf(slow).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(after).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(cleanup).GetStatus())
+	})
+}
+
+func TestStartJitter(t *testing.T) {
+	t.Run("delay with clock", func(t *testing.T) {
+		mock := clock.NewMock()
+		start := mock.Now()
+		var startedAt []time.Time
+		var mu sync.Mutex
+		newStep := func(name string) Steper {
+			return Func(name, func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				startedAt = append(startedAt, mock.Now())
+				return nil
+			})
+		}
+		noJitter := newStep("no jitter")
+		workflow := new(Workflow).Options(WithClock(mock), WithStartJitter(time.Minute))
+		workflow.Add(
+			Steps(newStep("a"), newStep("b"), newStep("c")),
+			Step(noJitter).StartJitter(0),
+		)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.NoError(t, workflow.Do(context.Background()))
+		}()
+		for {
+			select {
+			case <-done:
+				assert.Len(t, startedAt, 4)
+				for _, at := range startedAt[1:] {
+					assert.True(t, at.After(start))
+				}
+				assert.Equal(t, start, startedAt[0]) // no jitter step starts first
+				return
+			case <-time.After(time.Millisecond):
+				mock.Add(time.Second)
+			}
+		}
+	})
+	t.Run("canceled while waiting", func(t *testing.T) {
+		ran := false
+		step := Func("step", func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+		workflow := new(Workflow).Options(WithClock(clock.NewMock()), WithStartJitter(time.Hour))
+		workflow.Add(Step(step))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := workflow.Do(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, ran)
+		assert.Equal(t, Canceled, workflow.StateOf(step).GetStatus())
+	})
+}
+
+func TestMaxCost(t *testing.T) {
+	t.Run("total cost", func(t *testing.T) {
+		a, b, c := noopStep("a"), noopStep("b"), Func("c", func(ctx context.Context) error { return fmt.Errorf("c") })
+		workflow := new(Workflow).Add(
+			Steps(a, b).Cost(1.5),
+			Step(c).Cost(10),
+		)
+		assert.Zero(t, workflow.TotalCost())
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, 3.0, workflow.TotalCost()) // c Failed
+	})
+	t.Run("stop scheduling once exceeded", func(t *testing.T) {
+		a, b, c, d := noopStep("a"), noopStep("b"), noopStep("c"), noopStep("d")
+		workflow := new(Workflow).Options(WithMaxCost(2.5))
+		workflow.Add(
+			Pipe(a, b, c),
+			Steps(a, b, c).Cost(1),
+			Step(d).DependsOn(c),
+		)
+		err := workflow.Do(context.Background())
+		assert.ErrorAs(t, err, new(ErrMaxCost))
+		assert.Equal(t, Succeeded, workflow.StateOf(a).GetStatus())
+		assert.Equal(t, Succeeded, workflow.StateOf(b).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(c).GetStatus())
+		assert.Equal(t, Skipped, workflow.StateOf(d).GetStatus())
+		assert.Equal(t, 2.0, workflow.TotalCost())
+	})
+}
+
+func TestMaxSteps(t *testing.T) {
+	var ran atomic.Int32
+	newStep := func(name string) Steper {
+		return Func(name, func(ctx context.Context) error {
+			ran.Add(1)
+			return nil
+		})
+	}
+	t.Run("within limit", func(t *testing.T) {
+		a, b := newStep("a"), newStep("b")
+		workflow := new(Workflow).Options(WithMaxSteps(2))
+		workflow.Add(Step(a), Step(b).DependsOn(a), Step(a)) // adding existing Step again is fine
+		assert.NoError(t, workflow.Do(context.Background()))
+	})
+	t.Run("exceed limit", func(t *testing.T) {
+		ran.Store(0)
+		steps := []Steper{newStep("1"), newStep("2"), newStep("3"), newStep("4")}
+		workflow := new(Workflow).Options(WithMaxSteps(3))
+		workflow.Add(Sequential(steps))
+		assert.Equal(t, 3, workflow.Stats().Steps)
+		err := workflow.Do(context.Background())
+		var errTooMany ErrTooManySteps
+		if assert.ErrorAs(t, err, &errTooMany) {
+			assert.Equal(t, 3, errTooMany.Max)
+			assert.Contains(t, steps, errTooMany.Step)
+			assert.Nil(t, workflow.StateOf(errTooMany.Step))
+		}
+		assert.Zero(t, ran.Load())
+	})
+	t.Run("only drop dependencies on refused Steps", func(t *testing.T) {
+		a, b, c := newStep("a"), newStep("b"), newStep("c")
+		workflow := new(Workflow).Options(WithMaxSteps(2))
+		workflow.Add(Steps(a, b))
+		workflow.Add(Step(b).DependsOn(a, c))
+		assert.Nil(t, workflow.StateOf(c))
+		ups := workflow.UpstreamOf(b)
+		assert.Len(t, ups, 1)
+		assert.Contains(t, ups, a)
+		var errTooMany ErrTooManySteps
+		if assert.ErrorAs(t, workflow.Do(context.Background()), &errTooMany) {
+			assert.Equal(t, c, errTooMany.Step)
+		}
+	})
+}
+
+func TestSkipPropagation(t *testing.T) {
+	for _, propagate := range []bool{false, true} {
+		t.Run(fmt.Sprintf("propagate %v", propagate), func(t *testing.T) {
+			// a -> b (skip) -> d -> e
+			// a -> c        -> d
+			a, c := noopStep("a"), noopStep("c")
+			b := Func("b", func(ctx context.Context) error { return Skip(fmt.Errorf("skip b")) })
+			d, e := noopStep("d"), noopStep("e")
+			onSkip := noopStep("on skip")
+			workflow := new(Workflow)
+			if propagate {
+				workflow.Options(WithSkipPropagation())
+			}
+			workflow.Add(
+				Steps(b, c).DependsOn(a),
+				Step(d).DependsOn(b, c).When(Always),
+				Step(e).DependsOn(d).When(Always),
+				Step(onSkip).DependsOnStatus([]StepStatus{Skipped}, b),
+			)
+			_ = workflow.Do(context.Background()) // error of the Skipped b is reported
+			assert.Equal(t, Skipped, workflow.StateOf(b).GetStatus())
+			assert.Equal(t, Succeeded, workflow.StateOf(c).GetStatus())
+			assert.Equal(t, Succeeded, workflow.StateOf(onSkip).GetStatus())
+			if propagate {
+				assert.Equal(t, Skipped, workflow.StateOf(d).GetStatus())
+				assert.Equal(t, Skipped, workflow.StateOf(e).GetStatus())
+			} else {
+				assert.Equal(t, Succeeded, workflow.StateOf(d).GetStatus())
+				assert.Equal(t, Succeeded, workflow.StateOf(e).GetStatus())
+			}
+		})
+	}
+}
+
+func TestStrictReachability(t *testing.T) {
+	setup, main, teardown := noopStep("setup"), noopStep("main"), noopStep("teardown")
+	monitor := Periodic(time.Hour, noopStep("monitor"))
+	afterMonitor, down := noopStep("after monitor"), noopStep("down")
+	build := func(opts ...WorkflowOption) *Workflow {
+		workflow := new(Workflow).Options(opts...)
+		workflow.Init(Step(setup).DependsOnPhase(PhaseMain))
+		workflow.Add(
+			Step(main),
+			Step(afterMonitor).DependsOn(monitor),
+			Step(down).DependsOn(afterMonitor),
+		)
+		return workflow
+	}
+	t.Run("unreachable", func(t *testing.T) {
+		unreachable := build().Unreachable()
+		assert.Len(t, unreachable, 3)
+		assert.Contains(t, unreachable[setup], "phase Main")
+		assert.Contains(t, unreachable[afterMonitor], "periodic")
+		assert.Contains(t, unreachable[down], "unreachable Step after monitor")
+	})
+	t.Run("strict", func(t *testing.T) {
+		err := build(WithStrictReachability()).Do(context.Background())
+		var unreachable ErrUnreachable
+		if assert.ErrorAs(t, err, &unreachable) {
+			assert.Len(t, unreachable, 3)
+		}
+	})
+	t.Run("reachable", func(t *testing.T) {
+		workflow := new(Workflow).Options(WithStrictReachability())
+		workflow.Add(Step(main).DependsOnPhase(PhaseInit), Step(monitor))
+		workflow.Defer(Step(teardown).DependsOnPhase(PhaseMain))
+		assert.NoError(t, workflow.Do(context.Background()))
+	})
+}
+
+func TestOnResult(t *testing.T) {
+	answer := FuncO("answer", func(ctx context.Context) (int, error) { return 42, nil })
+	broken := FuncO("broken", func(ctx context.Context) (int, error) { return 1, fmt.Errorf("broken") })
+	skipped := FuncO("skipped", func(ctx context.Context) (string, error) { return "never", nil })
+	type result struct {
+		output any
+		err    error
+	}
+	var mu sync.Mutex
+	results := map[string][]result{}
+	record := func(name string) func(context.Context, any, error) {
+		return func(_ context.Context, output any, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = append(results[name], result{output, err})
+		}
+	}
+	workflow := new(Workflow).Options(
+		OnResult(answer, func(ctx context.Context, output int, err error) { record("answer")(ctx, output, err) }),
+		OnResult(broken, func(ctx context.Context, output int, err error) { record("broken")(ctx, output, err) }),
+		OnResult(skipped, func(ctx context.Context, output string, err error) { record("skipped")(ctx, output, err) }),
+	)
+	workflow.Add(
+		Step(answer),
+		Step(skipped).DependsOn(broken),
+	)
+	assert.Error(t, workflow.Do(context.Background()))
+	assert.Equal(t, []result{{42, nil}}, results["answer"])
+	if assert.Len(t, results["broken"], 1) {
+		assert.Equal(t, 0, results["broken"][0].output, "zero value if not Succeeded")
+		assert.ErrorContains(t, results["broken"][0].err, "broken")
+	}
+	assert.Equal(t, []result{{"", nil}}, results["skipped"])
+}
+
+func TestLease(t *testing.T) {
+	sleep := func(name string, d time.Duration) Steper {
+		return Func(name, func(ctx context.Context) error {
+			time.Sleep(d)
+			return nil
+		})
+	}
+	t.Run("timeout", func(t *testing.T) {
+		a, b := sleep("a", 50*time.Millisecond), sleep("b", 50*time.Millisecond)
+		workflow := new(Workflow).Options(
+			WithMaxConcurrency(1),
+			WithLeaseTimeout(10*time.Millisecond),
+		)
+		workflow.Add(Steps(a, b))
+		err := workflow.Do(context.Background())
+		assert.ErrorAs(t, err, new(ErrLeaseTimeout))
+		statuses := []StepStatus{workflow.StateOf(a).GetStatus(), workflow.StateOf(b).GetStatus()}
+		assert.ElementsMatch(t, []StepStatus{Succeeded, Failed}, statuses)
+	})
+	t.Run("waiting for lease doesn't count toward Step timeout", func(t *testing.T) {
+		workflow := new(Workflow).Options(WithMaxConcurrency(1))
+		var steps []Steper
+		for i := 0; i < 3; i++ {
+			step := Func(fmt.Sprint(i), func(ctx context.Context) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(30 * time.Millisecond):
+					return nil
+				}
+			})
+			steps = append(steps, step)
+		}
+		// the last Step waits 60ms for the lease, longer than its timeout
+		workflow.Add(Steps(steps...).Timeout(50 * time.Millisecond))
+		assert.NoError(t, workflow.Do(context.Background()))
+	})
+	t.Run("canceled", func(t *testing.T) {
+		// both ignore the context, one runs and the other waits for the lease
+		a, b := sleep("a", 200*time.Millisecond), sleep("b", 200*time.Millisecond)
+		workflow := new(Workflow).Options(WithMaxConcurrency(1))
+		workflow.Add(Steps(a, b))
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() { done <- workflow.Do(ctx) }()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		select {
+		case <-workflow.StateOf(a).Done():
+		case <-workflow.StateOf(b).Done():
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("lease blocks after canceled")
+		}
+		<-done
+		statuses := []StepStatus{workflow.StateOf(a).GetStatus(), workflow.StateOf(b).GetStatus()}
+		assert.ElementsMatch(t, []StepStatus{Succeeded, Canceled}, statuses)
+	})
+	t.Run("lease wait", func(t *testing.T) {
+		a, b := sleep("a", 30*time.Millisecond), sleep("b", 30*time.Millisecond)
+		workflow := new(Workflow).Options(WithMaxConcurrency(1))
+		workflow.Add(Steps(a, b))
+		assert.NoError(t, workflow.Do(context.Background()))
+		waits := []time.Duration{workflow.StateOf(a).LeaseWait(), workflow.StateOf(b).LeaseWait()}
+		slices.Sort(waits)
+		assert.Less(t, waits[0], 10*time.Millisecond)
+		assert.GreaterOrEqual(t, waits[1], 30*time.Millisecond)
+	})
+	t.Run("no lease", func(t *testing.T) {
+		a := sleep("a", time.Millisecond)
+		workflow := new(Workflow)
+		workflow.Add(Step(a))
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Zero(t, workflow.StateOf(a).LeaseWait())
+	})
+}
+
+func TestExecutor(t *testing.T) {
+	// a fixed pool of 2 workers
+	tasks := make(chan func())
+	var workers sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for task := range tasks {
+				task()
+			}
+		}()
+	}
+	var submitted atomic.Int32
+	workflow := new(Workflow).Options(WithExecutor(func(fn func()) {
+		submitted.Add(1)
+		go func() { tasks <- fn }() // don't block the Workflow when all workers are busy
+	}))
+	var mu sync.Mutex
+	ran := map[string]int{}
+	steps := []Steper{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("step %d", i)
+		steps = append(steps, Func(name, func(ctx context.Context) error {
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			ran[name]++
+			return nil
+		}))
+	}
+	workflow.Add(Steps(steps[:5]...), Sequential(steps[5:]))
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, int32(10), submitted.Load())
+	for _, step := range steps {
+		assert.Equal(t, 1, ran[String(step)], "%s should run exactly once", step)
+	}
+	close(tasks)
+	workers.Wait()
+}
+
+// limitGroup is a TaskGroup like errgroup.Group with SetLimit.
+type limitGroup struct {
+	wg         sync.WaitGroup
+	sem        chan struct{}
+	err        error
+	once       sync.Once
+	running    atomic.Int32
+	maxRunning atomic.Int32
+}
+
+func (g *limitGroup) Go(task func() error) {
+	g.sem <- struct{}{}
+	g.wg.Add(1)
+	go func() {
+		defer func() { <-g.sem }()
+		defer g.wg.Done()
+		if n := g.running.Add(1); n > g.maxRunning.Load() {
+			g.maxRunning.Store(n)
+		}
+		defer g.running.Add(-1)
+		if err := task(); err != nil {
+			g.once.Do(func() { g.err = err })
+		}
+	}()
+}
+
+func (g *limitGroup) Wait() error {
+	g.wg.Wait()
+	return g.err
+}
+
+func TestTaskGroup(t *testing.T) {
+	group := &limitGroup{sem: make(chan struct{}, 3)}
+	steps := []Steper{}
+	for i := 0; i < 10; i++ {
+		steps = append(steps, Func(fmt.Sprintf("step %d", i), func(ctx context.Context) error {
+			time.Sleep(time.Millisecond)
+			return nil
+		}))
+	}
+	failed := Func("failed", func(ctx context.Context) error { return assert.AnError })
+	workflow := new(Workflow).Options(WithTaskGroup(group))
+	workflow.Add(Steps(steps...), Step(failed))
+	group.Go(func() error { return workflow.Do(context.Background()) })
+	err := group.Wait()
+	assert.ErrorIs(t, err, assert.AnError, "error of Step is reported by Do")
+	assert.LessOrEqual(t, group.maxRunning.Load(), int32(3), "Do and Steps share the limit")
+	for _, step := range steps {
+		assert.Equal(t, Succeeded, workflow.StateOf(step).GetStatus())
+	}
+}
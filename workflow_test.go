@@ -3,9 +3,13 @@ package flow
 import (
 	"context"
 	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -159,6 +163,8 @@ func TestDep(t *testing.T) {
 		var err ErrCycleDependency
 		assert.ErrorAs(t, workflow.Do(context.Background()), &err)
 		assert.Len(t, err, 3)
+		assert.Equal(t, []Steper{a, c, b, a}, err.Cycle()) // a -> c -> b -> a
+		assert.Contains(t, err.Error(), "\nCycle: A -> C -> B -> A")
 	})
 }
 
@@ -238,6 +244,38 @@ func TestWorkflowWillRecover(t *testing.T) {
 		err := workflow.Do(context.Background())
 		assert.ErrorContains(t, err, "panic in flow")
 	})
+	t.Run("panic as status", func(t *testing.T) {
+		t.Parallel()
+		workflow := new(Workflow).Options(DontPanic)
+		panicStep := Func("panic", func(ctx context.Context) error {
+			panic("panic in step")
+		})
+		workflow.Add(
+			Step(panicStep).PanicAs(Skipped),
+		)
+		err := workflow.Do(context.Background())
+		assert.ErrorAs(t, err, new(ErrPanic))
+		assert.Equal(t, Skipped, workflow.StateOf(panicStep).GetStatus())
+	})
+	t.Run("panic will be retried", func(t *testing.T) {
+		t.Parallel()
+		workflow := new(Workflow).Options(DontPanic)
+		attempt := 0
+		panicOnce := Func("panic once", func(ctx context.Context) error {
+			attempt++
+			if attempt == 1 {
+				panic("panic in step")
+			}
+			return nil
+		})
+		workflow.Add(
+			Step(panicOnce).Retry(func(ro *RetryOption) {
+				ro.Timer = new(testTimer)
+			}),
+		)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, 2, attempt)
+	})
 }
 
 func TestWorkflowErr(t *testing.T) {
@@ -350,6 +388,24 @@ func keys[K comparable, V any](m map[K]V) []K {
 	return keys
 }
 
+// noopStep is a Step does nothing but succeeds.
+func noopStep(name string) *Function[struct{}, struct{}] {
+	return Func(name, func(ctx context.Context) error { return nil })
+}
+
+// trackMax increases running and records its max value into max,
+// the returned function decreases running, defer it in the Step.
+func trackMax(running, max *atomic.Int32) func() {
+	n := running.Add(1)
+	for {
+		m := max.Load()
+		if n <= m || max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	return func() { running.Add(-1) }
+}
+
 func TestWorkflowTree(t *testing.T) {
 	step1 := &someStep{value: "1"}
 	step2 := &someStep{value: "2"}
@@ -400,3 +456,1020 @@ func TestWorkflowTreeWithPhase(t *testing.T) {
 	assert.Contains(t, w.steps[PhaseMain], wStep1)
 	assert.NotContains(t, w.steps[PhaseMain], w.state[step1])
 }
+
+func TestCancelCause(t *testing.T) {
+	waitDone := func(started chan<- struct{}, cause *error) *Function[struct{}, struct{}] {
+		return Func("wait done", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			*cause = context.Cause(ctx)
+			return ctx.Err()
+		})
+	}
+	t.Run("CancelStep", func(t *testing.T) {
+		t.Parallel()
+		started := make(chan struct{})
+		var cause error
+		step := waitDone(started, &cause)
+		workflow := new(Workflow)
+		workflow.Add(Step(step))
+		manual := fmt.Errorf("manual")
+		go func() {
+			<-started
+			workflow.CancelStep(step, manual)
+		}()
+		err := workflow.Do(context.Background())
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, manual)
+		assert.ErrorIs(t, cause, manual)
+		assert.Equal(t, Canceled, workflow.StateOf(step).GetStatus())
+	})
+	t.Run("parent canceled with cause", func(t *testing.T) {
+		t.Parallel()
+		started := make(chan struct{})
+		var cause error
+		step := waitDone(started, &cause)
+		workflow := new(Workflow)
+		workflow.Add(Step(step))
+		ctx, cancel := context.WithCancelCause(context.Background())
+		parent := fmt.Errorf("parent")
+		go func() {
+			<-started
+			cancel(parent)
+		}()
+		err := workflow.Do(ctx)
+		assert.ErrorIs(t, err, parent)
+		assert.ErrorIs(t, cause, parent)
+		assert.Equal(t, Canceled, workflow.StateOf(step).GetStatus())
+	})
+	t.Run("Step timeout", func(t *testing.T) {
+		t.Parallel()
+		started := make(chan struct{})
+		var cause error
+		step := waitDone(started, &cause)
+		mock := clock.NewMock()
+		workflow := new(Workflow).Options(WithClock(mock))
+		workflow.Add(Step(step).Timeout(time.Second))
+		go func() {
+			<-started
+			mock.Add(time.Second)
+		}()
+		err := workflow.Do(context.Background())
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var timeout ErrStepTimeout
+		assert.ErrorAs(t, err, &timeout)
+		assert.Equal(t, time.Second, timeout.Timeout)
+		assert.Equal(t, TimedOut, workflow.StateOf(step).GetStatus())
+		assert.ErrorIs(t, cause, context.DeadlineExceeded)
+	})
+	t.Run("CancelStep not running is no-op", func(t *testing.T) {
+		workflow := new(Workflow)
+		step := noopStep("step")
+		workflow.Add(Step(step))
+		workflow.CancelStep(step, nil)
+		workflow.CancelStep(Func("not in workflow", nil), nil)
+		assert.NoError(t, workflow.Do(context.Background()))
+	})
+}
+
+func TestSetCondition(t *testing.T) {
+	build := func() (*Workflow, Steper, Steper) {
+		fail := Func("fail", func(ctx context.Context) error { return fmt.Errorf("fail") })
+		down := noopStep("down")
+		workflow := new(Workflow).Add(Step(down).DependsOnSuccess(fail))
+		return workflow, fail, down
+	}
+	t.Run("force to run", func(t *testing.T) {
+		workflow, _, down := build()
+		assert.NoError(t, workflow.SetCondition(down, Always))
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, Succeeded, workflow.StateOf(down).GetStatus())
+	})
+	t.Run("without override", func(t *testing.T) {
+		workflow, _, down := build()
+		assert.Error(t, workflow.Do(context.Background()))
+		assert.Equal(t, Skipped, workflow.StateOf(down).GetStatus())
+	})
+	t.Run("step not in workflow", func(t *testing.T) {
+		workflow, _, _ := build()
+		assert.ErrorAs(t, workflow.SetCondition(noopStep("absent"), Always), new(ErrStepNotInWorkflow))
+	})
+	t.Run("running", func(t *testing.T) {
+		workflow, _, down := build()
+		workflow.isRunning.Lock()
+		defer workflow.isRunning.Unlock()
+		assert.ErrorIs(t, workflow.SetCondition(down, Always), ErrWorkflowIsRunning)
+	})
+}
+
+func TestReplace(t *testing.T) {
+	t.Run("preserve phase, config and dependency", func(t *testing.T) {
+		var order []string
+		newStep := func(name string) *Function[struct{}, struct{}] {
+			return Func(name, func(ctx context.Context) error {
+				order = append(order, name)
+				return nil
+			})
+		}
+		a, b, c := newStep("a"), newStep("b"), newStep("c")
+		stub := newStep("stub")
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(b).DependsOn(a).Timeout(time.Minute),
+			Step(c).DependsOn(b),
+		)
+		assert.NoError(t, workflow.Replace(b, stub))
+		assert.Nil(t, workflow.StateOf(b))
+		assert.NotNil(t, workflow.StateOf(stub))
+		assert.Equal(t, PhaseMain, workflow.PhaseOf(stub))
+		assert.Contains(t, workflow.UpstreamOf(stub), a)
+		assert.Contains(t, workflow.UpstreamOf(c), stub)
+		assert.NotContains(t, workflow.UpstreamOf(c), b)
+		assert.Equal(t, time.Minute, *workflow.StateOf(stub).Option().Timeout)
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, []string{"a", "stub", "c"}, order)
+	})
+	t.Run("replace wrapped step", func(t *testing.T) {
+		inner := &someStep{value: "inner"}
+		wrapped := &wrappedStep{inner}
+		down := &someStep{value: "down"}
+		stub := &someStep{value: "stub"}
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(wrapped),
+			Step(down).DependsOn(inner),
+		)
+		assert.NoError(t, workflow.Replace(wrapped, stub))
+		assert.Nil(t, workflow.StateOf(inner))
+		assert.Nil(t, workflow.RootOf(inner))
+		assert.Contains(t, workflow.UpstreamOf(down), stub)
+		assert.ElementsMatch(t, []Steper{stub, down}, workflow.Steps())
+	})
+	t.Run("error", func(t *testing.T) {
+		inner := &someStep{value: "inner"}
+		wrapped := &wrappedStep{inner}
+		other := &someStep{value: "other"}
+		workflow := new(Workflow)
+		workflow.Add(Step(wrapped), Step(other))
+		var notIn ErrStepNotInWorkflow
+		assert.ErrorAs(t, workflow.Replace(&someStep{value: "absent"}, other), &notIn)
+		assert.Error(t, workflow.Replace(inner, &someStep{}))
+		assert.Error(t, workflow.Replace(wrapped, nil))
+		assert.Error(t, workflow.Replace(wrapped, other))
+		assert.NoError(t, workflow.Replace(wrapped, wrapped))
+
+		workflow.isRunning.Lock()
+		defer workflow.isRunning.Unlock()
+		assert.ErrorIs(t, workflow.Replace(wrapped, &someStep{}), ErrWorkflowIsRunning)
+	})
+}
+
+func TestMerge(t *testing.T) {
+	t.Run("flatten into one DAG", func(t *testing.T) {
+		var mu sync.Mutex
+		var order []string
+		newStep := func(name string) *Function[struct{}, struct{}] {
+			return Func(name, func(ctx context.Context) error {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, name)
+				return nil
+			})
+		}
+		setup, a, b, shared := newStep("setup"), newStep("a"), newStep("b"), newStep("shared")
+		c, d, cleanup := newStep("c"), newStep("d"), newStep("cleanup")
+		workflow := new(Workflow)
+		workflow.Register("a", a)
+		workflow.Init(Step(setup))
+		workflow.Add(
+			Step(b).DependsOn(a),
+			Step(shared).Timeout(time.Minute),
+		)
+		other := new(Workflow)
+		other.Add(
+			Step(d).DependsOn(c).DependsOnID("a"), // resolved after merged
+			Step(shared).Group("shared"),
+		)
+		other.Defer(Step(cleanup))
+		assert.NoError(t, workflow.Merge(other))
+		assert.NoError(t, workflow.Merge(nil))
+		assert.NoError(t, workflow.Merge(workflow))
+		workflow.Add(Step(c).DependsOn(b)) // cross-workflow dependency
+
+		assert.ElementsMatch(t, []Steper{setup, a, b, shared, c, d, cleanup}, workflow.Steps())
+		assert.Equal(t, PhaseInit, workflow.PhaseOf(setup))
+		assert.Equal(t, PhaseDefer, workflow.PhaseOf(cleanup))
+		assert.ElementsMatch(t, []Steper{a, c}, keys(workflow.UpstreamOf(d)))
+		option := workflow.StateOf(shared).Option()
+		assert.Equal(t, time.Minute, *option.Timeout)
+		assert.Equal(t, "shared", option.Group)
+		// other is not modified
+		assert.ElementsMatch(t, []Steper{c, d, shared, cleanup}, other.Steps())
+		assert.Empty(t, other.UpstreamOf(c))
+		assert.Nil(t, other.StateOf(a))
+
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, "setup", order[0])
+		assert.Equal(t, "cleanup", order[len(order)-1])
+		index := func(name string) int { return slices.Index(order, name) }
+		assert.Less(t, index("a"), index("b"))
+		assert.Less(t, index("b"), index("c"))
+		assert.Less(t, index("c"), index("d"))
+	})
+	t.Run("conflict", func(t *testing.T) {
+		a, b := noopStep("a"), noopStep("b")
+		idConflict := new(Workflow).Add(Step(b))
+		idConflict.Register("a", b)
+		for name, other := range map[string]*Workflow{
+			"id":      idConflict,
+			"phase":   new(Workflow).Init(Step(a)),
+			"timeout": new(Workflow).Add(Step(a).Timeout(time.Hour)),
+		} {
+			workflow := new(Workflow).Add(Step(a).Timeout(time.Minute))
+			workflow.Register("a", a)
+			assert.Error(t, workflow.Merge(other), name)
+			assert.Equal(t, []Steper{a}, workflow.Steps(), name)
+		}
+	})
+	t.Run("running", func(t *testing.T) {
+		workflow, other := new(Workflow), new(Workflow).Add(Step(noopStep("a")))
+		workflow.isRunning.Lock()
+		assert.ErrorIs(t, workflow.Merge(other), ErrWorkflowIsRunning)
+		workflow.isRunning.Unlock()
+		other.isRunning.Lock()
+		defer other.isRunning.Unlock()
+		assert.ErrorIs(t, workflow.Merge(other), ErrWorkflowIsRunning)
+	})
+}
+
+func TestCancelPendingSteps(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	a := Func("a", func(ctx context.Context) error {
+		close(started)
+		<-release // ignore the context
+		return nil
+	})
+	b, c, d := noopStep("b"), noopStep("c"), noopStep("d")
+	always := noopStep("always")
+	workflow := new(Workflow)
+	workflow.Add(
+		Pipe(a, b, c, d),
+		Step(always).DependsOn(c).When(Always),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error)
+	go func() { errCh <- workflow.Do(ctx) }()
+	<-started
+	cancel()
+	assert.Eventually(t, func() bool {
+		for _, step := range []Steper{b, c, d} {
+			if workflow.StateOf(step).GetStatus() != Canceled {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, Running, workflow.StateOf(a).GetStatus())
+	close(release)
+	<-errCh
+	assert.Equal(t, Succeeded, workflow.StateOf(a).GetStatus())
+	assert.Equal(t, Succeeded, workflow.StateOf(always).GetStatus())
+}
+
+func TestStats(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		stats := new(Workflow).Stats()
+		assert.Zero(t, stats.Steps)
+		assert.Zero(t, stats.Depth)
+		assert.Zero(t, stats.Width)
+	})
+	t.Run("phases and levels", func(t *testing.T) {
+		setup := noopStep("setup")
+		a, b, c, d := noopStep("a"), noopStep("b"), noopStep("c"), noopStep("d")
+		cleanup := noopStep("cleanup")
+		workflow := new(Workflow)
+		workflow.Init(Step(setup))
+		workflow.Add(
+			Steps(b, c, d).DependsOn(a), // a -> b, c, d
+		)
+		workflow.Defer(Step(cleanup))
+		stats := workflow.Stats()
+		assert.Equal(t, 6, stats.Steps)
+		assert.Equal(t, map[Phase]int{PhaseInit: 1, PhaseMain: 4, PhaseDefer: 1}, stats.Phases)
+		assert.Equal(t, 4, stats.Depth) // setup -> a -> b, c, d -> cleanup
+		assert.Equal(t, 3, stats.Width) // b, c, d
+		for step, level := range map[Steper]int{setup: 0, a: 1, b: 2, c: 2, d: 2, cleanup: 3} {
+			assert.Equal(t, level, workflow.LevelOf(step), String(step))
+		}
+		assert.Equal(t, -1, workflow.LevelOf(noopStep("absent")))
+	})
+	t.Run("cycle is not counted", func(t *testing.T) {
+		a := noopStep("a")
+		b := noopStep("b")
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(a).DependsOn(b),
+			Step(b).DependsOn(a),
+		)
+		stats := workflow.Stats()
+		assert.Equal(t, 2, stats.Steps)
+		assert.Zero(t, stats.Depth)
+		assert.Equal(t, -1, workflow.LevelOf(a))
+		assert.ErrorAs(t, workflow.Do(context.Background()), new(ErrCycleDependency))
+	})
+}
+
+func TestTopoSorted(t *testing.T) {
+	t.Run("sorted by level then name", func(t *testing.T) {
+		setup := noopStep("setup")
+		a, b, c, d := noopStep("a"), noopStep("b"), noopStep("c"), noopStep("d")
+		workflow := new(Workflow)
+		workflow.Init(Step(setup))
+		workflow.Add(
+			Steps(d, b).DependsOn(c),
+			Step(a),
+		)
+		for i := 0; i < 10; i++ {
+			sorted, err := workflow.TopoSorted()
+			assert.NoError(t, err)
+			assert.Equal(t, []Steper{setup, a, c, b, d}, sorted)
+		}
+	})
+	t.Run("cycle", func(t *testing.T) {
+		a, b := noopStep("a"), noopStep("b")
+		workflow := new(Workflow).Add(Step(a).DependsOn(b), Step(b).DependsOn(a))
+		_, err := workflow.TopoSorted()
+		assert.ErrorAs(t, err, new(ErrCycleDependency))
+	})
+	t.Run("empty", func(t *testing.T) {
+		sorted, err := new(Workflow).TopoSorted()
+		assert.NoError(t, err)
+		assert.Empty(t, sorted)
+	})
+}
+
+func TestParentsAndChildren(t *testing.T) {
+	z, y, x := noopStep("z"), noopStep("y"), noopStep("x")
+	b, a := noopStep("b"), noopStep("a")
+	down := noopStep("down")
+	workflow := new(Workflow)
+	workflow.Add(Step(z))
+	workflow.Add(Step(y))
+	workflow.Add(Step(down).DependsOn(b, x, a)) // a, b, x are added together
+	workflow.Add(Steps(z, y).DependsOn(x))
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, []Steper{a, b, x}, workflow.Parents(down))
+		assert.Equal(t, []Steper{z, y, down}, workflow.Children(x))
+	}
+	assert.Empty(t, workflow.Parents(a))
+	assert.Empty(t, workflow.Children(down))
+}
+
+func TestCriticalPath(t *testing.T) {
+	sleep := func(name string, d time.Duration) Steper {
+		return Func(name, func(ctx context.Context) error {
+			time.Sleep(d)
+			return nil
+		})
+	}
+	setup := sleep("setup", 10*time.Millisecond)
+	a, b, c, d := sleep("a", 10*time.Millisecond), sleep("b", 50*time.Millisecond), sleep("c", 5*time.Millisecond), sleep("d", 30*time.Millisecond)
+	cleanup := sleep("cleanup", time.Millisecond)
+	workflow := new(Workflow)
+	workflow.Init(Step(setup))
+	workflow.Add(
+		Steps(b, c).DependsOn(a),
+		Step(d),
+	)
+	workflow.Defer(Step(cleanup))
+	assert.Empty(t, workflow.CriticalPath())
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, []Steper{setup, a, b, cleanup}, workflow.CriticalPath())
+}
+
+func TestCriticalPathRetry(t *testing.T) {
+	// flaky does little work, but waits between retries
+	var attempts atomic.Int32
+	flaky := Func("flaky", func(ctx context.Context) error {
+		if attempts.Add(1) < 3 {
+			return assert.AnError
+		}
+		return nil
+	})
+	slow := Func("slow", func(ctx context.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	workflow := new(Workflow)
+	workflow.Add(
+		Step(flaky).Retry(func(ro *RetryOption) {
+			ro.DelayFunc = func(int, error) time.Duration { return 30 * time.Millisecond }
+		}),
+		Step(slow),
+	)
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, []Steper{flaky}, workflow.CriticalPath())
+	state := workflow.StateOf(flaky)
+	assert.Less(t, state.WorkTime(), 10*time.Millisecond)
+	assert.GreaterOrEqual(t, state.TotalTime(), 60*time.Millisecond)
+}
+
+func TestCurrentPhase(t *testing.T) {
+	workflow := new(Workflow)
+	var phases []Phase
+	record := func(name string) Steper {
+		return Func(name, func(ctx context.Context) error {
+			phases = append(phases, workflow.CurrentPhase())
+			return nil
+		})
+	}
+	workflow.Init(Step(record("setup")))
+	workflow.Add(Step(record("main")))
+	workflow.Defer(Step(record("cleanup")))
+	assert.Equal(t, PhaseUnknown, workflow.CurrentPhase(), "not running")
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, []Phase{PhaseInit, PhaseMain, PhaseDefer}, phases)
+	assert.Equal(t, PhaseUnknown, workflow.CurrentPhase(), "finished")
+
+	// polling doesn't contend with Do
+	done := make(chan struct{})
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				workflow.CurrentPhase()
+			}
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, workflow.Reset())
+		assert.NoError(t, workflow.Do(context.Background()))
+	}
+	close(done)
+	<-polled
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	t.Run("merged from multiple adds", func(t *testing.T) {
+		a, b := noopStep("a"), noopStep("b")
+		workflow := new(Workflow).Options(WithStartJitter(time.Second))
+		workflow.Add(Step(b).DependsOn(a).Timeout(time.Minute))
+		workflow.Add(Step(b).Optional().Timeout(time.Hour))
+		ec := workflow.EffectiveConfig(b)
+		assert.Equal(t, Set[Steper]{a: {}}, ec.Upstreams)
+		opt := new(StepOption)
+		ec.Option(opt)
+		assert.Equal(t, time.Hour, *opt.Timeout, "later config wins")
+		assert.True(t, opt.Optional)
+		assert.Equal(t, time.Second, *opt.StartJitter, "default from Workflow")
+	})
+	t.Run("nested", func(t *testing.T) {
+		a := noopStep("a")
+		inner := new(Workflow)
+		inner.Add(Step(a).Timeout(time.Minute))
+		outer := new(Workflow)
+		outer.Add(Step(inner))
+		opt := new(StepOption)
+		outer.EffectiveConfig(a).Option(opt)
+		assert.Equal(t, time.Minute, *opt.Timeout)
+	})
+	t.Run("not in workflow", func(t *testing.T) {
+		assert.Equal(t, StepConfig{}, new(Workflow).EffectiveConfig(noopStep("a")))
+	})
+}
+
+func TestSkipAndCancel(t *testing.T) {
+	skipped := Func("skipped", func(ctx context.Context) error {
+		return fmt.Errorf("wrap: %w", Skip(fmt.Errorf("skip")))
+	})
+	canceled := Func("canceled", func(ctx context.Context) error {
+		return fmt.Errorf("wrap: %w", Cancel(fmt.Errorf("cancel")))
+	})
+	workflow := new(Workflow)
+	workflow.Add(Steps(skipped, canceled))
+	_ = workflow.Do(context.Background())
+	assert.Equal(t, Skipped, workflow.StateOf(skipped).GetStatus())
+	assert.Equal(t, Canceled, workflow.StateOf(canceled).GetStatus())
+}
+
+func TestOnlyWithout(t *testing.T) {
+	build := func() (*Workflow, map[string]Steper) {
+		steps := map[string]Steper{}
+		for _, name := range []string{"setup", "build", "test", "deploy", "notify", "lint"} {
+			steps[name] = noopStep(name)
+		}
+		workflow := new(Workflow)
+		workflow.Init(Step(steps["setup"]))
+		workflow.Add(
+			Pipe(steps["build"], steps["test"], steps["deploy"], steps["notify"]),
+			Step(steps["lint"]),
+		)
+		return workflow, steps
+	}
+	statuses := func(workflow *Workflow, steps map[string]Steper) map[string]StepStatus {
+		rv := map[string]StepStatus{}
+		for name, step := range steps {
+			rv[name] = workflow.StateOf(step).GetStatus()
+		}
+		return rv
+	}
+	t.Run("only", func(t *testing.T) {
+		workflow, steps := build()
+		assert.NoError(t, workflow.Only(steps["test"]).Do(context.Background()))
+		assert.Equal(t, map[string]StepStatus{
+			"setup":  Skipped,
+			"build":  Succeeded,
+			"test":   Succeeded,
+			"deploy": Skipped,
+			"notify": Skipped,
+			"lint":   Skipped,
+		}, statuses(workflow, steps))
+	})
+	t.Run("without", func(t *testing.T) {
+		workflow, steps := build()
+		assert.NoError(t, workflow.Without(steps["test"]).Do(context.Background()))
+		assert.Equal(t, map[string]StepStatus{
+			"setup":  Succeeded,
+			"build":  Succeeded,
+			"test":   Skipped,
+			"deploy": Skipped,
+			"notify": Skipped,
+			"lint":   Succeeded,
+		}, statuses(workflow, steps))
+	})
+	t.Run("only and without", func(t *testing.T) {
+		workflow, steps := build()
+		workflow.Only(steps["deploy"]).Only(steps["lint"]).Without(steps["build"])
+		assert.NoError(t, workflow.Do(context.Background()))
+		assert.Equal(t, map[string]StepStatus{
+			"setup":  Skipped,
+			"build":  Skipped,
+			"test":   Skipped,
+			"deploy": Skipped,
+			"notify": Skipped,
+			"lint":   Succeeded,
+		}, statuses(workflow, steps))
+	})
+	t.Run("clear filter", func(t *testing.T) {
+		workflow, steps := build()
+		workflow.Only(steps["test"]).Without(steps["lint"]).Only().Without()
+		assert.Empty(t, workflow.excluded())
+	})
+}
+
+func TestRunTargets(t *testing.T) {
+	build := func() (*Workflow, map[string]Steper) {
+		steps := map[string]Steper{}
+		for _, name := range []string{"setup", "build", "test", "deploy", "lint", "cleanup"} {
+			steps[name] = noopStep(name)
+		}
+		workflow := new(Workflow)
+		for name, step := range steps {
+			workflow.Register(name, step)
+		}
+		workflow.Init(Step(steps["setup"]))
+		workflow.Add(
+			Pipe(steps["build"], steps["test"], steps["deploy"]),
+			Step(steps["lint"]),
+		)
+		workflow.Defer(Step(steps["cleanup"]))
+		return workflow, steps
+	}
+	t.Run("targets and implied", func(t *testing.T) {
+		workflow, steps := build()
+		requested, implied, err := workflow.Targets("test", "lint")
+		assert.NoError(t, err)
+		assert.Equal(t, []Steper{steps["lint"], steps["test"]}, requested)
+		assert.Equal(t, []Steper{steps["build"]}, implied)
+	})
+	t.Run("run targets", func(t *testing.T) {
+		workflow, steps := build()
+		assert.NoError(t, workflow.RunTargets(context.Background(), "test"))
+		for name, status := range map[string]StepStatus{
+			"setup":   Succeeded,
+			"build":   Succeeded,
+			"test":    Succeeded,
+			"deploy":  Skipped,
+			"lint":    Skipped,
+			"cleanup": Succeeded,
+		} {
+			assert.Equal(t, status, workflow.StateOf(steps[name]).GetStatus(), name)
+		}
+		assert.Nil(t, workflow.only, "filter is restored")
+	})
+	t.Run("unknown targets", func(t *testing.T) {
+		workflow, steps := build()
+		err := workflow.RunTargets(context.Background(), "test", "release", "docs")
+		assert.Equal(t, ErrUnknownTarget{"release", "docs"}, err)
+		assert.Equal(t, Pending, workflow.StateOf(steps["test"]).GetStatus())
+	})
+}
+
+func TestClone(t *testing.T) {
+	var count atomic.Int32
+	newStep := func(name string) Steper {
+		return Func(name, func(ctx context.Context) error {
+			count.Add(1)
+			return nil
+		})
+	}
+	a, b, c := newStep("a"), newStep("b"), newStep("c")
+	template := new(Workflow).Options(WithMaxConcurrency(1))
+	template.Add(
+		Pipe(a, b),
+		Step(c).DependsOn(b).Timeout(time.Minute),
+	)
+	assert.NoError(t, template.Do(context.Background()))
+	assert.Equal(t, int32(3), count.Load())
+
+	var wg sync.WaitGroup
+	clones := []*Workflow{}
+	for i := 0; i < 5; i++ {
+		clone := template.Clone()
+		clones = append(clones, clone)
+		assert.Equal(t, Pending, clone.StateOf(a).GetStatus())
+		assert.Contains(t, clone.UpstreamOf(c), b)
+		assert.Equal(t, time.Minute, *clone.StateOf(c).Option().Timeout)
+		assert.Equal(t, 1, cap(clone.leaseBucket))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, clone.Do(context.Background()))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(18), count.Load())
+	for _, clone := range clones {
+		assert.Equal(t, Succeeded, clone.StateOf(c).GetStatus())
+	}
+	// the template is not affected by clones
+	clone := template.Clone()
+	clone.Add(Step(newStep("d")).DependsOn(c))
+	assert.Len(t, template.Steps(), 3)
+	assert.Len(t, clone.Steps(), 4)
+}
+
+func TestWait(t *testing.T) {
+	release := make(chan struct{})
+	a := Func("a", func(ctx context.Context) error {
+		<-release
+		return fmt.Errorf("a failed")
+	})
+	b := noopStep("b")
+	workflow := new(Workflow)
+	workflow.Add(Step(b).DependsOn(a).When(Always))
+
+	_, err := workflow.Wait(context.Background(), Func("absent", nil))
+	assert.ErrorAs(t, err, new(ErrStepNotInWorkflow))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = workflow.Do(context.Background())
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	statusErr, err := workflow.Wait(ctx, b)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, Pending, statusErr.Status)
+
+	close(release)
+	statusErr, err = workflow.Wait(context.Background(), a)
+	assert.NoError(t, err)
+	assert.Equal(t, Failed, statusErr.Status)
+	assert.ErrorContains(t, statusErr.Err, "a failed")
+	statusErr, err = workflow.Wait(context.Background(), b)
+	assert.NoError(t, err)
+	assert.Equal(t, Succeeded, statusErr.Status)
+	<-done
+	// wait a terminated Step returns immediately
+	statusErr, err = workflow.Wait(context.Background(), a)
+	assert.NoError(t, err)
+	assert.Equal(t, Failed, statusErr.Status)
+}
+
+func TestDoWithin(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		quick := noopStep("quick")
+		slow := Func("slow", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		down, cleanup := noopStep("down"), noopStep("cleanup")
+		workflow := new(Workflow)
+		workflow.Add(
+			Step(quick),
+			Step(down).DependsOn(slow),
+		)
+		workflow.Defer(Step(cleanup).When(Always))
+		partial, err := workflow.DoWithin(context.Background(), 10*time.Millisecond)
+		assert.Equal(t, ErrWorkflowTimeout{Timeout: 10 * time.Millisecond}, err)
+		assert.Len(t, partial, 4)
+		assert.Equal(t, Succeeded, partial[quick].Status)
+		assert.Equal(t, Canceled, partial[slow].Status)
+		assert.ErrorIs(t, partial[slow].Err, ErrWorkflowTimeout{Timeout: 10 * time.Millisecond})
+		assert.Equal(t, Canceled, partial[down].Status)
+		assert.Equal(t, Succeeded, partial[cleanup].Status)
+	})
+	t.Run("grace period", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		stubborn := Func("stubborn", func(ctx context.Context) error {
+			<-release // ignores the cancellation
+			return nil
+		})
+		workflow := new(Workflow).Options(WithCancelGracePeriod(10 * time.Millisecond))
+		workflow.Add(Step(stubborn))
+		partial, err := workflow.DoWithin(context.Background(), 10*time.Millisecond)
+		assert.ErrorAs(t, err, new(ErrWorkflowTimeout))
+		assert.Equal(t, Canceled, partial[stubborn].Status)
+	})
+	t.Run("finished in time", func(t *testing.T) {
+		step := noopStep("step")
+		workflow := new(Workflow)
+		workflow.Add(Step(step))
+		partial, err := workflow.DoWithin(context.Background(), time.Hour)
+		assert.NoError(t, err)
+		assert.Equal(t, Succeeded, partial[step].Status)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("yield events in order", func(t *testing.T) {
+		a, b := noopStep("a"), Func("b", func(ctx context.Context) error { return fmt.Errorf("b failed") })
+		c := noopStep("c")
+		workflow := new(Workflow).Add(Pipe(a, b, c))
+		var events []string
+		var last error
+		workflow.Run(context.Background())(func(event StepEvent, err error) bool {
+			if err != nil {
+				last = err
+				return true
+			}
+			events = append(events, fmt.Sprintf("%s %s", event.Step, event.Status))
+			return true
+		})
+		assert.Equal(t, []string{"a Running", "a Succeeded", "b Running", "b Failed", "c Skipped"}, events)
+		var errWorkflow ErrWorkflow
+		if assert.ErrorAs(t, last, &errWorkflow) {
+			assert.ErrorContains(t, errWorkflow[b].Err, "b failed")
+		}
+	})
+	t.Run("break early cancels the Workflow", func(t *testing.T) {
+		a := Func("a", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		b := noopStep("b")
+		workflow := new(Workflow).Add(Step(b).DependsOn(a))
+		workflow.Run(context.Background())(func(event StepEvent, err error) bool {
+			return false // break after a is Running
+		})
+		assert.Equal(t, Canceled, workflow.StateOf(a).GetStatus())
+		assert.Equal(t, Canceled, workflow.StateOf(b).GetStatus())
+	})
+	t.Run("slow consumer doesn't block Steps", func(t *testing.T) {
+		done := make(chan struct{})
+		a, b := noopStep("a"), noopStep("b")
+		c := Func("c", func(ctx context.Context) error {
+			close(done)
+			return nil
+		})
+		workflow := new(Workflow).Add(Pipe(a, b, c))
+		var count int
+		workflow.Run(context.Background())(func(event StepEvent, err error) bool {
+			if count++; count == 1 {
+				<-done // the first event is consumed after c started
+			}
+			return true
+		})
+		assert.Equal(t, 6, count)
+		assert.Equal(t, Succeeded, workflow.StateOf(c).GetStatus())
+	})
+}
+
+func TestReset(t *testing.T) {
+	var count atomic.Int32
+	a := Func("a", func(ctx context.Context) error {
+		count.Add(1)
+		return nil
+	})
+	b := Func("b", func(ctx context.Context) error {
+		if count.Load() == 1 {
+			return fmt.Errorf("b failed in first run")
+		}
+		return nil
+	})
+	inner := new(Workflow).Add(Step(b))
+	workflow := new(Workflow).Add(Step(inner).DependsOn(a))
+
+	assert.Error(t, workflow.Do(context.Background()))
+	assert.ErrorAs(t, workflow.Do(context.Background()), new(ErrUnexpectStepInitStatus))
+
+	assert.NoError(t, workflow.Reset())
+	assert.Equal(t, Pending, workflow.StateOf(a).GetStatus())
+	assert.Nil(t, workflow.StateOf(inner).GetError())
+	assert.Empty(t, workflow.StateOf(a).Attempts())
+	assert.Equal(t, Pending, inner.StateOf(b).GetStatus())
+
+	assert.NoError(t, workflow.Do(context.Background()))
+	assert.Equal(t, int32(2), count.Load())
+	assert.Equal(t, Succeeded, inner.StateOf(b).GetStatus())
+	assert.Len(t, workflow.StateOf(a).Attempts(), 1)
+
+	t.Run("running", func(t *testing.T) {
+		started, stop := make(chan struct{}), make(chan struct{})
+		workflow := new(Workflow).Add(Step(Func("block", func(ctx context.Context) error {
+			close(started)
+			<-stop
+			return nil
+		})))
+		done := make(chan error)
+		go func() { done <- workflow.Do(context.Background()) }()
+		<-started
+		assert.ErrorIs(t, workflow.Reset(), ErrWorkflowIsRunning)
+		close(stop)
+		assert.NoError(t, <-done)
+	})
+}
+
+func TestAbort(t *testing.T) {
+	fatal := fmt.Errorf("fatal")
+	check := Func("check", func(ctx context.Context) error {
+		return Abort(ctx, fatal)
+	})
+	long := Func("long", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	next := noopStep("next")
+	inner := new(Workflow).Add(Step(check))
+	workflow := new(Workflow).Add(
+		Steps(inner, long),
+		Step(next).DependsOn(inner),
+	)
+	err := workflow.Do(context.Background())
+	var errAbort ErrAbort
+	if assert.ErrorAs(t, err, &errAbort) {
+		assert.Equal(t, check, errAbort.Step)
+	}
+	assert.ErrorIs(t, err, fatal)
+	assert.Equal(t, Failed, inner.StateOf(check).GetStatus())
+	assert.ErrorIs(t, inner.StateOf(check).GetError(), fatal)
+	assert.Equal(t, Canceled, workflow.StateOf(long).GetStatus())
+	assert.ErrorAs(t, workflow.StateOf(long).GetError(), new(ErrAbort), "abort is the cause")
+	assert.Equal(t, Canceled, workflow.StateOf(next).GetStatus())
+
+	t.Run("outside Workflow", func(t *testing.T) {
+		err := Abort(context.Background(), fatal)
+		assert.ErrorIs(t, err, fatal)
+	})
+}
+
+func TestDeadlock(t *testing.T) {
+	a := noopStep("a")
+	b := noopStep("b")
+	c := noopStep("c")
+	workflow := new(Workflow).Add(
+		Step(b).DependsOn(a),
+		Step(c),
+	)
+	workflow.oneStepTerminated = make(chan struct{}, 4)
+	// a is Running but no goroutine runs it, i.e. a logic bug
+	workflow.StateOf(a).SetStatus(Running)
+	workflow.StateOf(c).SetStatus(Succeeded)
+	t.Run("pending tick", func(t *testing.T) {
+		workflow.signalTick()
+		assert.Empty(t, workflow.stuck())
+		<-workflow.oneStepTerminated
+	})
+	t.Run("running Step", func(t *testing.T) {
+		workflow.inflight.Add(1)
+		assert.Empty(t, workflow.stuck())
+		workflow.inflight.Add(-1)
+	})
+	t.Run("stuck", func(t *testing.T) {
+		deadlock := workflow.stuck()
+		assert.Equal(t, ErrDeadlock{a: {}, b: {a}}, deadlock)
+		assert.Equal(t, "Deadlock, Steps are stuck with pending Upstreams:\na: []\nb: [a]", deadlock.Error())
+	})
+	t.Run("init Step depends on main Step", func(t *testing.T) {
+		main := noopStep("main")
+		init := noopStep("init")
+		workflow := new(Workflow)
+		workflow.Add(Step(main))
+		workflow.Init(Step(init))
+		// DependsOn would add main into phase Init as well, bypass it to make main a Main-only Upstream,
+		// then phase Init never terminates, and phase Main never starts.
+		workflow.StateOf(init).AddUpstream(main)
+		err := workflow.Do(context.Background())
+		var deadlock ErrDeadlock
+		if assert.ErrorAs(t, err, &deadlock) {
+			assert.Equal(t, ErrDeadlock{init: {main}, main: {}}, deadlock)
+		}
+		assert.Equal(t, Pending, workflow.StateOf(init).GetStatus())
+		assert.Equal(t, Pending, workflow.StateOf(main).GetStatus())
+	})
+	t.Run("no deadlock with many short Steps", func(t *testing.T) {
+		for round := 0; round < 20; round++ {
+			var steps []Steper
+			for i := 0; i < 100; i++ {
+				steps = append(steps, noopStep(fmt.Sprint(i)))
+			}
+			workflow := new(Workflow).Options(WithMaxConcurrency(4))
+			for i := range steps {
+				// each Step depends on a few previous ones, so they terminate and get ticked concurrently
+				workflow.Add(Step(steps[i]).DependsOn(steps[max(0, i-3):i]...))
+			}
+			assert.NoError(t, workflow.Do(context.Background()))
+		}
+	})
+}
+
+func TestRunningSteps(t *testing.T) {
+	assert.Empty(t, new(Workflow).RunningSteps())
+	started, release := make(chan struct{}), make(chan struct{})
+	block := func(name string) Steper {
+		return Func(name, func(ctx context.Context) error {
+			started <- struct{}{}
+			<-release
+			return nil
+		})
+	}
+	a, b, c := block("a"), block("b"), noopStep("c")
+	workflow := new(Workflow).Add(Steps(a, b), Step(c).DependsOn(a, b))
+	done := make(chan error)
+	go func() { done <- workflow.Do(context.Background()) }()
+	<-started
+	<-started
+	assert.ElementsMatch(t, []Steper{a, b}, workflow.RunningSteps())
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Empty(t, workflow.RunningSteps())
+}
+
+func TestGroupStatus(t *testing.T) {
+	i1, i2 := noopStep("i1"), noopStep("i2")
+	t1 := noopStep("t1")
+	t2 := Func("t2", func(ctx context.Context) error { return Skip(fmt.Errorf("nothing to transform")) })
+	workflow := new(Workflow)
+	var during map[string]StepStatus
+	l1 := Func("l1", func(ctx context.Context) error {
+		during = map[string]StepStatus{
+			"ingest":    workflow.GroupStatus("ingest"),
+			"transform": workflow.GroupStatus("transform"),
+			"load":      workflow.GroupStatus("load"),
+		}
+		return nil
+	})
+	l2 := Func("l2", func(ctx context.Context) error { return fmt.Errorf("load failed") })
+	workflow.Add(
+		Steps(i1, i2).Group("ingest"),
+		Steps(t1, t2).Group("transform").DependsOn(i1, i2),
+		Step(l1).Group("load").DependsOn(t1, t2).When(Always),
+		Step(l2).Group("load").DependsOn(l1),
+	)
+	assert.Equal(t, Pending, workflow.GroupStatus("ingest"))
+	assert.Error(t, workflow.Do(context.Background()))
+	assert.Equal(t, map[string]StepStatus{
+		"ingest":    Succeeded,
+		"transform": Skipped, // t2 is Skipped
+		"load":      Running, // l1 is Running, l2 is Pending
+	}, during)
+	assert.Equal(t, Failed, workflow.GroupStatus("load"))
+	assert.Equal(t, Pending, workflow.GroupStatus("not exist"))
+
+	t.Run("aggregation", func(t *testing.T) {
+		const Degraded, Partial StepStatus = "Degraded", "Partial"
+		for _, tc := range []struct {
+			statuses []StepStatus
+			expected StepStatus
+		}{
+			{nil, Pending},
+			{[]StepStatus{Pending, Pending}, Pending},
+			{[]StepStatus{Running, Pending}, Running},
+			{[]StepStatus{Succeeded, Pending}, Running},
+			{[]StepStatus{Running, Failed}, Running},
+			{[]StepStatus{Succeeded, Failed, Canceled}, Failed},
+			{[]StepStatus{Succeeded, Canceled, Skipped}, Canceled},
+			{[]StepStatus{Succeeded, Partial, Degraded, Skipped}, Degraded},
+			{[]StepStatus{Degraded}, Degraded},
+			{[]StepStatus{Succeeded, Skipped}, Skipped},
+			{[]StepStatus{Skipped, Skipped}, Skipped},
+			{[]StepStatus{Succeeded, Succeeded}, Succeeded},
+		} {
+			workflow := new(Workflow).Add(Step(noopStep("other")).Group("other"))
+			for i, status := range tc.statuses {
+				step := noopStep(fmt.Sprint(i))
+				workflow.Add(Step(step).Group("group"))
+				workflow.StateOf(step).SetStatus(status)
+			}
+			assert.Equal(t, tc.expected, workflow.GroupStatus("group"), "%v", tc.statuses)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package flow
 import (
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 )
 
@@ -233,6 +234,101 @@ func (sc StepTree) Roots() Set[Steper] {
 	return rv
 }
 
+// Walk walks through all Steps in the tree, from roots to leaves.
+//
+// fn is called with each Step and its direct parent, parent is nil for root Steps.
+// Roots are walked in the order of their String() representation.
+func (st StepTree) Walk(fn func(step, parent Steper)) {
+	for _, root := range st.sortedRoots() {
+		st.walk(root, nil, 0, func(step, parent Steper, _ int) bool {
+			fn(step, parent)
+			return true
+		})
+	}
+}
+
+// Leaves returns all Steps in the tree that don't wrap any other Step,
+// they are the actual workers, others are wrappers.
+func (st StepTree) Leaves() []Steper {
+	var leaves []Steper
+	st.Walk(func(step, _ Steper) {
+		if len(st.children(step)) == 0 {
+			leaves = append(leaves, step)
+		}
+	})
+	return leaves
+}
+
+// Depth returns the number of ancestors of the step, root Steps have depth 0.
+// Depth returns -1 if the step is not in the tree.
+func (st StepTree) Depth(step Steper) int {
+	root := st.RootOf(step)
+	if root == nil {
+		return -1
+	}
+	depth := -1
+	st.walk(root, nil, 0, func(s, _ Steper, d int) bool {
+		if s == step {
+			depth = d
+			return false
+		}
+		return true
+	})
+	return depth
+}
+
+// walk walks the subtree of step in depth-first order, stops when fn returns false.
+func (st StepTree) walk(step, parent Steper, depth int, fn func(step, parent Steper, depth int) bool) bool {
+	if !fn(step, parent, depth) {
+		return false
+	}
+	for _, child := range st.children(step) {
+		if !st.walk(child, step, depth+1, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// children returns the direct inner Steps of step in the tree.
+func (st StepTree) children(step Steper) []Steper {
+	var rv []Steper
+	for _, inner := range unwrap(step) {
+		if _, ok := st[inner]; ok {
+			rv = append(rv, inner)
+		}
+	}
+	return rv
+}
+
+func (st StepTree) sortedRoots() []Steper {
+	var roots []Steper
+	for root := range st.Roots() {
+		roots = append(roots, root)
+	}
+	sort.SliceStable(roots, func(i, j int) bool { return String(roots[i]) < String(roots[j]) })
+	return roots
+}
+
+// unwrap returns the direct inner Steps of step.
+func unwrap(step Steper) []Steper {
+	switch u := step.(type) {
+	case interface{ Unwrap() Steper }:
+		if inner := u.Unwrap(); inner != nil {
+			return []Steper{inner}
+		}
+	case interface{ Unwrap() []Steper }:
+		var rv []Steper
+		for _, inner := range u.Unwrap() {
+			if inner != nil {
+				rv = append(rv, inner)
+			}
+		}
+		return rv
+	}
+	return nil
+}
+
 // Add a step and all it's descendant steps to the tree.
 //
 // If step is already in the tree, it's no-op.
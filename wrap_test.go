@@ -217,3 +217,39 @@ func TestStepTree(t *testing.T) {
 		})
 	})
 }
+
+func TestStepTreeTraversal(t *testing.T) {
+	a := &someStep{value: "a"}
+	b := &someStep{value: "b"}
+	c := &someStep{value: "c"}
+	A := &wrappedStep{Steper: a}
+	Ab := &multiStep{steps: []Steper{A, b}}
+	tree := make(StepTree)
+	tree.Add(Ab)
+	tree.Add(c)
+
+	t.Run("walk", func(t *testing.T) {
+		parents := map[Steper]Steper{}
+		tree.Walk(func(step, parent Steper) {
+			parents[step] = parent
+		})
+		assert.Equal(t, map[Steper]Steper{
+			Ab: nil,
+			A:  Ab,
+			a:  A,
+			b:  Ab,
+			c:  nil,
+		}, parents)
+	})
+	t.Run("leaves", func(t *testing.T) {
+		assert.ElementsMatch(t, []Steper{a, b, c}, tree.Leaves())
+	})
+	t.Run("depth", func(t *testing.T) {
+		assert.Equal(t, 0, tree.Depth(Ab))
+		assert.Equal(t, 1, tree.Depth(A))
+		assert.Equal(t, 2, tree.Depth(a))
+		assert.Equal(t, 1, tree.Depth(b))
+		assert.Equal(t, 0, tree.Depth(c))
+		assert.Equal(t, -1, tree.Depth(&someStep{}))
+	})
+}